@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// The Docker plugin protocol only asks for secret values, so operations an
+// admin triggers are served by a separate HTTP API on VAULT_ADMIN_ADDR.
+// Every request needs the VAULT_ADMIN_TOKEN bearer token.
+
+// serveAdmin starts the admin API when VAULT_ADMIN_ADDR is set. Listening
+// happens before it returns, so a bad address fails startup.
+func (d *VaultDriver) serveAdmin() error {
+	if d.config.AdminAddr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", d.config.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for the admin API: %v", err)
+	}
+	d.adminServer = &http.Server{Handler: d.adminHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := d.adminServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Admin API stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving admin API on %s", listener.Addr())
+	return nil
+}
+
+// adminHandler routes the admin API
+func (d *VaultDriver) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/history", func(w http.ResponseWriter, r *http.Request) {
+		history := d.RotationHistory()
+		if history == nil {
+			history = []RotationRecord{}
+		}
+		writeAdminJSON(w, r, http.StatusOK, history)
+	})
+	mux.HandleFunc("GET /admin/config", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, r, http.StatusOK, d.ConfigSettings())
+	})
+	mux.HandleFunc("POST /admin/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Secret  string            `json:"secret"`
+			Service string            `json:"service"`
+			Labels  map[string]string `json:"labels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAdminError(w, r, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+			return
+		}
+		result, err := d.ResolveSecret(secrets.Request{SecretName: body.Secret, ServiceName: body.Service, SecretLabels: body.Labels})
+		if err != nil {
+			// Without a path the request itself was refused, otherwise Vault failed
+			status := http.StatusBadGateway
+			if result.Path == "" {
+				status = http.StatusBadRequest
+			}
+			writeAdminError(w, r, status, err)
+			return
+		}
+		writeAdminJSON(w, r, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		status := d.Status()
+		code := http.StatusOK
+		if status.State != "healthy" {
+			code = http.StatusServiceUnavailable
+		}
+		writeAdminJSON(w, r, code, status)
+	})
+	mux.HandleFunc("GET /admin/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, d.StatusLine())
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Prometheus unless the client asks for JSON
+		if acceptsJSON(r) {
+			writeAdminJSON(w, r, http.StatusOK, d.Metrics())
+			return
+		}
+		w.Header().Set("Content-Type", prometheusContentType)
+		if err := d.metrics.writePrometheus(w); err != nil {
+			log.Debugf("Failed to write metrics: %v", err)
+		}
+	})
+	mux.HandleFunc("GET /admin/history/pending", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, r, http.StatusOK, d.PendingRotations())
+	})
+	mux.HandleFunc("POST /admin/rotation/approve", func(w http.ResponseWriter, r *http.Request) {
+		secretName := r.URL.Query().Get("secret")
+		if secretName == "" {
+			writeAdminError(w, r, http.StatusBadRequest, errors.New("secret is required"))
+			return
+		}
+		if err := d.ApproveRotation(secretName); err != nil {
+			writeAdminError(w, r, http.StatusConflict, err)
+			return
+		}
+		writeAdminJSON(w, r, http.StatusOK, map[string]string{"secret": secretName})
+	})
+	mux.HandleFunc("POST /admin/rotation/rollback", func(w http.ResponseWriter, r *http.Request) {
+		secretName := r.URL.Query().Get("secret")
+		if secretName == "" {
+			writeAdminError(w, r, http.StatusBadRequest, errors.New("secret is required"))
+			return
+		}
+		if err := d.RollbackRotation(secretName); err != nil {
+			writeAdminError(w, r, http.StatusConflict, err)
+			return
+		}
+		writeAdminJSON(w, r, http.StatusOK, map[string]string{"secret": secretName})
+	})
+	mux.HandleFunc("POST /admin/selftest", func(w http.ResponseWriter, r *http.Request) {
+		stages := d.SelfTest()
+		status := http.StatusOK
+		for _, stage := range stages {
+			if !stage.OK {
+				status = http.StatusInternalServerError
+			}
+		}
+		writeAdminJSON(w, r, status, stages)
+	})
+	return d.requireAdminToken(mux)
+}
+
+// requireAdminToken rejects requests without the VAULT_ADMIN_TOKEN bearer token
+func (d *VaultDriver) requireAdminToken(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + d.config.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			d.metrics.inc("vault_admin_unauthorized_total")
+			writeAdminError(w, r, http.StatusUnauthorized, errors.New("invalid admin token"))
+			return
+		}
+		log.Printf("Admin API: %s %s", r.Method, r.URL.RequestURI())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsJSON reports whether the Accept header prefers JSON over plain text
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		switch strings.TrimSpace(mediaType) {
+		case "application/json":
+			return true
+		case "text/plain", "application/openmetrics-text":
+			return false
+		}
+	}
+	return false
+}
+
+// writeAdminJSON writes a JSON response, indented for ?pretty=true
+func writeAdminJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		encoder.SetIndent("", "  ")
+	}
+	encoder.Encode(body)
+}
+
+// writeAdminError writes an error as {"error": "..."}
+func writeAdminError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeAdminJSON(w, r, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestAdminAPIApprovesRotations(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, AdminToken: "s3cret"},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+	call := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_rotation_mode": "manual"}})
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	for _, token := range []string{"", "wrong"} {
+		if resp := call(http.MethodGet, "/admin/history/pending", token); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected token %q to be rejected, got %d", token, resp.StatusCode)
+		}
+	}
+
+	resp := call(http.MethodGet, "/admin/history/pending", "s3cret")
+	var pending []PendingRotation
+	if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil || len(pending) != 1 || pending[0].SecretName != "db" || pending[0].Hash == "" {
+		t.Fatalf("Expected db to be pending, got %+v (%v)", pending, err)
+	}
+
+	if resp := call(http.MethodPost, "/admin/rotation/approve", "s3cret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a missing secret to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := call(http.MethodPost, "/admin/rotation/approve?secret=other", "s3cret"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a secret without a held change to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := call(http.MethodPost, "/admin/rotation/approve?secret=db", "s3cret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the approval to succeed, got %d", resp.StatusCode)
+	}
+	if !fd.called("POST /services/svc-1/update") {
+		t.Error("Expected the approved rotation to update the service")
+	}
+}
+
+func TestAdminAPIRollsBackRotations(t *testing.T) {
+	driver, fv, fd, _ := newRollbackTestDriver(t)
+	driver.config.AdminToken = "s3cret"
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+	rollback := func(query string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/rotation/rollback"+query, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := rollback("?secret=db"); status != http.StatusConflict {
+		t.Errorf("Expected a secret without a rollback candidate to be rejected, got %d", status)
+	}
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	if status := rollback(""); status != http.StatusBadRequest {
+		t.Errorf("Expected a missing secret to be rejected, got %d", status)
+	}
+	if status := rollback("?secret=db"); status != http.StatusOK {
+		t.Fatalf("Expected the rollback to succeed, got %d", status)
+	}
+	if names := fd.serviceSecretNames("svc-1"); len(names) != 1 || names[0] != "db" {
+		t.Errorf("Expected the service to be rewired to the previous version, got %v", names)
+	}
+}
+
+func TestAdminAPIRunsSelfTest(t *testing.T) {
+	fd := newFakeDocker(t)
+	driver := &VaultDriver{
+		config:        &VaultConfig{AdminToken: "s3cret"},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/selftest", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var stages []SelfTestStage
+	if err := json.NewDecoder(resp.Body).Decode(&stages); err != nil || resp.StatusCode != http.StatusOK || len(stages) != 5 {
+		t.Errorf("Expected a passing self-test, got %d %+v (%v)", resp.StatusCode, stages, err)
+	}
+}
+
+// adminGet sends an authenticated GET to the admin API
+func adminGet(t *testing.T, server *httptest.Server, path string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAdminAPIListsRotationHistory(t *testing.T) {
+	driver := &VaultDriver{
+		config:        &VaultConfig{AdminToken: "s3cret"},
+		secretTracker: make(map[string]*SecretInfo),
+		history:       newRotationHistory(2),
+		metrics:       newDriverMetrics(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	for _, name := range []string{"a", "b", "c"} {
+		driver.history.add(RotationRecord{SecretName: name, Success: true, NewHash: "abc123"})
+	}
+	resp := adminGet(t, server, "/admin/history")
+	var history []RotationRecord
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the history, got %d (%v)", resp.StatusCode, err)
+	}
+	if len(history) != 2 || history[0].SecretName != "b" || history[1].SecretName != "c" {
+		t.Errorf("Expected the two most recent rotations oldest first, got %+v", history)
+	}
+
+	driver.history = nil
+	resp = adminGet(t, server, "/admin/history")
+	var empty []RotationRecord
+	if err := json.NewDecoder(resp.Body).Decode(&empty); err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("Expected an empty list with history disabled, got %v (%v)", empty, err)
+	}
+}
+
+func TestAdminAPIServesConfigWithCredentialsRedacted(t *testing.T) {
+	settings := newPluginSettings(map[string]string{
+		"VAULT_ADDR":        "https://vault:8200",
+		"VAULT_TOKEN":       "hvs.s3cret",
+		"VAULT_ADMIN_TOKEN": "s3cret",
+	})
+	settings.sources = map[string]string{"VAULT_ADDR": sourceFile, "VAULT_TOKEN": sourceEnv, "VAULT_ADMIN_TOKEN": sourceEnv}
+	config := mustLoadVaultConfig(t, settings)
+	driver := &VaultDriver{
+		config:        config,
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		configSources: settings.provenance(),
+		configValues:  settings.reportedValues(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	resp := adminGet(t, server, "/admin/config")
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "s3cret") {
+		t.Fatalf("Expected credentials to be redacted, got %s", body)
+	}
+	var settingsByKey map[string]ConfigSetting
+	if err := json.Unmarshal(body, &settingsByKey); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]ConfigSetting{
+		"VAULT_ADDR":        {Value: "https://vault:8200", Source: sourceFile},
+		"VAULT_TOKEN":       {Value: redactedValue, Source: sourceEnv},
+		"VAULT_ADMIN_TOKEN": {Value: redactedValue, Source: sourceEnv},
+		"VAULT_MOUNT_PATH":  {Value: "secret", Source: sourceDefault},
+		"VAULT_SECRET_ID":   {Value: "", Source: sourceDefault},
+	}
+	for key, setting := range expected {
+		if settingsByKey[key] != setting {
+			t.Errorf("Expected %s to be %+v, got %+v", key, setting, settingsByKey[key])
+		}
+	}
+}
+
+func TestAdminAPIResolvesSecretsWithoutValues(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "hunter2", "user": "app"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", AdminToken: "s3cret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+	resolve := func(body string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/resolve", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	tests := []struct {
+		req      secrets.Request
+		expected ResolveResult
+	}{
+		{
+			req:      secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}},
+			expected: ResolveResult{Exists: true, Fields: []string{"password"}},
+		},
+		{
+			req:      secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field_join": "user,password"}},
+			expected: ResolveResult{Exists: true, Fields: []string{"user", "password"}},
+		},
+		{
+			req:      secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "token"}},
+			expected: ResolveResult{Exists: true, Error: "field token not found in secret"},
+		},
+		{
+			req:      secrets.Request{SecretName: "db", ServiceName: "api"},
+			expected: ResolveResult{},
+		},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(map[string]interface{}{"secret": tt.req.SecretName, "service": tt.req.ServiceName, "labels": tt.req.SecretLabels})
+		status, response := resolve(string(body))
+		if status != http.StatusOK || strings.Contains(response, "hunter2") || strings.Contains(response, `"app"`) {
+			t.Fatalf("Expected a result without values for %s, got %d %s", body, status, response)
+		}
+		var result ResolveResult
+		if err := json.Unmarshal([]byte(response), &result); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tt.expected.Path = driver.buildSecretPath(tt.req)
+		if result.Path != tt.expected.Path || result.Exists != tt.expected.Exists || result.Error != tt.expected.Error ||
+			strings.Join(result.Fields, ",") != strings.Join(tt.expected.Fields, ",") {
+			t.Errorf("Expected %+v for %s, got %+v", tt.expected, body, result)
+		}
+	}
+
+	if status, _ := resolve(`{"secret": "db", "labels": {"vault_path": "../other"}}`); status != http.StatusBadRequest {
+		t.Errorf("Expected an invalid vault_path to be rejected, got %d", status)
+	}
+	if status, _ := resolve(`{"labels": {}}`); status != http.StatusBadRequest {
+		t.Errorf("Expected a missing secret name to be rejected, got %d", status)
+	}
+}
+
+func TestAdminAPIServesStatusLine(t *testing.T) {
+	start := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	driver := &VaultDriver{
+		config:        &VaultConfig{AdminToken: "s3cret"},
+		secretTracker: map[string]*SecretInfo{"db": {DockerSecretName: "db"}},
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+		started:       start,
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	clock.Advance(90 * time.Minute)
+	driver.metrics.inc(`vault_rotations_total{result="success"}`)
+	driver.metrics.inc(`vault_rotations_total{result="success"}`)
+	driver.metrics.inc(`vault_rotations_total{result="error"}`)
+	driver.recordGetOutcome(getResultSuccess)
+	driver.recordGetOutcome(getResultNotFound)
+	driver.recordGetOutcome(getResultBackendError)
+
+	resp := adminGet(t, server, "/admin/status")
+	body, _ := io.ReadAll(resp.Body)
+	expected := "healthy uptime=1h30m0s tracked=1 rotations=2 rotation_errors=1 get_errors=2\n"
+	if resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" || string(body) != expected {
+		t.Errorf("Expected %q as plain text, got %q (%s)", expected, body, resp.Header.Get("Content-Type"))
+	}
+
+	driver.degraded.Store(true)
+	body, _ = io.ReadAll(adminGet(t, server, "/admin/status").Body)
+	if !strings.HasPrefix(string(body), "degraded ") {
+		t.Errorf("Expected a degraded status, got %q", body)
+	}
+}
+
+func TestAdminAPIServesPrometheusMetrics(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", AdminToken: "s3cret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	driver.Get(secrets.Request{SecretName: "db"})
+	driver.setDegraded(false)
+
+	resp := adminGet(t, server, "/metrics")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != prometheusContentType {
+		t.Errorf("Expected the Prometheus text format, got %s", resp.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE vault_provider_request_duration_seconds histogram",
+		`vault_provider_request_duration_seconds_bucket{provider="vault",operation="get",le="+Inf"} 1`,
+		`vault_provider_request_duration_seconds_count{provider="vault",operation="get"} 1`,
+		"# TYPE vault_secret_requests_total counter",
+		`vault_secret_requests_total{result="success",provider="vault"} 1`,
+		"# TYPE vault_ready gauge",
+		"vault_ready 1",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, body)
+		}
+	}
+	if strings.Count(string(body), "# TYPE vault_provider_request_duration_seconds") != 1 {
+		t.Errorf("Expected the histogram series to be one family, got:\n%s", body)
+	}
+}
+
+func TestAdminAPINegotiatesMetricsFormat(t *testing.T) {
+	driver := &VaultDriver{
+		config:        &VaultConfig{AdminToken: "s3cret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	driver.metrics.inc("vault_admin_unauthorized_total")
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", prometheusContentType},
+		{"text/plain", prometheusContentType},
+		{"text/plain;version=0.0.4,*/*;q=0.1", prometheusContentType},
+		{"application/json", "application/json"},
+		{"application/json, text/plain;q=0.5", "application/json"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/metrics", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Accept", tt.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.Header.Get("Content-Type") != tt.contentType {
+			t.Errorf("Expected %s for Accept %q, got %s", tt.contentType, tt.accept, resp.Header.Get("Content-Type"))
+			continue
+		}
+		if tt.contentType == "application/json" {
+			var metrics map[string]float64
+			if err := json.Unmarshal(body, &metrics); err != nil || metrics["vault_admin_unauthorized_total"] != 1 {
+				t.Errorf("Expected the metrics as JSON, got %s (%v)", body, err)
+			}
+		} else if !strings.Contains(string(body), "vault_admin_unauthorized_total 1\n") {
+			t.Errorf("Expected the metrics as text, got %s", body)
+		}
+	}
+}
+
+func TestAdminAPIIndentsJSONWhenPretty(t *testing.T) {
+	driver := &VaultDriver{
+		config:        &VaultConfig{AdminToken: "s3cret"},
+		secretTracker: map[string]*SecretInfo{"db": {DockerSecretName: "db"}},
+		metrics:       newDriverMetrics(),
+		started:       time.Now(),
+	}
+	server := httptest.NewServer(driver.adminHandler())
+	defer server.Close()
+
+	body, _ := io.ReadAll(adminGet(t, server, "/health").Body)
+	var status DriverStatus
+	if err := json.Unmarshal(body, &status); err != nil || status.State != "healthy" || status.Tracked != 1 {
+		t.Fatalf("Expected a healthy status, got %s (%v)", body, err)
+	}
+	if strings.Contains(string(body), "\n ") {
+		t.Errorf("Expected compact JSON by default, got %s", body)
+	}
+	body, _ = io.ReadAll(adminGet(t, server, "/health?pretty=true").Body)
+	if !strings.Contains(string(body), "{\n  \"state\": \"healthy\",\n") {
+		t.Errorf("Expected indented JSON with pretty=true, got %s", body)
+	}
+
+	driver.degraded.Store(true)
+	if resp := adminGet(t, server, "/health"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a degraded driver to be unhealthy, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// AliasResult is the outcome of syncing one alias during a rotation
+type AliasResult struct {
+	Alias           string   `json:"alias"`
+	SecretName      string   `json:"secret,omitempty"` // Docker secret now holding the alias value
+	Success         bool     `json:"success"`
+	Error           string   `json:"error,omitempty"`
+	UpdatedServices []string `json:"updated_services,omitempty"`
+	FailedServices  []string `json:"failed_services,omitempty"`
+}
+
+// syncAliases rotates the given aliases of a tracked secret to newValue, so a
+// single Vault read keeps them all in sync. Aliases that don't exist yet are
+// created. Every alias is attempted and its outcome reported; failed ones are
+// kept in FailedAliases for the next sweep, and the error lists them.
+func (d *VaultDriver) syncAliases(secretInfo *SecretInfo, aliases []string, newValue []byte) ([]AliasResult, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	existing, err := d.listSecrets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	var results []AliasResult
+	var failed []string
+	for _, alias := range aliases {
+		result := AliasResult{Alias: alias}
+		d.trackerMutex.RLock()
+		currentName := secretInfo.AliasSecretNames[alias]
+		d.trackerMutex.RUnlock()
+		if currentName == "" {
+			currentName = alias
+		}
+
+		var newName string
+		if findCurrentSecret(existing, alias, currentName) == nil {
+			newName = alias
+			labels := map[string]string{secretAliasLabel: alias}
+			if secretInfo.ContentType != "" {
+				labels["vault_content_type"] = secretInfo.ContentType
+				labels[contentTypeLabel] = secretInfo.ContentType
+			}
+			_, err = d.dockerClient.SecretCreate(ctx, swarm.SecretSpec{
+				Annotations: swarm.Annotations{
+					Name:   alias,
+					Labels: labels,
+				},
+				Data: newValue,
+			})
+			if err == nil {
+				log.Printf("Created alias %s of secret %s", alias, secretInfo.DockerSecretName)
+			}
+		} else {
+			newName, _, result.UpdatedServices, err = d.updateDockerSecret(alias, currentName, secretInfo.ContentType, newValue)
+		}
+		if err != nil {
+			var updateErr *serviceUpdateError
+			if errors.As(err, &updateErr) {
+				result.UpdatedServices = updateErr.updated
+				result.FailedServices = updateErr.failed
+			}
+			log.Errorf("Failed to sync alias %s of secret %s: %v", alias, secretInfo.DockerSecretName, err)
+			d.metrics.inc(`vault_alias_syncs_total{result="error"}`)
+			result.Error = err.Error()
+			results = append(results, result)
+			failed = append(failed, alias)
+			d.trackerMutex.Lock()
+			if secretInfo.FailedAliases == nil {
+				secretInfo.FailedAliases = make(map[string]bool)
+			}
+			secretInfo.FailedAliases[alias] = true
+			d.trackerMutex.Unlock()
+			continue
+		}
+		d.metrics.inc(`vault_alias_syncs_total{result="success"}`)
+		result.SecretName = newName
+		result.Success = true
+		results = append(results, result)
+
+		d.trackerMutex.Lock()
+		if secretInfo.AliasSecretNames == nil {
+			secretInfo.AliasSecretNames = make(map[string]string)
+		}
+		secretInfo.AliasSecretNames[alias] = newName
+		delete(secretInfo.FailedAliases, alias)
+		d.trackerMutex.Unlock()
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("failed to sync aliases %v", failed)
+	}
+	return results, nil
+}
+
+// failedAliases returns the aliases of a secret whose last sync failed and
+// that are still listed in its vault_aliases label
+func (d *VaultDriver) failedAliases(secretInfo *SecretInfo) []string {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	var failed []string
+	for _, alias := range secretInfo.Aliases {
+		if secretInfo.FailedAliases[alias] {
+			failed = append(failed, alias)
+		}
+	}
+	return failed
+}
+
+// retryAliases syncs the aliases that failed during an earlier rotation of an
+// unchanged secret. The value is read again, and only synced while it is
+// still the one the secret itself holds.
+func (d *VaultDriver) retryAliases(secretInfo *SecretInfo) error {
+	aliases := d.failedAliases(secretInfo)
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.readTimeout(operationRotate))
+	defer cancel()
+	secret, _, err := d.sweepRead(ctx, operationRotate, secretInfo.VaultPath)
+	if err != nil {
+		return fmt.Errorf("failed to read secret from vault: %v", err)
+	}
+	if secret == nil {
+		return fmt.Errorf("secret not found at path: %s", secretInfo.VaultPath)
+	}
+	data, err := secretFields(secret)
+	if err != nil {
+		return err
+	}
+	value, err := d.trackedValue(secretInfo, data)
+	if err != nil {
+		return err
+	}
+	d.trackerMutex.RLock()
+	valueHash := secretInfo.ValueHash
+	d.trackerMutex.RUnlock()
+	if hashValue(d.config.HashAlgo, value) != valueHash {
+		return fmt.Errorf("value no longer matches secret %s, waiting for its rotation", secretInfo.DockerSecretName)
+	}
+
+	log.Printf("Retrying aliases %v of secret %s", aliases, secretInfo.DockerSecretName)
+	_, err = d.syncAliases(secretInfo, aliases, value)
+	return err
+}
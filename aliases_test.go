@@ -0,0 +1,216 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestParseList(t *testing.T) {
+	if aliases := parseList(" db_ro, db_admin ,,"); !reflect.DeepEqual(aliases, []string{"db_ro", "db_admin"}) {
+		t.Errorf("Unexpected aliases: %v", aliases)
+	}
+	if aliases := parseList(""); aliases != nil {
+		t.Errorf("Expected no aliases, got %v", aliases)
+	}
+}
+
+func TestRotationSyncsAliases(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "old"})
+
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addSecret("ro-id", "db_ro", nil)
+	fd.addService("svc-1", "web", "db")
+	fd.addService("svc-2", "reports", "db_ro")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_aliases": "db_ro,db_admin"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "new"})
+	reads := fv.readCount("secret/data/db")
+	secretInfo := driver.secretTracker["db"]
+	if _, err := driver.rotateSecret(secretInfo); err != nil {
+		t.Fatalf("Unexpected rotation error: %v", err)
+	}
+	if got := fv.readCount("secret/data/db") - reads; got != 1 {
+		t.Errorf("Expected a single vault read for all aliases, got %d", got)
+	}
+
+	// The existing alias is rotated and its service rewired
+	roName := secretInfo.AliasSecretNames["db_ro"]
+	if roName == "" || roName == "db_ro" {
+		t.Fatalf("Expected a new version of db_ro, got %q", roName)
+	}
+	if names := fd.serviceSecretNames("svc-2"); names[0] != roName {
+		t.Errorf("Expected reports to use %s, got %v", roName, names)
+	}
+	if created := fd.secretByName(roName); created == nil || string(created.Spec.Data) != "new" {
+		t.Errorf("Expected %s to hold the new value", roName)
+	}
+
+	// The missing alias is created
+	if created := fd.secretByName("db_admin"); created == nil || string(created.Spec.Data) != "new" {
+		t.Error("Expected missing alias db_admin to be created with the new value")
+	}
+	if names := fd.serviceSecretNames("svc-1"); names[0] != secretInfo.CurrentSecretName {
+		t.Errorf("Expected web to use %s, got %v", secretInfo.CurrentSecretName, names)
+	}
+}
+
+func TestContentTypeLabelOnCreatedSecrets(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "old"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_aliases": "db_env", "vault_content_type": "env"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "new"})
+	secretInfo := driver.secretTracker["db"]
+	if _, err := driver.rotateSecret(secretInfo); err != nil {
+		t.Fatalf("Unexpected rotation error: %v", err)
+	}
+	for _, name := range []string{secretInfo.CurrentSecretName, "db_env"} {
+		created := fd.secretByName(name)
+		if created == nil {
+			t.Fatalf("Expected secret %s to be created", name)
+		}
+		if created.Spec.Labels[contentTypeLabel] != "env" {
+			t.Errorf("Expected %s to carry content type env, got %v", name, created.Spec.Labels)
+		}
+	}
+}
+
+func TestRotationReportsAliasOutcomes(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "old"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addSecret("ro-id", "db_ro", nil)
+	fd.addService("svc-1", "web", "db")
+	fd.addService("svc-2", "reports", "db_ro")
+	fd.failUpdates("svc-2")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		history:       newRotationHistory(10),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_aliases": "db_ro,db_admin"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "new"})
+	result, err := driver.rotateSecret(driver.secretTracker["db"])
+	if err != nil {
+		t.Fatalf("Expected the rotation of the secret itself to succeed, got %v", err)
+	}
+	if result.NewSecretName == "" || !reflect.DeepEqual(result.UpdatedServices, []string{"web"}) {
+		t.Errorf("Expected the secret to be rotated for web, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.FailedAliases, []string{"db_ro"}) {
+		t.Errorf("Expected db_ro to be reported as failed, got %v", result.FailedAliases)
+	}
+
+	if len(result.Aliases) != 2 {
+		t.Fatalf("Expected an outcome per alias, got %+v", result.Aliases)
+	}
+	ro, admin := result.Aliases[0], result.Aliases[1]
+	if ro.Alias != "db_ro" || ro.Success || ro.Error == "" || !reflect.DeepEqual(ro.FailedServices, []string{"reports"}) {
+		t.Errorf("Expected db_ro to fail for reports, got %+v", ro)
+	}
+	if admin.Alias != "db_admin" || !admin.Success || admin.SecretName != "db_admin" {
+		t.Errorf("Expected db_admin to be created, got %+v", admin)
+	}
+
+	records := driver.RotationHistory()
+	if len(records) != 1 || !records[0].Success || !reflect.DeepEqual(records[0].Aliases, result.Aliases) || !reflect.DeepEqual(records[0].FailedAliases, []string{"db_ro"}) {
+		t.Errorf("Expected a successful rotation with the alias outcomes in the history, got %+v", records)
+	}
+	if got := driver.metrics.counter(`vault_rotations_total{result="success"}`); got != 1 {
+		t.Errorf("Expected the rotation to count as a success, got %v", got)
+	}
+	if got := driver.metrics.counter(`vault_alias_syncs_total{result="success"}`); got != 1 {
+		t.Errorf("Expected one successful alias sync, got %v", got)
+	}
+	if got := driver.metrics.counter(`vault_alias_syncs_total{result="error"}`); got != 1 {
+		t.Errorf("Expected one failed alias sync, got %v", got)
+	}
+}
+
+func TestFailedAliasRetriedBySweep(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "old"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addSecret("ro-id", "db_ro", nil)
+	fd.addService("svc-1", "web", "db")
+	fd.addService("svc-2", "reports", "db_ro")
+	fd.failUpdates("svc-2")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_aliases": "db_ro"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "new"})
+	summary := driver.checkForSecretChanges()
+	if summary.Rotated != 1 || summary.Failed != 0 || summary.AliasesFailed != 1 {
+		t.Fatalf("Expected the secret rotated and its alias failed, got %+v", summary)
+	}
+	if names := fd.serviceSecretNames("svc-2"); names[0] != "db_ro" {
+		t.Fatalf("Expected reports to stay on db_ro, got %v", names)
+	}
+
+	// The primary is unchanged, but the next sweep still syncs the alias
+	fd.allowUpdates("svc-2")
+	summary = driver.checkForSecretChanges()
+	if summary.Changed != 0 || summary.AliasesFailed != 0 {
+		t.Fatalf("Expected the alias to be synced without a change, got %+v", summary)
+	}
+	roName := driver.secretTracker["db"].AliasSecretNames["db_ro"]
+	if names := fd.serviceSecretNames("svc-2"); roName == "" || names[0] != roName {
+		t.Errorf("Expected reports to use the synced alias %q, got %v", roName, names)
+	}
+	if created := fd.secretByName(roName); created == nil || string(created.Spec.Data) != "new" {
+		t.Errorf("Expected %s to hold the new value", roName)
+	}
+	if failed := driver.failedAliases(driver.secretTracker["db"]); len(failed) != 0 {
+		t.Errorf("Expected no failed aliases, got %v", failed)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rotationModeManual is the vault_rotation_mode value that holds detected
+// changes until an admin approves them
+const rotationModeManual = "manual"
+
+// PendingRotation is a detected change of a manual-mode secret awaiting approval
+type PendingRotation struct {
+	SecretName string    `json:"secret"`
+	Since      time.Time `json:"since"` // when the change was first detected
+	Hash       string    `json:"hash"`  // prefix of the held change's hash
+}
+
+// holdRotation records a detected change of a manual-mode secret instead of
+// rotating it. A secret changing again while held replaces the held change.
+func (d *VaultDriver) holdRotation(secretInfo *SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if !secretInfo.PendingSince.IsZero() {
+		if secretInfo.HeldHash != secretInfo.CheckedHash {
+			secretInfo.HeldHash = secretInfo.CheckedHash
+			log.Printf("Secret %s changed again, the new change is waiting for manual approval", secretInfo.DockerSecretName)
+		}
+		return
+	}
+	secretInfo.PendingSince = d.now()
+	secretInfo.HeldHash = secretInfo.CheckedHash
+	d.metrics.inc("vault_rotations_pending_total")
+	log.Printf("Change in secret %s is waiting for manual approval", secretInfo.DockerSecretName)
+}
+
+// clearPending drops a pending change, e.g. after the value was reverted
+func (d *VaultDriver) clearPending(secretInfo *SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.PendingSince = time.Time{}
+	secretInfo.HeldHash = ""
+}
+
+// PendingRotations returns the changes awaiting approval, oldest first
+func (d *VaultDriver) PendingRotations() []PendingRotation {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	var pending []PendingRotation
+	for _, secretInfo := range d.secretTracker {
+		if !secretInfo.PendingSince.IsZero() {
+			pending = append(pending, PendingRotation{
+				SecretName: secretInfo.DockerSecretName,
+				Since:      secretInfo.PendingSince,
+				Hash:       hashPrefix(secretInfo.HeldHash),
+			})
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Since.Before(pending[j].Since) })
+	return pending
+}
+
+// ApproveRotation applies the pending change of a manual-mode secret. Only
+// the held change is applied: if Vault holds another value by now, nothing is
+// rotated and the next sweep holds the new change for approval instead.
+func (d *VaultDriver) ApproveRotation(secretName string) error {
+	d.rotationMutex.Lock()
+	defer d.rotationMutex.Unlock()
+
+	d.trackerMutex.RLock()
+	secretInfo, exists := d.secretTracker[secretName]
+	pending := exists && !secretInfo.PendingSince.IsZero()
+	var heldHash string
+	if pending {
+		heldHash = secretInfo.HeldHash
+	}
+	d.trackerMutex.RUnlock()
+	if !pending {
+		return fmt.Errorf("no pending rotation for secret %s", secretName)
+	}
+
+	log.Printf("Rotation of secret %s approved", secretName)
+	if _, err := d.rotate(secretInfo, false, heldHash); err != nil {
+		return err
+	}
+	d.clearPending(secretInfo)
+	d.clearBacklog(secretInfo)
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestManualRotationHeldUntilApproved(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		history:       newRotationHistory(10),
+	}
+	req := secrets.Request{SecretName: "db", ServiceName: "web", SecretLabels: map[string]string{"vault_path": "db", "vault_field": "password", "vault_rotation_mode": "manual"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	if err := driver.ApproveRotation("db"); err == nil {
+		t.Error("Expected an error approving a secret without a pending change")
+	}
+
+	// The change is detected but held, across several sweeps
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	driver.checkForSecretChanges()
+	if fd.called("POST /secrets/create") {
+		t.Fatal("Manual-mode secret must not be rotated without approval")
+	}
+	pending := driver.PendingRotations()
+	if len(pending) != 1 || pending[0].SecretName != "db" || pending[0].Since.IsZero() {
+		t.Fatalf("Expected db to be pending, got %+v", pending)
+	}
+	if count := driver.metrics.counter("vault_rotations_pending_total"); count != 1 {
+		t.Errorf("Expected the change to be counted once, got %v", count)
+	}
+
+	if err := driver.ApproveRotation("db"); err != nil {
+		t.Fatalf("Unexpected error approving rotation: %v", err)
+	}
+	if !fd.called("POST /services/svc-1/update") {
+		t.Error("Expected the approved rotation to update the service")
+	}
+	if pending := driver.PendingRotations(); len(pending) != 0 {
+		t.Errorf("Expected no pending rotations after approval, got %+v", pending)
+	}
+	if history := driver.RotationHistory(); len(history) != 1 || !history[0].Success {
+		t.Errorf("Expected a successful rotation in the history, got %+v", history)
+	}
+}
+
+func TestManualRotationRevertClearsPending(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_rotation_mode": "manual"}})
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	driver.checkForSecretChanges()
+	if pending := driver.PendingRotations(); len(pending) != 0 {
+		t.Errorf("Expected the reverted change to be dropped, got %+v", pending)
+	}
+}
+
+func TestManualRotationApprovesHeldValue(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", ServiceName: "web", SecretLabels: map[string]string{"vault_path": "db", "vault_field": "password", "vault_rotation_mode": "manual"}}
+	driver.Get(req)
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	// A task starting meanwhile is served v2, but that doesn't approve it
+	if resp := driver.Get(req); string(resp.Value) != "v2" {
+		t.Fatalf("Expected v2 to be served, got %q (%s)", resp.Value, resp.Err)
+	}
+	driver.checkForSecretChanges()
+	if pending := driver.PendingRotations(); len(pending) != 1 {
+		t.Fatalf("Expected the change to stay held after a request, got %+v", pending)
+	}
+
+	// Vault changes again before the approval: v2 was approved, not v3
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v3"})
+	if err := driver.ApproveRotation("db"); err == nil {
+		t.Fatal("Expected the approval to fail once the held value is gone")
+	}
+	if fd.called("POST /secrets/create") {
+		t.Fatal("Expected nothing to be rotated")
+	}
+
+	// The next sweep holds v3, which can then be approved
+	driver.checkForSecretChanges()
+	if err := driver.ApproveRotation("db"); err != nil {
+		t.Fatalf("Unexpected error approving rotation: %v", err)
+	}
+	current := fd.secretByName(driver.secretTracker["db"].CurrentSecretName)
+	if current == nil || string(current.Spec.Data) != "v3" {
+		t.Errorf("Expected the approved version to hold v3, got %+v", current)
+	}
+}
+
+func TestApprovalWaitsForRunningSweep(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fv.setKV2("secret/data/api", map[string]interface{}{"token": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addSecret("api-id", "api", nil)
+	fd.addService("svc-1", "web", "db", "api")
+
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			MountPath:      "secret",
+			EnableRotation: true,
+			// Keeps the sweep's rotation of api running while the approval arrives
+			PreRotationHook: `[ "$VAULT_SECRET_NAME" != api ] || sleep 0.3`,
+		},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		history:       newRotationHistory(10),
+	}
+	for _, req := range []secrets.Request{
+		{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_rotation_mode": "manual"}},
+		{SecretName: "api", SecretLabels: map[string]string{"vault_field": "token"}},
+	} {
+		if resp := driver.Get(req); resp.Err != "" {
+			t.Fatalf("Unexpected error: %s", resp.Err)
+		}
+	}
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	fv.setKV2("secret/data/api", map[string]interface{}{"token": "v2"})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	reads := fv.readCount("secret/data/api")
+	go func() {
+		defer wg.Done()
+		driver.sweep(time.Now())
+	}()
+	go func() {
+		defer wg.Done()
+		for fv.readCount("secret/data/api") == reads {
+			time.Sleep(time.Millisecond)
+		}
+		if err := driver.ApproveRotation("db"); err != nil {
+			t.Errorf("Unexpected error approving rotation: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	// The approved rotation only started once the sweep's rotation finished
+	var created []string
+	for _, secret := range fd.secrets {
+		if strings.HasPrefix(secret.Spec.Name, "db-") || strings.HasPrefix(secret.Spec.Name, "api-") {
+			created = append(created, secret.Spec.Name)
+		}
+	}
+	if len(created) != 2 || !strings.HasPrefix(created[0], "api-") || !strings.HasPrefix(created[1], "db-") {
+		t.Errorf("Expected the sweep's version of api before the approved version of db, got %v", created)
+	}
+	names := fd.serviceSecretNames("svc-1")
+	if len(names) != 2 || names[0] != driver.secretTracker["db"].CurrentSecretName || names[1] != driver.secretTracker["api"].CurrentSecretName {
+		t.Errorf("Expected web to use both current versions, got %v", names)
+	}
+}
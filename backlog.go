@@ -0,0 +1,48 @@
+package main
+
+import (
+	"time"
+)
+
+// markBacklog records that a detected change of a secret was not rotated,
+// keeping the time it was first seen
+func (d *VaultDriver) markBacklog(secretInfo *SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo.BacklogSince.IsZero() {
+		secretInfo.BacklogSince = d.now()
+	}
+}
+
+// clearBacklog drops a secret from the backlog once its change was rotated or
+// reverted
+func (d *VaultDriver) clearBacklog(secretInfo *SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.BacklogSince = time.Time{}
+}
+
+// recordBacklog exposes the number of detected but not yet rotated changes,
+// whether held, deferred or failed, and the age of the oldest one
+func (d *VaultDriver) recordBacklog() {
+	d.trackerMutex.RLock()
+	count := 0
+	var oldest time.Time
+	for _, secretInfo := range d.secretTracker {
+		if secretInfo.BacklogSince.IsZero() {
+			continue
+		}
+		count++
+		if oldest.IsZero() || secretInfo.BacklogSince.Before(oldest) {
+			oldest = secretInfo.BacklogSince
+		}
+	}
+	d.trackerMutex.RUnlock()
+
+	age := 0.0
+	if count > 0 {
+		age = d.now().Sub(oldest).Seconds()
+	}
+	d.metrics.setGauge("vault_rotation_backlog", float64(count))
+	d.metrics.setGauge("vault_rotation_backlog_oldest_seconds", age)
+}
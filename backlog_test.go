@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestBacklogTracksDeferredRotations(t *testing.T) {
+	fv := newFakeVault(t)
+	fd := newFakeDocker(t)
+	for _, name := range []string{"db", "api"} {
+		fv.setKV2("secret/data/"+name, map[string]interface{}{"password": "v1"})
+		fd.addSecret(name+"-id", name, nil)
+		fd.addService("svc-"+name, name+"-service", name)
+	}
+
+	clock := newFakeClock(time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			MountPath:       "secret",
+			EnableRotation:  true,
+			RotationWindows: testRotationWindows(t, "22:00-04:00"),
+		},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	for _, name := range []string{"db", "api"} {
+		req := secrets.Request{SecretName: name, SecretLabels: map[string]string{"vault_field": "password"}}
+		if resp := driver.Get(req); resp.Err != "" {
+			t.Fatalf("Unexpected error for %s: %s", name, resp.Err)
+		}
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	clock.Advance(30 * time.Minute)
+	fv.setKV2("secret/data/api", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	if backlog := driver.metrics.gauge("vault_rotation_backlog"); backlog != 2 {
+		t.Errorf("Expected 2 deferred rotations in the backlog, got %v", backlog)
+	}
+	if age := driver.metrics.gauge("vault_rotation_backlog_oldest_seconds"); age != 1800 {
+		t.Errorf("Expected the oldest change to be 1800s old, got %v", age)
+	}
+
+	// Inside the window both are rotated and the backlog drains
+	clock.Advance(11 * time.Hour)
+	driver.checkForSecretChanges()
+	if backlog := driver.metrics.gauge("vault_rotation_backlog"); backlog != 0 {
+		t.Errorf("Expected an empty backlog, got %v", backlog)
+	}
+	if age := driver.metrics.gauge("vault_rotation_backlog_oldest_seconds"); age != 0 {
+		t.Errorf("Expected no backlog age, got %v", age)
+	}
+}
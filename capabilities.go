@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkCapabilities logs the token's capabilities on each of the
+// VAULT_CHECK_PATHS and returns warnings for paths it can't read, so policy
+// mistakes surface at startup rather than on the first secret request
+func checkCapabilities(ctx context.Context, client *api.Client, paths []string) []string {
+	var warnings []string
+	for _, path := range paths {
+		capabilities, err := client.Sys().CapabilitiesSelfWithContext(ctx, path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("could not check capabilities on %s: %v", path, err))
+			continue
+		}
+		log.Printf("Vault token capabilities on %s: %s", path, strings.Join(capabilities, ","))
+		if !canRead(capabilities) {
+			warnings = append(warnings, fmt.Sprintf("vault token cannot read %s (capabilities: %s)", path, strings.Join(capabilities, ",")))
+		}
+	}
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+	return warnings
+}
+
+// canRead reports whether a capability list grants read access
+func canRead(capabilities []string) bool {
+	for _, capability := range capabilities {
+		if capability == "read" || capability == "root" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setCapabilities("secret/data/web/db", "read", "list")
+	fv.setCapabilities("secret/data/admin", "list")
+	fv.setCapabilities("database/creds/app", "root")
+	client := fv.client(t)
+	client.SetToken("test")
+
+	warnings := checkCapabilities(context.Background(), client, []string{"secret/data/web/db", "secret/data/admin", "database/creds/app", "kv/data/other"})
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "cannot read secret/data/admin (capabilities: list)") {
+		t.Errorf("Expected a warning for the list-only path, got %q", warnings[0])
+	}
+	if !strings.Contains(warnings[1], "cannot read kv/data/other (capabilities: deny)") {
+		t.Errorf("Expected a warning for the denied path, got %q", warnings[1])
+	}
+
+	fv.setStatus(503)
+	defer fv.setStatus(0)
+	if warnings := checkCapabilities(context.Background(), client, []string{"secret/data/web/db"}); len(warnings) != 1 || !strings.Contains(warnings[0], "could not check capabilities") {
+		t.Errorf("Expected a warning when the check fails, got %v", warnings)
+	}
+}
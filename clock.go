@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+)
+
+// Clock is the driver's source of time. Tests inject a fake clock to drive
+// the monitor and rotation timing without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is the default Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+// realTicker adapts time.Ticker to the Ticker interface
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+
+func (t realTicker) Stop() { t.ticker.Stop() }
+
+// clockOrDefault returns the driver's clock, falling back to real time
+func (d *VaultDriver) clockOrDefault() Clock {
+	if d.clock == nil {
+		return realClock{}
+	}
+	return d.clock
+}
+
+// now returns the current time from the driver's clock
+func (d *VaultDriver) now() time.Time {
+	return d.clockOrDefault().Now()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// fakeClock is a manually advanced Clock. Ticks are delivered synchronously,
+// so Advance returns only once the monitor has received them.
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	created chan struct{} // signalled whenever a ticker is created
+}
+
+type fakeTicker struct {
+	clock    *fakeClock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+	stopped  bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.stopped = true
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, created: make(chan struct{}, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ticker := &fakeTicker{clock: c, c: make(chan time.Time), interval: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, ticker)
+	c.created <- struct{}{}
+	return ticker
+}
+
+// Advance moves the clock forward and delivers the ticks that became due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	var due []*fakeTicker
+	for _, ticker := range c.tickers {
+		if !ticker.stopped && !now.Before(ticker.next) {
+			ticker.next = now.Add(ticker.interval)
+			due = append(due, ticker)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, ticker := range due {
+		ticker.c <- now
+	}
+}
+
+func TestMonitorRotatesWithFakeClock(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	monitorCtx, monitorCancel := context.WithCancel(context.Background())
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, RotationInterval: time.Minute},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		monitorCtx:    monitorCtx,
+		monitorCancel: monitorCancel,
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		driver.startMonitoring()
+		close(done)
+	}()
+	<-clock.created
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+
+	// Not yet due
+	clock.Advance(30 * time.Second)
+	// Due: the monitor receives the tick, and finishes the rotation before
+	// it sees the cancellation
+	clock.Advance(30 * time.Second)
+	monitorCancel()
+	<-done
+
+	rotatedAt := start.Add(time.Minute)
+	expected := fmt.Sprintf("db-%d", rotatedAt.Unix())
+	if fd.secretByName(expected) == nil {
+		t.Fatalf("Expected rotated secret %s, got calls %v", expected, fd.recordedCalls())
+	}
+	secretInfo := driver.secretTracker["db"]
+	if secretInfo.CurrentSecretName != expected || !secretInfo.LastUpdated.Equal(rotatedAt) {
+		t.Errorf("Expected rotation to %s at %v, got %s at %v", expected, rotatedAt, secretInfo.CurrentSecretName, secretInfo.LastUpdated)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultSettingsFile is read for plugin settings when VAULT_SETTINGS_FILE is not set
+const defaultSettingsFile = "/etc/vault-secrets-plugin/settings.env"
+
+// vaultAPISettings are read by the Vault API client itself and are not unknown
+var vaultAPISettings = map[string]bool{
+	"VAULT_CAPATH":            true,
+	"VAULT_CLIENT_TIMEOUT":    true,
+	"VAULT_MAX_RETRIES":       true,
+	"VAULT_NAMESPACE":         true,
+	"VAULT_RATE_LIMIT":        true,
+	"VAULT_SKIP_VERIFY":       true,
+	"VAULT_SRV_LOOKUP":        true,
+	"VAULT_TLS_SERVER_NAME":   true,
+	"VAULT_AGENT_ADDR":        true,
+	"VAULT_HTTP_PROXY":        true,
+	"VAULT_PROXY_ADDR":        true,
+	"VAULT_DISABLE_REDIRECTS": true,
+}
+
+// Sources a setting's value can come from
+const (
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+)
+
+// pluginSettings holds the raw key/value settings the plugin was started with
+// and remembers which keys were consumed while building the configuration
+type pluginSettings struct {
+	values   map[string]string
+	sources  map[string]string // where each value came from, env when unset
+	used     map[string]bool
+	resolved map[string]string // what each consumed key resolved to, defaults included
+}
+
+// newPluginSettings wraps a settings map
+func newPluginSettings(values map[string]string) *pluginSettings {
+	return &pluginSettings{
+		values:   values,
+		sources:  make(map[string]string),
+		used:     make(map[string]bool),
+		resolved: make(map[string]string),
+	}
+}
+
+// loadPluginSettings collects settings from the optional settings file and the
+// process environment. Docker passes values set with `docker plugin set` as
+// environment variables, which take precedence over the file.
+func loadPluginSettings() (*pluginSettings, error) {
+	values := make(map[string]string)
+	sources := make(map[string]string)
+
+	path := os.Getenv("VAULT_SETTINGS_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = defaultSettingsFile
+	}
+	fileValues, err := readSettingsFile(path)
+	if err != nil && (explicit || !os.IsNotExist(err)) {
+		return nil, fmt.Errorf("failed to read settings file %s: %v", path, err)
+	}
+	for k, v := range fileValues {
+		values[k] = v
+		sources[k] = sourceFile
+	}
+
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && v != "" {
+			values[k] = v
+			sources[k] = sourceEnv
+		}
+	}
+
+	settings := newPluginSettings(values)
+	settings.sources = sources
+	return settings, nil
+}
+
+// readSettingsFile parses KEY=VALUE lines, ignoring blank lines and # comments
+func readSettingsFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// get returns the setting value or the default when unset
+func (s *pluginSettings) get(key, defaultValue string) string {
+	s.used[key] = true
+	value := s.values[key]
+	if value == "" {
+		value = defaultValue
+	}
+	s.resolved[key] = value
+	return value
+}
+
+// unknownKeys returns VAULT_* settings that were provided but never consumed
+func (s *pluginSettings) unknownKeys() []string {
+	var unknown []string
+	for key := range s.values {
+		if strings.HasPrefix(key, "VAULT_") && !s.used[key] && !vaultAPISettings[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// provenance returns, for every setting consumed so far, whether its value
+// came from the environment, the settings file or the built-in default
+func (s *pluginSettings) provenance() map[string]string {
+	result := make(map[string]string, len(s.used))
+	for key := range s.used {
+		switch {
+		case s.values[key] == "":
+			result[key] = sourceDefault
+		case s.sources[key] != "":
+			result[key] = s.sources[key]
+		default:
+			result[key] = sourceEnv
+		}
+	}
+	return result
+}
+
+// redactedSettings are credentials whose values are never reported
+var redactedSettings = map[string]bool{
+	"VAULT_TOKEN":       true,
+	"VAULT_ROLE_ID":     true,
+	"VAULT_SECRET_ID":   true,
+	"VAULT_ADMIN_TOKEN": true,
+}
+
+// redactedValue stands in for a credential that is set
+const redactedValue = "<redacted>"
+
+// reportedValues returns what every setting consumed so far resolved to, with
+// credentials replaced by redactedValue. Unset credentials stay empty.
+func (s *pluginSettings) reportedValues() map[string]string {
+	result := make(map[string]string, len(s.resolved))
+	for key, value := range s.resolved {
+		if redactedSettings[key] && value != "" {
+			value = redactedValue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// parseFieldSet parses a comma-separated list of field names into a set
+func parseFieldSet(value string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, field := range parseList(value) {
+		fields[field] = true
+	}
+	return fields
+}
+
+// validateConfig rejects configurations the plugin can't start with. There
+// are no defaults for the Vault address and token, so they must be set.
+func validateConfig(config *VaultConfig) error {
+	var missing []string
+	if config.Address == "" {
+		missing = append(missing, "VAULT_ADDR")
+	}
+	if config.AuthMethod == "token" && config.Token == "" {
+		missing = append(missing, "VAULT_TOKEN")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+	// Tickers panic on non-positive intervals
+	if config.EnableRotation && config.RotationInterval <= 0 {
+		return fmt.Errorf("VAULT_ROTATION_INTERVAL must be positive, got %v", config.RotationInterval)
+	}
+	if config.MetricsExport != "" && config.ExportInterval <= 0 {
+		return fmt.Errorf("VAULT_METRICS_EXPORT_INTERVAL must be positive, got %v", config.ExportInterval)
+	}
+	if config.AdminAddr != "" && config.AdminToken == "" {
+		return fmt.Errorf("VAULT_ADMIN_TOKEN is required when VAULT_ADMIN_ADDR is set")
+	}
+	return nil
+}
+
+// loadVaultConfig builds the driver configuration from plugin settings. Most
+// invalid values fall back to their default, those that can't are errors.
+func loadVaultConfig(s *pluginSettings) (*VaultConfig, error) {
+	s.get("VAULT_SETTINGS_FILE", "")
+
+	rotationWindows, err := parseRotationWindows(s.get("VAULT_ROTATION_WINDOWS", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &VaultConfig{
+		Address:           s.get("VAULT_ADDR", ""),
+		SecondaryAddress:  s.get("VAULT_ADDR_SECONDARY", ""),
+		Token:             s.get("VAULT_TOKEN", ""),
+		MountPath:         s.get("VAULT_MOUNT_PATH", "secret"),
+		RoleID:            s.get("VAULT_ROLE_ID", ""),
+		SecretID:          s.get("VAULT_SECRET_ID", ""),
+		AuthMethod:        s.get("VAULT_AUTH_METHOD", "token"),
+		CACert:            s.get("VAULT_CACERT", ""),
+		ClientCert:        s.get("VAULT_CLIENT_CERT", ""),
+		ClientKey:         s.get("VAULT_CLIENT_KEY", ""),
+		TLSPinSHA256:      s.get("VAULT_TLS_PIN_SHA256", ""),
+		TLSPinSecondary:   s.get("VAULT_TLS_PIN_SHA256_SECONDARY", ""),
+		EnableRotation:    s.get("VAULT_ENABLE_ROTATION", "true") == "true",
+		RotationInterval:  parseDurationOrDefault(s.get("VAULT_ROTATION_INTERVAL", "10s"), 10*time.Second),
+		SecretNamePrefix:  s.get("VAULT_SECRET_NAME_PREFIX", ""),
+		SecretNameSuffix:  s.get("VAULT_SECRET_NAME_SUFFIX", ""),
+		RequireConsumers:  s.get("VAULT_ROTATION_REQUIRE_CONSUMERS", "false") == "true",
+		KeepOldSecrets:    s.get("VAULT_ROTATION_KEEP_OLD", "false") == "true",
+		RotationPartial:   parsePartialMode(s.get("VAULT_ROTATION_PARTIAL", partialAbort)),
+		HashAlgo:          parseHashAlgo(s.get("VAULT_HASH_ALGO", hashSHA256)),
+		AllowedLabels:     parseAllowedLabels(s.get("VAULT_ALLOWED_LABELS", "")),
+		ExcludeFields:     parseFieldSet(s.get("VAULT_EXCLUDE_FIELDS", "")),
+		CheckPaths:        parseList(s.get("VAULT_CHECK_PATHS", "")),
+		RotateCron:        s.get("VAULT_ROTATE_CRON", ""),
+		RejectBlank:       s.get("VAULT_REJECT_BLANK", "false") == "true",
+		ReconcileDangling: s.get("VAULT_RECONCILE_DANGLING", "false") == "true",
+		SweepOnStart:      s.get("VAULT_SWEEP_ON_START", "true") == "true",
+		PreRotationHook:   s.get("VAULT_ROTATION_PRE_HOOK", ""),
+		PostRotationHook:  s.get("VAULT_ROTATION_POST_HOOK", ""),
+		HookTimeout:       parseDurationOrDefault(s.get("VAULT_ROTATION_HOOK_TIMEOUT", "30s"), 30*time.Second),
+		LogSampleRate:     parseIntOrDefault(s.get("VAULT_LOG_SAMPLE_RATE", "1"), 1),
+		HistorySize:       parseIntOrDefault(s.get("VAULT_ROTATION_HISTORY_SIZE", "50"), 50),
+		MaxTrackedSecrets: parseIntOrDefault(s.get("VAULT_MAX_TRACKED_SECRETS", "0"), 0),
+		ListRetries:       parseIntOrDefault(s.get("VAULT_DOCKER_LIST_RETRIES", "3"), 3),
+		ListRetryBackoff:  parseDurationOrDefault(s.get("VAULT_DOCKER_LIST_BACKOFF", "500ms"), 500*time.Millisecond),
+		MaxRetryAfter:     parseDurationOrDefault(s.get("VAULT_MAX_RETRY_AFTER", "30s"), 30*time.Second),
+		MemSoftLimit:      parseByteSize(s.get("VAULT_MEM_SOFT_LIMIT", "")),
+		MemShedLoad:       s.get("VAULT_MEM_SHED_LOAD", "false") == "true",
+		RotationWindows:   rotationWindows,
+		RotationLocation:  parseLocation(s.get("VAULT_ROTATION_TIMEZONE", "UTC")),
+		UpdatesPerMinute:  parseIntOrDefault(s.get("VAULT_SERVICE_UPDATES_PER_MINUTE", "0"), 0),
+		RollbackTTL:       parseDurationOrDefault(s.get("VAULT_ROLLBACK_TTL", "0s"), 0),
+		InitFailure:       parseInitFailure(s.get("VAULT_INIT_FAILURE", initFailureFail)),
+		EmptyTrackerWarn:  parseDurationOrDefault(s.get("VAULT_EMPTY_TRACKER_WARN", "1h"), time.Hour),
+		LabelConflict:     parseConflictMode(s.get("VAULT_LABEL_CONFLICT", conflictWarn)),
+		FallbackPolicy:    parseExtractionFallback(s.get("VAULT_EXTRACTION_FALLBACK", fallbackFirstString)),
+		MetricsExport:     s.get("VAULT_METRICS_EXPORT_PATH", ""),
+		ExportInterval:    parseDurationOrDefault(s.get("VAULT_METRICS_EXPORT_INTERVAL", "5m"), 5*time.Minute),
+		ExportMaxBytes:    int64(parseIntOrDefault(s.get("VAULT_METRICS_EXPORT_MAX_BYTES", "10485760"), 10485760)),
+		UpdateOrder:       parseUpdateOrder(s.get("VAULT_SERVICE_UPDATE_ORDER", updateOrderAlphabetical)),
+		NegativeCacheTTL:  parseDurationOrDefault(s.get("VAULT_NEGATIVE_CACHE_TTL", "0s"), 0),
+		MaxLabels:         parseIntOrDefault(s.get("VAULT_MAX_LABELS", "100"), 100),
+		ReconcileServices: s.get("VAULT_RECONCILE_SERVICES", "true") == "true",
+		GetTimeout:        parseDurationOrDefault(s.get("VAULT_GET_TIMEOUT", "30s"), 30*time.Second),
+		CheckTimeout:      parseDurationOrDefault(s.get("VAULT_CHECK_TIMEOUT", "30s"), 30*time.Second),
+		RotateTimeout:     parseDurationOrDefault(s.get("VAULT_ROTATE_TIMEOUT", "30s"), 30*time.Second),
+		LowPriorityEvery:  parseIntOrDefault(s.get("VAULT_LOW_PRIORITY_EVERY", "1"), 1),
+		AdminAddr:         s.get("VAULT_ADMIN_ADDR", ""),
+		AdminToken:        s.get("VAULT_ADMIN_TOKEN", ""),
+	}, nil
+}
+
+// ConfigSources reports, for each plugin setting, whether the running
+// configuration took it from the environment, the settings file or a default
+func (d *VaultDriver) ConfigSources() map[string]string {
+	sources := make(map[string]string, len(d.configSources))
+	for key, source := range d.configSources {
+		sources[key] = source
+	}
+	return sources
+}
+
+// ConfigSetting is a plugin setting as served by the admin API
+type ConfigSetting struct {
+	Value  string `json:"value"` // credentials are redacted
+	Source string `json:"source"`
+}
+
+// ConfigSettings reports the value and source of each plugin setting the
+// running configuration was built from, never revealing credentials
+func (d *VaultDriver) ConfigSettings() map[string]ConfigSetting {
+	settings := make(map[string]ConfigSetting, len(d.configSources))
+	for key, source := range d.configSources {
+		settings[key] = ConfigSetting{Value: d.configValues[key], Source: source}
+	}
+	return settings
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadVaultConfigFromSettings(t *testing.T) {
+	settings := newPluginSettings(map[string]string{
+		"VAULT_ADDR":              "https://vault.internal:8200",
+		"VAULT_AUTH_METHOD":       "approle",
+		"VAULT_ROLE_ID":           "role",
+		"VAULT_SECRET_ID":         "secret-id",
+		"VAULT_ENABLE_ROTATION":   "false",
+		"VAULT_ROTATION_INTERVAL": "2m",
+		"VAULT_NAMESPACE":         "team-a",
+		"VAULT_ROTATON_INTERVAL":  "1m",
+		"PATH":                    "/usr/bin",
+	})
+
+	config := mustLoadVaultConfig(t, settings)
+
+	if config.Address != "https://vault.internal:8200" {
+		t.Errorf("Expected address from settings, got %s", config.Address)
+	}
+	if config.AuthMethod != "approle" || config.RoleID != "role" || config.SecretID != "secret-id" {
+		t.Errorf("Expected approle settings to be applied, got %+v", config)
+	}
+	if config.EnableRotation {
+		t.Error("Expected rotation to be disabled")
+	}
+	if config.RotationInterval != 2*time.Minute {
+		t.Errorf("Expected rotation interval 2m, got %v", config.RotationInterval)
+	}
+	if config.MountPath != "secret" {
+		t.Errorf("Expected default mount path, got %s", config.MountPath)
+	}
+
+	// Typos are reported, Vault API client settings and non-plugin keys are not
+	unknown := settings.unknownKeys()
+	if !reflect.DeepEqual(unknown, []string{"VAULT_ROTATON_INTERVAL"}) {
+		t.Errorf("Expected only the misspelled key to be unknown, got %v", unknown)
+	}
+}
+
+func TestValidateConfigRequiresAddressAndToken(t *testing.T) {
+	config := mustLoadVaultConfig(t, newPluginSettings(map[string]string{}))
+	if config.Address != "" || config.Token != "" {
+		t.Fatalf("Expected no default address or token, got %q and %q", config.Address, config.Token)
+	}
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "VAULT_ADDR, VAULT_TOKEN") {
+		t.Errorf("Expected address and token to be reported missing, got %v", err)
+	}
+
+	// Other authentication methods don't need a token
+	config = mustLoadVaultConfig(t, newPluginSettings(map[string]string{"VAULT_ADDR": "https://vault:8200", "VAULT_AUTH_METHOD": "approle"}))
+	if err := validateConfig(config); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateConfigRejectsNonPositiveIntervals(t *testing.T) {
+	for key, value := range map[string]string{"VAULT_ROTATION_INTERVAL": "0", "VAULT_METRICS_EXPORT_INTERVAL": "0s"} {
+		config := mustLoadVaultConfig(t, newPluginSettings(map[string]string{
+			"VAULT_ADDR":                "https://vault:8200",
+			"VAULT_TOKEN":               "token",
+			"VAULT_METRICS_EXPORT_PATH": "/tmp/metrics.jsonl",
+			key:                         value,
+		}))
+		if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s=%s to be rejected, got %v", key, value, err)
+		}
+	}
+
+	// The admin API can't be served without a token
+	config := mustLoadVaultConfig(t, newPluginSettings(map[string]string{"VAULT_ADDR": "https://vault:8200", "VAULT_TOKEN": "token", "VAULT_ADMIN_ADDR": "127.0.0.1:9095"}))
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "VAULT_ADMIN_TOKEN") {
+		t.Errorf("Expected a missing admin token to be rejected, got %v", err)
+	}
+
+	// A typo falls back to the setting's own default, not a shared one
+	config = mustLoadVaultConfig(t, newPluginSettings(map[string]string{"VAULT_ROTATION_INTERVAL": "10 fortnights", "VAULT_GET_TIMEOUT": "soon"}))
+	if config.RotationInterval != 10*time.Second || config.GetTimeout != 30*time.Second {
+		t.Errorf("Expected per-setting defaults, got %v and %v", config.RotationInterval, config.GetTimeout)
+	}
+}
+
+func TestReadSettingsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.env")
+	content := "# plugin settings\nVAULT_ADDR=https://vault:8200\n\nVAULT_MOUNT_PATH = \"kv\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readSettingsFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"VAULT_ADDR": "https://vault:8200", "VAULT_MOUNT_PATH": "kv"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if err := os.WriteFile(path, []byte("not a setting\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSettingsFile(path); err == nil {
+		t.Error("Expected error for malformed line")
+	}
+}
+
+func TestSettingsProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.env")
+	if err := os.WriteFile(path, []byte("VAULT_MOUNT_PATH=kv\nVAULT_ADDR=https://file:8200\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_SETTINGS_FILE", path)
+	t.Setenv("VAULT_ADDR", "https://env:8200")
+	t.Setenv("VAULT_AUTH_METHOD", "")
+
+	settings, err := loadPluginSettings()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config := mustLoadVaultConfig(t, settings)
+	if config.Address != "https://env:8200" {
+		t.Errorf("Expected the environment to override the file, got %s", config.Address)
+	}
+
+	sources := settings.provenance()
+	expected := map[string]string{
+		"VAULT_ADDR":          sourceEnv,
+		"VAULT_MOUNT_PATH":    sourceFile,
+		"VAULT_AUTH_METHOD":   sourceDefault,
+		"VAULT_SETTINGS_FILE": sourceEnv,
+	}
+	for key, source := range expected {
+		if sources[key] != source {
+			t.Errorf("Expected %s from %s, got %q", key, source, sources[key])
+		}
+	}
+	if _, ok := sources["PATH"]; ok {
+		t.Error("Expected only plugin settings to be reported")
+	}
+}
+
+// mustLoadVaultConfig loads a configuration that is expected to be valid
+func mustLoadVaultConfig(t *testing.T, settings *pluginSettings) *VaultConfig {
+	t.Helper()
+	config, err := loadVaultConfig(settings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return config
+}
+
+func TestLoadVaultConfigRejectsInvalidWindows(t *testing.T) {
+	if _, err := loadVaultConfig(newPluginSettings(map[string]string{"VAULT_ROTATION_WINDOWS": "22:00-04:00,bogus"})); err == nil || !strings.Contains(err.Error(), "VAULT_ROTATION_WINDOWS") {
+		t.Errorf("Expected invalid rotation windows to be rejected, got %v", err)
+	}
+}
+
+func TestConfigJSONDeclaresSettings(t *testing.T) {
+	raw, err := os.ReadFile("config.json")
+	if err != nil {
+		t.Fatalf("Failed to read config.json: %v", err)
+	}
+	var manifest struct {
+		Env []struct {
+			Name     string   `json:"name"`
+			Settable []string `json:"settable"`
+		} `json:"env"`
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		t.Fatalf("Failed to parse config.json: %v", err)
+	}
+	declared := make(map[string]bool)
+	for _, env := range manifest.Env {
+		declared[env.Name] = reflect.DeepEqual(env.Settable, []string{"value"})
+	}
+
+	// docker plugin set rejects keys the manifest doesn't declare settable
+	settings := newPluginSettings(map[string]string{})
+	mustLoadVaultConfig(t, settings)
+	for key := range settings.used {
+		if !declared[key] {
+			t.Errorf("Setting %s is not declared settable in config.json", key)
+		}
+	}
+}
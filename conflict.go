@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// Behaviours for VAULT_LABEL_CONFLICT when services request the same Docker
+// secret with labels selecting different values
+const (
+	conflictWarn  = "warn"  // log and serve the request
+	conflictError = "error" // refuse the conflicting request
+)
+
+// parseConflictMode validates a VAULT_LABEL_CONFLICT value, defaulting to warn
+func parseConflictMode(value string) string {
+	mode := strings.ToLower(strings.TrimSpace(value))
+	switch mode {
+	case conflictWarn, conflictError:
+		return mode
+	}
+	log.Warnf("Invalid label conflict mode %q, using %s", value, conflictWarn)
+	return conflictWarn
+}
+
+// describeSelection summarizes what a tracked secret reads from Vault
+func describeSelection(path, field string, joinFields []string, pemBundle bool, jsonPath, format string) string {
+	if field == "" {
+		field = "default"
+	}
+	selection := fmt.Sprintf("path=%s field=%s", path, field)
+	if len(joinFields) > 0 {
+		kind := "join"
+		if pemBundle {
+			kind = "pem_bundle"
+		}
+		selection += fmt.Sprintf(" %s=%s", kind, strings.Join(joinFields, ","))
+	}
+	if jsonPath != "" {
+		selection += " json_field=" + jsonPath
+	}
+	if format != "" {
+		selection += " format=" + format
+	}
+	return selection
+}
+
+// requestSelection describes what a request reads, resolved the same way
+// trackSecret does
+func requestSelection(req secrets.Request, path string) string {
+	field, _ := resolveVaultField(req)
+	joinFields, _ := parseFieldJoin(req)
+	pemBundle := false
+	if fields := parseList(req.SecretLabels["vault_pem_bundle"]); fields != nil {
+		joinFields, pemBundle = fields, true
+	}
+	format, _ := parseFormat(req.SecretLabels["vault_format"])
+	return describeSelection(path, field, joinFields, pemBundle, req.SecretLabels["vault_json_field"], format)
+}
+
+// checkLabelConflict compares a request with the tracked selection of the same
+// Docker secret from other services. The tracker holds one selection per
+// secret and a rotation moves every service using the secret to the new
+// version, so services selecting different values, e.g. through a templated
+// field or a default path including the service name, can't share it: the
+// secret is no longer rotated. It reports whether
+// the request conflicts, and an error when it must be refused.
+func (d *VaultDriver) checkLabelConflict(req secrets.Request, path string) (bool, error) {
+	d.trackerMutex.RLock()
+	if d.conflicting[req.SecretName] {
+		d.trackerMutex.RUnlock()
+		return true, nil
+	}
+	existing, exists := d.secretTracker[req.SecretName]
+	var tracked string
+	var services []string
+	if exists {
+		tracked = describeSelection(existing.VaultPath, existing.VaultField, existing.JoinFields, existing.PEMBundle, existing.JSONPath, existing.Format)
+		for _, service := range existing.ServiceNames {
+			if service != req.ServiceName && service != "" {
+				services = append(services, service)
+			}
+		}
+	}
+	d.trackerMutex.RUnlock()
+
+	requested := requestSelection(req, path)
+	if !exists || len(services) == 0 || requested == tracked {
+		return false, nil
+	}
+
+	d.metrics.inc("vault_label_conflicts_total")
+	err := fmt.Errorf("secret %s is tracked with %s for services %v, but service %s requested %s",
+		req.SecretName, tracked, services, req.ServiceName, requested)
+	d.stopTracking(req.SecretName)
+	if d.config.LabelConflict == conflictError {
+		log.Warnf("No longer rotating secret %s after a conflicting request", req.SecretName)
+		return true, err
+	}
+	log.Warnf("Conflicting labels: %v; serving it, but no longer rotating secret %s", err, req.SecretName)
+	return true, nil
+}
+
+// stopTracking drops a secret from the tracker for good, so it is neither
+// rotated nor tracked again by later requests
+func (d *VaultDriver) stopTracking(secretName string) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo, exists := d.secretTracker[secretName]; exists {
+		delete(d.secretTracker, secretName)
+		d.clearTrackedInfo(secretInfo)
+	}
+	if d.conflicting == nil {
+		d.conflicting = make(map[string]bool)
+	}
+	d.conflicting[secretName] = true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestLabelConflict(t *testing.T) {
+	for _, mode := range []string{conflictWarn, conflictError} {
+		t.Run(mode, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.setKV2("secret/data/db", map[string]interface{}{"password": "p", "username": "u"})
+			driver := &VaultDriver{
+				client:        fv.client(t),
+				config:        &VaultConfig{MountPath: "secret", EnableRotation: true, LabelConflict: mode},
+				secretTracker: make(map[string]*SecretInfo),
+				metrics:       newDriverMetrics(),
+			}
+			request := func(service, field string) secrets.Response {
+				return driver.Get(secrets.Request{SecretName: "db", ServiceName: service,
+					SecretLabels: map[string]string{"vault_path": "db", "vault_field": field}})
+			}
+
+			if resp := request("web", "password"); resp.Err != "" {
+				t.Fatalf("Unexpected error: %s", resp.Err)
+			}
+			// The same selection from another service is not a conflict
+			if resp := request("worker", "password"); resp.Err != "" {
+				t.Fatalf("Unexpected error: %s", resp.Err)
+			}
+			if count := driver.metrics.counter("vault_label_conflicts_total"); count != 0 {
+				t.Fatalf("Expected no conflict for matching labels, got %v", count)
+			}
+
+			resp := request("api", "username")
+			if count := driver.metrics.counter("vault_label_conflicts_total"); count != 1 {
+				t.Errorf("Expected 1 conflict, got %v", count)
+			}
+			switch mode {
+			case conflictWarn:
+				if resp.Err != "" || string(resp.Value) != "u" {
+					t.Errorf("Expected the request to be served, got %q (%s)", resp.Value, resp.Err)
+				}
+			case conflictError:
+				if !strings.Contains(resp.Err, "field=password") || !strings.Contains(resp.Err, "field=username") {
+					t.Errorf("Expected the conflicting request to be refused, got %q", resp.Err)
+				}
+			}
+			// A rotation updates every service using the secret, so rotating
+			// either selection would hand it to the other service. The secret
+			// is no longer tracked, even by matching requests.
+			request("web", "password")
+			if _, tracked := driver.secretTracker["db"]; tracked {
+				t.Error("Expected the conflicting secret to no longer be tracked")
+			}
+		})
+	}
+}
+
+func TestLabelConflictPerServicePaths(t *testing.T) {
+	for _, mode := range []string{conflictWarn, conflictError} {
+		t.Run(mode, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.setKV2("secret/data/web/db", map[string]interface{}{"value": "w"})
+			fv.setKV2("secret/data/api/db", map[string]interface{}{"value": "a"})
+			driver := &VaultDriver{
+				client:        fv.client(t),
+				config:        &VaultConfig{MountPath: "secret", EnableRotation: true, LabelConflict: mode},
+				secretTracker: make(map[string]*SecretInfo),
+				metrics:       newDriverMetrics(),
+			}
+			// Default paths include the service name, so one Docker secret
+			// holds a different value for each service
+			if resp := driver.Get(secrets.Request{SecretName: "db", ServiceName: "web"}); resp.Err != "" {
+				t.Fatalf("Unexpected error: %s", resp.Err)
+			}
+			resp := driver.Get(secrets.Request{SecretName: "db", ServiceName: "api"})
+			if count := driver.metrics.counter("vault_label_conflicts_total"); count != 1 {
+				t.Errorf("Expected default per-service paths to conflict, got %v", count)
+			}
+			if mode == conflictError && !strings.Contains(resp.Err, "path=secret/data/api/db") {
+				t.Errorf("Expected the request to be refused, got %q", resp.Err)
+			}
+			if mode == conflictWarn && string(resp.Value) != "a" {
+				t.Errorf("Expected api's own value, got %q (%s)", resp.Value, resp.Err)
+			}
+			if _, tracked := driver.secretTracker["db"]; tracked {
+				t.Error("Expected the secret to no longer be tracked")
+			}
+		})
+	}
+}
+
+func TestTemplatedFieldConflict(t *testing.T) {
+	for _, mode := range []string{conflictWarn, conflictError} {
+		t.Run(mode, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.setKV2("secret/data/shared", map[string]interface{}{"web": "web-1", "api": "api-1"})
+			fd := newFakeDocker(t)
+			fd.addSecret("app-id", "app", nil)
+			fd.addService("svc-1", "web", "app")
+			fd.addService("svc-2", "api", "app")
+			driver := &VaultDriver{
+				client:        fv.client(t),
+				config:        &VaultConfig{MountPath: "secret", EnableRotation: true, LabelConflict: mode},
+				dockerClient:  fd.client(t),
+				secretTracker: make(map[string]*SecretInfo),
+				metrics:       newDriverMetrics(),
+			}
+			labels := map[string]string{"vault_path": "shared", "vault_field_template": "{{.Service}}"}
+			if resp := driver.Get(secrets.Request{SecretName: "app", ServiceName: "web", SecretLabels: labels}); resp.Err != "" {
+				t.Fatalf("Unexpected error: %s", resp.Err)
+			}
+			resp := driver.Get(secrets.Request{SecretName: "app", ServiceName: "api", SecretLabels: labels})
+			if mode == conflictError && resp.Err == "" {
+				t.Error("Expected the second service's templated field to be refused")
+			}
+			if mode == conflictWarn && string(resp.Value) != "api-1" {
+				t.Errorf("Expected api's own value, got %q (%s)", resp.Value, resp.Err)
+			}
+
+			// Rotating would move both services onto one service's value
+			fv.setKV2("secret/data/shared", map[string]interface{}{"web": "web-2", "api": "api-2"})
+			driver.checkForSecretChanges()
+			if len(fd.secrets) != 1 {
+				t.Errorf("Expected no new version to be created, got %d secrets", len(fd.secrets))
+			}
+			for _, service := range []string{"svc-1", "svc-2"} {
+				if names := fd.serviceSecretNames(service); len(names) != 1 || names[0] != "app" {
+					t.Errorf("Expected %s to keep the original secret, got %v", service, names)
+				}
+			}
+		})
+	}
+}
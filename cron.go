@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute hour
+// day-of-month month day-of-week). Each field supports *, lists, ranges and
+// steps, e.g. "*/15 2-4 * * 1,3".
+type cronSchedule struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool // field was "*", which changes how day fields combine
+}
+
+// cronDescriptors are the supported shorthand schedules
+var cronDescriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// parseCron parses a cron expression or one of the @ descriptors
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[expr]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+
+	s := &cronSchedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid cron minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid cron hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid cron day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid cron month: %v", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid cron day of week: %v", err)
+	}
+	s.dow[0] = s.dow[0] || s.dow[7] // 7 is also Sunday
+	return s, nil
+}
+
+// parseCronField parses one comma-separated cron field into a set of allowed values
+func parseCronField(field string, min, max int) ([]bool, error) {
+	allowed := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, found := strings.Cut(part, "/"); found {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = before, n
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			var err error
+			if before, after, found := strings.Cut(rangePart, "-"); found {
+				low, err = strconv.Atoi(before)
+				if err == nil {
+					high, err = strconv.Atoi(after)
+				}
+			} else {
+				low, err = strconv.Atoi(rangePart)
+				high = low
+				if strings.Contains(part, "/") {
+					high = max // "5/10" means every 10 starting at 5
+				}
+			}
+			if err != nil || low < min || high > max || low > high {
+				return nil, fmt.Errorf("invalid value %q, expected %d-%d", part, min, max)
+			}
+		}
+		for v := low; v <= high; v += step {
+			allowed[v] = true
+		}
+	}
+	return allowed, nil
+}
+
+// dayMatches applies cron's day rule: when both day fields are restricted, a
+// day matching either one is enough
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first scheduled minute after t, or the zero time if the
+// schedule never matches (e.g. February 30th)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case !s.month[month]:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseRotateCron parses a vault_rotate_cron label or VAULT_ROTATE_CRON
+// value, logging and ignoring invalid expressions
+func parseRotateCron(expr, secretName string) *cronSchedule {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		log.Warnf("Ignoring rotation schedule for secret %s: %v", secretName, err)
+		return nil
+	}
+	return schedule
+}
+
+// runScheduledRotations force-rotates tracked secrets whose cron schedule is
+// due at now, independent of change detection. A rotation re-reads the value
+// from Vault, so dynamic secrets get fresh credentials, and rewires services.
+func (d *VaultDriver) runScheduledRotations(now time.Time) {
+	var due []*SecretInfo
+	d.trackerMutex.Lock()
+	for _, secretInfo := range d.secretTracker {
+		if secretInfo.RotateSchedule == nil {
+			continue
+		}
+		if secretInfo.NextScheduledRotation.IsZero() {
+			secretInfo.NextScheduledRotation = secretInfo.RotateSchedule.next(now)
+			continue
+		}
+		if !now.Before(secretInfo.NextScheduledRotation) {
+			secretInfo.NextScheduledRotation = secretInfo.RotateSchedule.next(now)
+			due = append(due, secretInfo)
+		}
+	}
+	d.trackerMutex.Unlock()
+
+	for _, secretInfo := range due {
+		log.Printf("Scheduled rotation of secret %s", secretInfo.DockerSecretName)
+		d.metrics.inc("vault_scheduled_rotations_total")
+		if _, err := d.forceRotateSecret(secretInfo); err != nil {
+			log.Errorf("Scheduled rotation of secret %s failed: %v", secretInfo.DockerSecretName, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 17, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 1, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 5, 2, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, 5, 1, 10, 25, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 15 * 5", time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.next(base); !got.Equal(tt.expected) {
+			t.Errorf("next(%q) = %v, expected %v", tt.expr, got, tt.expected)
+		}
+	}
+
+	schedule, _ := parseCron("0 0 30 2 *")
+	if got := schedule.next(base); !got.IsZero() {
+		t.Errorf("Expected an impossible schedule to never fire, got %v", got)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestScheduledRotationFiresAtExpectedTime(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_rotate_cron": "0 2 * * *"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	driver.runScheduledRotations(day.Add(time.Hour)) // schedules 02:00
+	driver.runScheduledRotations(day.Add(time.Hour + 59*time.Minute))
+	if fd.called("POST /secrets/create") {
+		t.Fatal("Rotation must not fire before the scheduled time")
+	}
+
+	// The value is unchanged, but the scheduled rotation still happens
+	driver.runScheduledRotations(day.Add(2*time.Hour + 10*time.Second))
+	if !fd.called("POST /secrets/create") || !fd.called("POST /services/svc-1/update") {
+		t.Fatalf("Expected a rotation at 02:00, got calls %v", fd.recordedCalls())
+	}
+	if next := driver.secretTracker["db"].NextScheduledRotation; !next.Equal(day.Add(26 * time.Hour)) {
+		t.Errorf("Expected next rotation the following day at 02:00, got %v", next)
+	}
+
+	calls := len(fd.recordedCalls())
+	driver.runScheduledRotations(day.Add(3 * time.Hour))
+	if len(fd.recordedCalls()) != calls {
+		t.Error("Rotation must fire only once per scheduled time")
+	}
+	if count := driver.metrics.counter("vault_scheduled_rotations_total"); count != 1 {
+		t.Errorf("Expected 1 scheduled rotation, got %v", count)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/hashicorp/vault/api"
+)
+
+// mockDocker is an in-memory dockerAPI that records the calls made to it
+type mockDocker struct {
+	secrets  []swarm.Secret
+	services []swarm.Service
+	calls    []string
+
+	listFailures int // number of upcoming list calls that fail
+}
+
+// listError fails the call while list failures remain
+func (m *mockDocker) listError() error {
+	if m.listFailures > 0 {
+		m.listFailures--
+		return errors.New("daemon busy")
+	}
+	return nil
+}
+
+func (m *mockDocker) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	m.calls = append(m.calls, "SecretList")
+	if err := m.listError(); err != nil {
+		return nil, err
+	}
+	return append([]swarm.Secret(nil), m.secrets...), nil
+}
+
+func (m *mockDocker) SecretCreate(ctx context.Context, spec swarm.SecretSpec) (types.SecretCreateResponse, error) {
+	m.calls = append(m.calls, "SecretCreate "+spec.Name)
+	id := fmt.Sprintf("id-%d", len(m.secrets)+1)
+	m.secrets = append(m.secrets, swarm.Secret{ID: id, Spec: spec})
+	return types.SecretCreateResponse{ID: id}, nil
+}
+
+func (m *mockDocker) SecretRemove(ctx context.Context, id string) error {
+	m.calls = append(m.calls, "SecretRemove "+id)
+	for i, secret := range m.secrets {
+		if secret.ID == id {
+			m.secrets = append(m.secrets[:i], m.secrets[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("secret %s not found", id)
+}
+
+func (m *mockDocker) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	m.calls = append(m.calls, "ServiceList")
+	if err := m.listError(); err != nil {
+		return nil, err
+	}
+	return append([]swarm.Service(nil), m.services...), nil
+}
+
+func (m *mockDocker) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	m.calls = append(m.calls, "ServiceUpdate "+serviceID)
+	for i := range m.services {
+		if m.services[i].ID == serviceID {
+			m.services[i].Spec = spec
+			return swarm.ServiceUpdateResponse{}, nil
+		}
+	}
+	return swarm.ServiceUpdateResponse{}, fmt.Errorf("service %s not found", serviceID)
+}
+
+func (m *mockDocker) ServiceCreate(ctx context.Context, spec swarm.ServiceSpec, options types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error) {
+	m.calls = append(m.calls, "ServiceCreate "+spec.Name)
+	id := fmt.Sprintf("svc-%d", len(m.services)+1)
+	m.services = append(m.services, swarm.Service{ID: id, Spec: spec})
+	return swarm.ServiceCreateResponse{ID: id}, nil
+}
+
+func (m *mockDocker) ServiceRemove(ctx context.Context, serviceID string) error {
+	m.calls = append(m.calls, "ServiceRemove "+serviceID)
+	for i, service := range m.services {
+		if service.ID == serviceID {
+			m.services = append(m.services[:i], m.services[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("service %s not found", serviceID)
+}
+
+func (m *mockDocker) Close() error {
+	return nil
+}
+
+func TestRotateSecretWithMockDocker(t *testing.T) {
+	docker := &mockDocker{
+		secrets: []swarm.Secret{{ID: "old-id", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db_password"}}}},
+		services: []swarm.Service{{ID: "svc-1", Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: "web"},
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{
+				Secrets: []*swarm.SecretReference{{SecretID: "old-id", SecretName: "db_password", File: &swarm.SecretReferenceFileTarget{Name: "db_password"}}},
+			}},
+		}}},
+	}
+	driver := &VaultDriver{
+		logical: &mockLogical{secrets: map[string]*api.Secret{
+			"secret/data/db": {Data: map[string]interface{}{"data": map[string]interface{}{"password": "new"}}},
+		}},
+		config:        &VaultConfig{MountPath: "secret"},
+		dockerClient:  docker,
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	secretInfo := &SecretInfo{
+		DockerSecretName:  "db_password",
+		CurrentSecretName: "db_password",
+		VaultPath:         "secret/data/db",
+		VaultField:        "password",
+	}
+	driver.secretTracker["db_password"] = secretInfo
+
+	if _, err := driver.rotateSecret(secretInfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	newName := secretInfo.CurrentSecretName
+	if newName == "db_password" {
+		t.Fatal("Expected the current secret name to move to the new version")
+	}
+	expected := []string{"SecretList", "SecretCreate " + newName, "ServiceList", "ServiceUpdate svc-1", "SecretRemove old-id"}
+	if !reflect.DeepEqual(docker.calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, docker.calls)
+	}
+
+	ref := docker.services[0].Spec.TaskTemplate.ContainerSpec.Secrets[0]
+	if ref.SecretName != newName || ref.SecretID != "id-2" {
+		t.Errorf("Expected service to reference the new version, got %+v", ref)
+	}
+	if ref.File == nil || ref.File.Name != "db_password" {
+		t.Errorf("Expected the file target to be kept, got %+v", ref.File)
+	}
+	if len(docker.secrets) != 1 || docker.secrets[0].Spec.Name != newName {
+		t.Errorf("Expected only the new version to remain, got %+v", docker.secrets)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	dockerclient "github.com/docker/docker/client"
+)
+
+// fakeDocker is a minimal HTTP stand-in for the Docker secrets and services API
+type fakeDocker struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	secrets  []swarm.Secret
+	services []swarm.Service
+	calls    []string // "METHOD /path" of every request, API version stripped
+	nextID   int
+	failing  map[string]bool // service IDs whose updates fail
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// newFakeDocker starts a fake Docker API server that is closed when the test ends
+func newFakeDocker(t testing.TB) *fakeDocker {
+	fd := &fakeDocker{}
+	fd.server = httptest.NewServer(http.HandlerFunc(fd.handle))
+	t.Cleanup(fd.server.Close)
+	return fd
+}
+
+func (fd *fakeDocker) handle(w http.ResponseWriter, r *http.Request) {
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	fd.calls = append(fd.calls, r.Method+" "+path)
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && path == "/secrets":
+		json.NewEncoder(w).Encode(fd.secrets)
+
+	case r.Method == http.MethodPost && path == "/secrets/create":
+		var spec swarm.SecretSpec
+		json.NewDecoder(r.Body).Decode(&spec)
+		fd.nextID++
+		secret := swarm.Secret{ID: fmt.Sprintf("new-secret-%d", fd.nextID), Spec: spec}
+		secret.CreatedAt = time.Now()
+		fd.secrets = append(fd.secrets, secret)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"ID": secret.ID})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/secrets/"):
+		id := strings.TrimPrefix(path, "/secrets/")
+		for i, secret := range fd.secrets {
+			if secret.ID == id {
+				fd.secrets = append(fd.secrets[:i], fd.secrets[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && path == "/services":
+		json.NewEncoder(w).Encode(fd.services)
+
+	case r.Method == http.MethodPost && path == "/services/create":
+		var spec swarm.ServiceSpec
+		json.NewDecoder(r.Body).Decode(&spec)
+		fd.nextID++
+		service := swarm.Service{ID: fmt.Sprintf("new-service-%d", fd.nextID), Spec: spec}
+		fd.services = append(fd.services, service)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(swarm.ServiceCreateResponse{ID: service.ID})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/services/"):
+		id := strings.TrimPrefix(path, "/services/")
+		for i, service := range fd.services {
+			if service.ID == id {
+				fd.services = append(fd.services[:i], fd.services[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/services/") && strings.HasSuffix(path, "/update"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/services/"), "/update")
+		if fd.failing[id] {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"update out of sequence"}`))
+			return
+		}
+		var spec swarm.ServiceSpec
+		json.NewDecoder(r.Body).Decode(&spec)
+		for i := range fd.services {
+			if fd.services[i].ID == id {
+				fd.services[i].Spec = spec
+				fd.services[i].Version.Index++
+			}
+		}
+		json.NewEncoder(w).Encode(swarm.ServiceUpdateResponse{})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"not implemented by fake"}`))
+	}
+}
+
+// addSecret registers an existing Docker secret
+func (fd *fakeDocker) addSecret(id, name string, labels map[string]string) {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	secret := swarm.Secret{ID: id}
+	secret.CreatedAt = time.Now()
+	secret.Spec.Name = name
+	secret.Spec.Labels = labels
+	fd.secrets = append(fd.secrets, secret)
+}
+
+// addService registers a service referencing the given secret names. References
+// to secrets that aren't registered get a made-up ID, i.e. they are dangling.
+func (fd *fakeDocker) addService(id, name string, secretNames ...string) {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	service := swarm.Service{ID: id}
+	service.Spec.Name = name
+	service.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{}
+	for _, secretName := range secretNames {
+		secretID := "removed-" + secretName
+		for _, secret := range fd.secrets {
+			if secret.Spec.Name == secretName {
+				secretID = secret.ID
+			}
+		}
+		service.Spec.TaskTemplate.ContainerSpec.Secrets = append(service.Spec.TaskTemplate.ContainerSpec.Secrets,
+			&swarm.SecretReference{SecretName: secretName, SecretID: secretID})
+	}
+	fd.services = append(fd.services, service)
+}
+
+// failUpdates makes every update of the given service fail
+func (fd *fakeDocker) failUpdates(serviceID string) {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	if fd.failing == nil {
+		fd.failing = make(map[string]bool)
+	}
+	fd.failing[serviceID] = true
+}
+
+// allowUpdates lets updates of a service succeed again after failUpdates
+func (fd *fakeDocker) allowUpdates(serviceID string) {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	delete(fd.failing, serviceID)
+}
+
+// serviceSecretNames returns the secret names a service currently references
+func (fd *fakeDocker) serviceSecretNames(serviceID string) []string {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	var names []string
+	for _, service := range fd.services {
+		if service.ID == serviceID {
+			for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+				names = append(names, ref.SecretName)
+			}
+		}
+	}
+	return names
+}
+
+// recordedCalls returns the requests made so far
+func (fd *fakeDocker) recordedCalls() []string {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	return append([]string(nil), fd.calls...)
+}
+
+// called reports whether a request was made
+func (fd *fakeDocker) called(call string) bool {
+	for _, c := range fd.recordedCalls() {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+// secretByName returns the current secret with the given name
+func (fd *fakeDocker) secretByName(name string) *swarm.Secret {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	for i := range fd.secrets {
+		if fd.secrets[i].Spec.Name == name {
+			secret := fd.secrets[i]
+			return &secret
+		}
+	}
+	return nil
+}
+
+// client returns a Docker API client pointed at the fake server
+func (fd *fakeDocker) client(t testing.TB) *dockerclient.Client {
+	client, err := dockerclient.NewClientWithOpts(
+		dockerclient.WithHost("tcp://"+strings.TrimPrefix(fd.server.URL, "http://")),
+		dockerclient.WithVersion("1.41"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create docker client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// listSecrets lists Docker secrets, retrying transient failures
+func (d *VaultDriver) listSecrets(ctx context.Context) ([]swarm.Secret, error) {
+	return retryList(ctx, d, "secrets", func() ([]swarm.Secret, error) {
+		return d.dockerClient.SecretList(ctx, types.SecretListOptions{})
+	})
+}
+
+// listServices lists Swarm services, retrying transient failures
+func (d *VaultDriver) listServices(ctx context.Context) ([]swarm.Service, error) {
+	return retryList(ctx, d, "services", func() ([]swarm.Service, error) {
+		return d.dockerClient.ServiceList(ctx, types.ServiceListOptions{})
+	})
+}
+
+// retryList calls list up to VAULT_DOCKER_LIST_RETRIES more times after a
+// failure, doubling the wait from VAULT_DOCKER_LIST_BACKOFF each time, and
+// gives up early when ctx is done
+func retryList[T any](ctx context.Context, d *VaultDriver, what string, list func() ([]T, error)) ([]T, error) {
+	backoff := d.config.ListRetryBackoff
+	for attempt := 0; ; attempt++ {
+		items, err := list()
+		if err == nil || attempt >= d.config.ListRetries {
+			return items, err
+		}
+		log.Warnf("Listing %s failed, retrying in %v: %v", what, backoff, err)
+		d.metrics.inc(fmt.Sprintf(`vault_docker_list_retries_total{call=%q}`, what))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func TestListRetriesTransientFailure(t *testing.T) {
+	docker := &mockDocker{
+		secrets:      []swarm.Secret{{ID: "db-id", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db"}}}},
+		listFailures: 2,
+	}
+	driver := &VaultDriver{
+		config:       &VaultConfig{ListRetries: 2, ListRetryBackoff: time.Millisecond},
+		dockerClient: docker,
+		metrics:      newDriverMetrics(),
+	}
+
+	secrets, err := driver.listSecrets(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the listing to succeed after retries, got %v", err)
+	}
+	if len(secrets) != 1 || len(docker.calls) != 3 {
+		t.Errorf("Expected 3 attempts returning 1 secret, got %d secrets after %v", len(secrets), docker.calls)
+	}
+	if count := driver.metrics.counter(`vault_docker_list_retries_total{call="secrets"}`); count != 2 {
+		t.Errorf("Expected 2 retries, got %v", count)
+	}
+
+	// Retries are bounded
+	docker.calls, docker.listFailures = nil, 3
+	if _, err := driver.listServices(context.Background()); err == nil {
+		t.Error("Expected an error once retries are exhausted")
+	}
+	if len(docker.calls) != 3 {
+		t.Errorf("Expected 3 attempts, got %v", docker.calls)
+	}
+
+	// A cancelled context stops retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	docker.calls, docker.listFailures = nil, 1
+	driver.config.ListRetryBackoff = time.Hour
+	if _, err := driver.listServices(ctx); err == nil || len(docker.calls) != 1 {
+		t.Errorf("Expected to give up without retrying, got %v after %v", err, docker.calls)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+	log "github.com/sirupsen/logrus"
+)
+
+// minRotationAPIVersion is the first Docker API version with the Swarm secret
+// and service secret APIs used for rotation
+const minRotationAPIVersion = "1.25"
+
+// dockerVersionClient is the part of the Docker client used to check the API
+// version at startup
+type dockerVersionClient interface {
+	ServerVersion(ctx context.Context) (types.Version, error)
+	NegotiateAPIVersion(ctx context.Context)
+	ClientVersion() string
+}
+
+// checkDockerAPIVersion logs the API version the driver talks to the daemon
+// with and returns warnings when a pinned DOCKER_API_VERSION can't serve
+// rotation. A pinned version disables negotiation.
+func checkDockerAPIVersion(ctx context.Context, cli dockerVersionClient, pinned string) []string {
+	server, err := cli.ServerVersion(ctx)
+	if err != nil {
+		log.Warnf("Could not query the Docker API version: %v", err)
+		return nil
+	}
+	cli.NegotiateAPIVersion(ctx)
+	log.Printf("Using Docker API version %s (daemon supports %s to %s)", cli.ClientVersion(), server.MinAPIVersion, server.APIVersion)
+	if pinned == "" {
+		return nil
+	}
+
+	var warnings []string
+	if versions.LessThan(pinned, minRotationAPIVersion) {
+		warnings = append(warnings, fmt.Sprintf("DOCKER_API_VERSION=%s predates the Swarm secret and service APIs used for rotation (%s or newer)", pinned, minRotationAPIVersion))
+	}
+	if server.APIVersion != "" && versions.GreaterThan(pinned, server.APIVersion) {
+		warnings = append(warnings, fmt.Sprintf("DOCKER_API_VERSION=%s is newer than the daemon's API version %s", pinned, server.APIVersion))
+	}
+	if server.MinAPIVersion != "" && versions.LessThan(pinned, server.MinAPIVersion) {
+		warnings = append(warnings, fmt.Sprintf("DOCKER_API_VERSION=%s is older than the daemon's minimum API version %s", pinned, server.MinAPIVersion))
+	}
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+	return warnings
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeVersionClient reports a fixed daemon version range
+type fakeVersionClient struct {
+	server     types.Version
+	version    string
+	negotiated bool
+}
+
+func (f *fakeVersionClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	return f.server, nil
+}
+
+func (f *fakeVersionClient) NegotiateAPIVersion(ctx context.Context) {
+	f.negotiated = true
+}
+
+func (f *fakeVersionClient) ClientVersion() string {
+	return f.version
+}
+
+func TestCheckDockerAPIVersion(t *testing.T) {
+	server := types.Version{APIVersion: "1.47", MinAPIVersion: "1.24"}
+	tests := []struct {
+		name   string
+		pinned string
+		warns  []string
+	}{
+		{"negotiated", "", nil},
+		{"supported pin", "1.37", nil},
+		{"before secrets", "1.24", []string{"predates the Swarm secret and service APIs"}},
+		{"newer than daemon", "1.48", []string{"newer than the daemon's API version 1.47"}},
+		{"older than daemon minimum", "1.12", []string{"predates", "older than the daemon's minimum API version 1.24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &fakeVersionClient{server: server, version: "1.47"}
+			warnings := checkDockerAPIVersion(context.Background(), cli, tt.pinned)
+			if len(warnings) != len(tt.warns) {
+				t.Fatalf("Expected %d warnings, got %v", len(tt.warns), warnings)
+			}
+			for i, warning := range warnings {
+				if !strings.Contains(warning, tt.warns[i]) {
+					t.Errorf("Expected warning containing %q, got %q", tt.warns[i], warning)
+				}
+			}
+			if !cli.negotiated {
+				t.Error("Expected the API version to be negotiated")
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exportedMetricPrefixes select the counters and gauges written to
+// VAULT_METRICS_EXPORT_PATH
+var exportedMetricPrefixes = []string{"vault_rotation", "vault_scheduled_rotations", "vault_rollbacks", "vault_sweeps", "vault_tracked_secrets"}
+
+// metricsSnapshot is one line of the metrics export file
+type metricsSnapshot struct {
+	Time    time.Time          `json:"time"`
+	Metrics map[string]float64 `json:"metrics"`
+	Secrets []secretStats      `json:"secrets"`
+}
+
+// secretStats are the exported per-secret statistics. They never contain
+// secret values or hashes.
+type secretStats struct {
+	Secret       string     `json:"secret"`
+	Path         string     `json:"path"`
+	Version      string     `json:"version"` // Docker secret currently holding the value
+	LastUpdated  time.Time  `json:"last_updated"`
+	BacklogSince *time.Time `json:"backlog_since,omitempty"`
+	PendingSince *time.Time `json:"pending_since,omitempty"`
+	Services     int        `json:"services"` // number of services using the secret
+}
+
+// exportSnapshot collects the rotation metrics and per-secret statistics
+func (d *VaultDriver) exportSnapshot(now time.Time) metricsSnapshot {
+	snapshot := metricsSnapshot{Time: now, Metrics: make(map[string]float64)}
+	for name, value := range d.metrics.snapshot() {
+		for _, prefix := range exportedMetricPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				snapshot.Metrics[name] = value
+				break
+			}
+		}
+	}
+
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	d.trackerMutex.RLock()
+	for _, secretInfo := range d.secretTracker {
+		snapshot.Secrets = append(snapshot.Secrets, secretStats{
+			Secret:       secretInfo.DockerSecretName,
+			Path:         secretInfo.VaultPath,
+			Version:      secretInfo.CurrentSecretName,
+			LastUpdated:  secretInfo.LastUpdated,
+			BacklogSince: optionalTime(secretInfo.BacklogSince),
+			PendingSince: optionalTime(secretInfo.PendingSince),
+			Services:     len(secretInfo.ServiceNames),
+		})
+	}
+	d.trackerMutex.RUnlock()
+	sort.Slice(snapshot.Secrets, func(i, j int) bool {
+		return snapshot.Secrets[i].Secret < snapshot.Secrets[j].Secret
+	})
+	return snapshot
+}
+
+// exportMetrics appends a snapshot as a JSON line to VAULT_METRICS_EXPORT_PATH.
+// When the line would grow the file past VAULT_METRICS_EXPORT_MAX_BYTES, the
+// file is first moved to <path>.1, replacing the previous one.
+func (d *VaultDriver) exportMetrics(now time.Time) error {
+	path := d.config.MetricsExport
+	line, err := json.Marshal(d.exportSnapshot(now))
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics snapshot: %v", err)
+	}
+	line = append(line, '\n')
+
+	if info, err := os.Stat(path); err == nil && d.config.ExportMaxBytes > 0 && info.Size()+int64(len(line)) > d.config.ExportMaxBytes {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate metrics export file: %v", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open metrics export file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write metrics export file: %v", err)
+	}
+	return nil
+}
+
+// runMetricsExport writes a snapshot every VAULT_METRICS_EXPORT_INTERVAL
+// until the driver stops
+func (d *VaultDriver) runMetricsExport() {
+	ticker := d.clockOrDefault().NewTicker(d.config.ExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case now := <-ticker.C():
+			if err := d.exportMetrics(now); err != nil {
+				d.metrics.inc("vault_metrics_export_errors_total")
+				log.Warnf("Metrics export failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// readSnapshots decodes every line of a metrics export file
+func readSnapshots(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open export file: %v", err)
+	}
+	defer file.Close()
+	var snapshots []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var snapshot map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			t.Fatalf("Invalid snapshot line %q: %v", scanner.Text(), err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+func TestMetricsExportCadence(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	start := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	monitorCtx, monitorCancel := context.WithCancel(context.Background())
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, MetricsExport: path, ExportInterval: time.Minute},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		monitorCtx:    monitorCtx,
+		monitorCancel: monitorCancel,
+		clock:         clock,
+	}
+	if resp := driver.Get(secrets.Request{SecretName: "db", ServiceName: "web", SecretLabels: map[string]string{"vault_path": "db", "vault_field": "password"}}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	driver.metrics.inc(`vault_rotations_total{result="success"}`)
+	driver.metrics.inc("vault_read_warnings_total")
+
+	done := make(chan struct{})
+	go func() {
+		driver.runMetricsExport()
+		close(done)
+	}()
+	<-clock.created
+
+	// Ticks are delivered synchronously, so each snapshot is written before
+	// the next Advance returns
+	for i := 0; i < 6; i++ {
+		clock.Advance(30 * time.Second)
+	}
+	monitorCancel()
+	<-done
+
+	snapshots := readSnapshots(t, path)
+	if len(snapshots) != 3 {
+		t.Fatalf("Expected a snapshot every minute for 3 minutes, got %d", len(snapshots))
+	}
+	for _, column := range []string{"time", "metrics", "secrets"} {
+		if _, ok := snapshots[0][column]; !ok {
+			t.Errorf("Expected column %s in %v", column, snapshots[0])
+		}
+	}
+	metrics := snapshots[0]["metrics"].(map[string]interface{})
+	if metrics[`vault_rotations_total{result="success"}`] != 1.0 {
+		t.Errorf("Expected rotation counters to be exported, got %v", metrics)
+	}
+	if _, ok := metrics["vault_read_warnings_total"]; ok {
+		t.Errorf("Expected only rotation metrics to be exported, got %v", metrics)
+	}
+	stats := snapshots[0]["secrets"].([]interface{})
+	if len(stats) != 1 {
+		t.Fatalf("Expected one secret, got %v", stats)
+	}
+	secret := stats[0].(map[string]interface{})
+	for _, column := range []string{"secret", "path", "version", "last_updated", "services"} {
+		if _, ok := secret[column]; !ok {
+			t.Errorf("Expected column %s in %v", column, secret)
+		}
+	}
+	for i, snapshot := range snapshots {
+		expected := start.Add(time.Duration(i+1) * time.Minute).Format(time.RFC3339)
+		if snapshot["time"] != expected {
+			t.Errorf("Expected snapshot %d at %s, got %v", i, expected, snapshot["time"])
+		}
+	}
+}
+
+func TestMetricsExportRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	driver := &VaultDriver{
+		config:        &VaultConfig{MetricsExport: path, ExportMaxBytes: 200},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		if err := driver.exportMetrics(now.Add(time.Duration(i) * time.Minute)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > 200 {
+		t.Errorf("Expected the export file to stay under 200 bytes, got %v (%v)", info, err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("Expected the previous file to be kept as %s.1: %v", path, err)
+	}
+	// The newest snapshot is in the current file
+	snapshots := readSnapshots(t, path)
+	if last := snapshots[len(snapshots)-1]["time"]; last != now.Add(9*time.Minute).Format(time.RFC3339) {
+		t.Errorf("Expected the last snapshot at the end of the current file, got %v", last)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestExtractionFallbackCounter(t *testing.T) {
+	driver := &VaultDriver{config: &VaultConfig{}, metrics: newDriverMetrics()}
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"password": "p", "api_token": "t"},
+	}}
+
+	// Explicit field
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "api_token"}}
+	if value, err := driver.extractSecretValue(secret, req); err != nil || string(value) != "t" {
+		t.Fatalf("Expected explicit field value, got %q (%v)", value, err)
+	}
+
+	// Default field
+	if value, err := driver.extractSecretValue(secret, secrets.Request{SecretName: "db"}); err != nil || string(value) != "p" {
+		t.Fatalf("Expected default field value, got %q (%v)", value, err)
+	}
+	if count := driver.metrics.counter("vault_extraction_fallback_total"); count != 0 {
+		t.Fatalf("Expected no fallback for explicit/default fields, got %v", count)
+	}
+
+	// No explicit or default field: falls back to the first string
+	fallback := &api.Secret{Data: map[string]interface{}{"api_token": "t"}}
+	if value, err := driver.extractSecretValue(fallback, secrets.Request{SecretName: "db"}); err != nil || string(value) != "t" {
+		t.Fatalf("Expected fallback value, got %q (%v)", value, err)
+	}
+	if count := driver.metrics.counter("vault_extraction_fallback_total"); count != 1 {
+		t.Errorf("Expected 1 fallback, got %v", count)
+	}
+}
+
+func TestFieldTemplatePerService(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/shared", map[string]interface{}{"web": "web-pass", "api": "api-pass"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+	}
+
+	labels := map[string]string{"vault_path": "shared", "vault_field_template": "{{.Service}}"}
+	for service, expected := range map[string]string{"web": "web-pass", "api": "api-pass"} {
+		resp := driver.Get(secrets.Request{SecretName: "app", ServiceName: service, SecretLabels: labels})
+		if resp.Err != "" || string(resp.Value) != expected {
+			t.Errorf("Service %s: expected %q, got %q (err: %s)", service, expected, resp.Value, resp.Err)
+		}
+		if !resp.DoNotReuse {
+			t.Errorf("Service %s: templated fields must not be reused across services", service)
+		}
+	}
+
+	bad := map[string]string{"vault_path": "shared", "vault_field_template": "{{.Missing}}"}
+	if resp := driver.Get(secrets.Request{SecretName: "app", ServiceName: "web", SecretLabels: bad}); resp.Err == "" {
+		t.Error("Expected an error for a template referencing an unknown key")
+	}
+}
+
+func TestExcludedFieldsSkipped(t *testing.T) {
+	driver := &VaultDriver{
+		config:  &VaultConfig{ExcludeFields: parseFieldSet("data, secret")},
+		metrics: newDriverMetrics(),
+	}
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"secret": "metadata", "api_key": "k"},
+	}}
+
+	// "secret" is a default field but excluded, so the search falls through
+	if value, err := driver.extractSecretValue(secret, secrets.Request{SecretName: "app"}); err != nil || string(value) != "k" {
+		t.Fatalf("Expected excluded field to be skipped, got %q (%v)", value, err)
+	}
+
+	// An explicit field is still honored
+	req := secrets.Request{SecretName: "app", SecretLabels: map[string]string{"vault_field": "secret"}}
+	if value, err := driver.extractSecretValue(secret, req); err != nil || string(value) != "metadata" {
+		t.Errorf("Expected explicit field to ignore exclusions, got %q (%v)", value, err)
+	}
+
+	// Only excluded fields left: nothing suitable
+	onlyExcluded := &api.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"secret": "metadata"}}}
+	if _, err := driver.extractSecretValue(onlyExcluded, secrets.Request{SecretName: "app"}); err == nil {
+		t.Error("Expected no suitable value when all fields are excluded")
+	}
+}
+
+func TestApplyTrailingNewline(t *testing.T) {
+	tests := []struct {
+		value, mode, expected string
+	}{
+		{"secret", "", "secret"},
+		{"secret\n", "preserve", "secret\n"},
+		{"secret\n", "strip", "secret"},
+		{"secret\r\n\n", "strip", "secret"},
+		{"secret", "strip", "secret"},
+		{"secret", "ensure", "secret\n"},
+		{"secret\n", "ensure", "secret\n"},
+		{"secret\n", "bogus", "secret\n"},
+	}
+	for _, tt := range tests {
+		if got := string(applyTrailingNewline([]byte(tt.value), tt.mode)); got != tt.expected {
+			t.Errorf("applyTrailingNewline(%q, %q) = %q, expected %q", tt.value, tt.mode, got, tt.expected)
+		}
+	}
+}
+
+func TestTrailingNewlineLabel(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p\n"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+	}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_trailing_newline": "strip"}}
+	if resp := driver.Get(req); string(resp.Value) != "p" {
+		t.Fatalf("Expected stripped value, got %q (err: %s)", resp.Value, resp.Err)
+	}
+
+	// Change detection applies the same mode, so the value isn't seen as changed
+	if driver.hasSecretChanged(driver.secretTracker["db"]) {
+		t.Error("Expected no change for an unchanged value")
+	}
+}
+
+func TestFieldJoin(t *testing.T) {
+	driver := &VaultDriver{config: &VaultConfig{}, metrics: newDriverMetrics()}
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"username": "app", "password": "s3cret", "host": "db"},
+	}}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		value  string
+		errMsg string
+	}{
+		{"default separator", map[string]string{"vault_field_join": "username,password"}, "app:s3cret", ""},
+		{"custom separator", map[string]string{"vault_field_join": "username, password,host", "vault_field_separator": "/"}, "app/s3cret/db", ""},
+		{"overrides vault_field", map[string]string{"vault_field_join": "host,username", "vault_field": "password"}, "db:app", ""},
+		{"missing field", map[string]string{"vault_field_join": "username,port"}, "", "field port not found in secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := driver.extractSecretValue(secret, secrets.Request{SecretName: "dsn", SecretLabels: tt.labels})
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("Expected error %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil || string(value) != tt.value {
+				t.Errorf("Expected %q, got %q (%v)", tt.value, value, err)
+			}
+		})
+	}
+
+	// Tracked secrets rebuild the joined value on change detection
+	secretInfo := &SecretInfo{JoinFields: []string{"username", "password"}, JoinSeparator: "@"}
+	if value, err := driver.trackedValue(secretInfo, secret.Data["data"].(map[string]interface{})); err != nil || string(value) != "app@s3cret" {
+		t.Errorf("Expected tracked joined value, got %q (%v)", value, err)
+	}
+}
+
+func TestRejectBlankValues(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/space":   {Data: map[string]interface{}{"data": map[string]interface{}{"password": " "}}},
+		"secret/data/newline": {Data: map[string]interface{}{"data": map[string]interface{}{"password": "\n"}}},
+		"secret/data/padded":  {Data: map[string]interface{}{"data": map[string]interface{}{"password": " p \n"}}},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", RejectBlank: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	for _, name := range []string{"space", "newline"} {
+		resp := driver.Get(secrets.Request{SecretName: name})
+		if resp.Err != "failed to extract secret value: value of secret "+name+" is blank" || resp.Value != nil {
+			t.Errorf("Expected %s to be rejected, got %+v", name, resp)
+		}
+	}
+	if count := driver.metrics.counter("vault_blank_values_rejected_total"); count != 2 {
+		t.Errorf("Expected 2 rejections, got %v", count)
+	}
+	if resp := driver.Get(secrets.Request{SecretName: "padded"}); resp.Err != "" || string(resp.Value) != " p \n" {
+		t.Errorf("Expected a value with content to be returned unchanged, got %+v", resp)
+	}
+
+	// Disabled by default
+	driver.config.RejectBlank = false
+	if resp := driver.Get(secrets.Request{SecretName: "space"}); resp.Err != "" || string(resp.Value) != " " {
+		t.Errorf("Expected blank values to pass when disabled, got %+v", resp)
+	}
+}
+
+func TestPEMBundle(t *testing.T) {
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")}))
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}))
+	driver := &VaultDriver{config: &VaultConfig{}, metrics: newDriverMetrics()}
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{
+			"tls.crt":  strings.TrimSuffix(cert, "\n"), // stored without a trailing newline
+			"tls.key":  key,
+			"password": "not pem",
+		},
+	}}
+
+	req := secrets.Request{SecretName: "tls", SecretLabels: map[string]string{"vault_pem_bundle": "tls.crt,tls.key"}}
+	value, err := driver.extractSecretValue(secret, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(value) != cert+key {
+		t.Errorf("Expected cert followed by key, got %q", value)
+	}
+	rest := value
+	for _, blockType := range []string{"CERTIFICATE", "PRIVATE KEY"} {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil || block.Type != blockType {
+			t.Fatalf("Expected a %s block in the bundle, got %v", blockType, block)
+		}
+	}
+
+	req.SecretLabels["vault_pem_bundle"] = "tls.crt,password"
+	if _, err := driver.extractSecretValue(secret, req); err == nil || err.Error() != "field password is not PEM encoded" {
+		t.Errorf("Expected a non-PEM field to be rejected, got %v", err)
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/app": {Data: map[string]interface{}{"data": map[string]interface{}{
+			"config": `{"db":{"password":"s3cret","port":5432},"hosts":["a","b"]}`,
+			"plain":  "not json",
+		}}},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	tests := []struct {
+		field  string
+		path   string
+		value  string
+		errMsg string
+	}{
+		{"config", "db.password", "s3cret", ""},
+		{"config", "db.port", "5432", ""},
+		{"config", "hosts.1", "b", ""},
+		{"config", "db", `{"password":"s3cret","port":5432}`, ""},
+		{"config", "db.user", "", `JSON path db.user not found: no key "user"`},
+		{"config", "hosts.5", "", `JSON path hosts.5 not found: no index "5"`},
+		{"plain", "db", "", "field value is not valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+"/"+tt.path, func(t *testing.T) {
+			resp := driver.Get(secrets.Request{SecretName: "app", SecretLabels: map[string]string{"vault_field": tt.field, "vault_json_field": tt.path}})
+			if string(resp.Value) != tt.value || !strings.Contains(resp.Err, tt.errMsg) || (tt.errMsg == "") != (resp.Err == "") {
+				t.Errorf("Expected value %q and error %q, got %q and %q", tt.value, tt.errMsg, resp.Value, resp.Err)
+			}
+		})
+	}
+
+	// Change detection selects the same nested value, so unrelated changes
+	// in the JSON don't trigger a rotation
+	driver.Get(secrets.Request{SecretName: "app", SecretLabels: map[string]string{"vault_field": "config", "vault_json_field": "db.password"}})
+	secretInfo := driver.secretTracker["app"]
+	data := logical.secrets["secret/data/app"].Data["data"].(map[string]interface{})
+	data["config"] = `{"db":{"password":"s3cret","port":6543}}`
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected no change when the selected value is unchanged")
+	}
+	data["config"] = `{"db":{"password":"rotated"}}`
+	if !driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected a change of the selected value to be detected")
+	}
+}
+
+func TestExtractionFallbackPolicies(t *testing.T) {
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"api_token": "t", "internal": "x"},
+	}}
+	tests := []struct {
+		policy string
+		value  string
+		errMsg string
+	}{
+		{fallbackFirstString, "t", ""},
+		{fallbackRaw, `{"api_token":"t"}`, ""},
+		{fallbackError, "", "set vault_field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			driver := &VaultDriver{
+				config:  &VaultConfig{FallbackPolicy: tt.policy, ExcludeFields: parseFieldSet("internal")},
+				metrics: newDriverMetrics(),
+			}
+			value, err := driver.extractSecretValue(secret, secrets.Request{SecretName: "app"})
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil || string(value) != tt.value {
+				t.Fatalf("Expected %q, got %q (%v)", tt.value, value, err)
+			}
+			if count := driver.metrics.counter("vault_extraction_fallback_total"); count != 1 {
+				t.Errorf("Expected 1 fallback, got %v", count)
+			}
+		})
+	}
+
+	if policy := parseExtractionFallback("bogus"); policy != fallbackFirstString {
+		t.Errorf("Expected invalid policies to default to %s, got %s", fallbackFirstString, policy)
+	}
+}
+
+func TestRotationWithExtractionFallback(t *testing.T) {
+	for _, policy := range []string{fallbackRaw, fallbackFirstString} {
+		t.Run(policy, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.setKV2("secret/data/app", map[string]interface{}{"api_token": "t1"})
+			fd := newFakeDocker(t)
+			fd.addSecret("app-id", "app", nil)
+			fd.addService("svc-1", "web", "app")
+
+			driver := &VaultDriver{
+				client:        fv.client(t),
+				config:        &VaultConfig{MountPath: "secret", EnableRotation: true, FallbackPolicy: policy},
+				dockerClient:  fd.client(t),
+				secretTracker: make(map[string]*SecretInfo),
+				metrics:       newDriverMetrics(),
+			}
+			if resp := driver.Get(secrets.Request{SecretName: "app"}); resp.Err != "" {
+				t.Fatalf("Unexpected error: %s", resp.Err)
+			}
+			if summary := driver.checkForSecretChanges(); summary.Changed != 0 {
+				t.Fatalf("Expected no change before Vault changes, got %+v", summary)
+			}
+
+			fv.setKV2("secret/data/app", map[string]interface{}{"api_token": "t2"})
+			if summary := driver.checkForSecretChanges(); summary.Changed != 1 || summary.Rotated != 1 {
+				t.Fatalf("Expected the fallback value to rotate, got %+v", summary)
+			}
+			expected := map[string]string{fallbackRaw: `{"api_token":"t2"}`, fallbackFirstString: "t2"}[policy]
+			current := fd.secretByName(driver.secretTracker["app"].CurrentSecretName)
+			if current == nil || string(current.Spec.Data) != expected {
+				t.Errorf("Expected the new version to hold %q, got %+v", expected, current)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// vaultLogical is the part of the Vault logical API the driver reads secrets
+// with. *api.Logical implements it; tests inject mocks.
+type vaultLogical interface {
+	ReadWithContext(ctx context.Context, path string) (*api.Secret, error)
+}
+
+// primaryLogical returns the logical API of the primary cluster, preferring an
+// injected one
+func (d *VaultDriver) primaryLogical() vaultLogical {
+	if d.logical != nil {
+		return d.logical
+	}
+	return d.client.Logical()
+}
+
+// isFailoverError reports whether a read error indicates the cluster itself is
+// unavailable (sealed, standby, unreachable) rather than a problem with the request
+func isFailoverError(err error) bool {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError || respErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// readSecret reads a secret, failing over to the secondary cluster when the
+// primary is unavailable. The primary is always tried first so reads fail back
+// as soon as it recovers. It also returns the client of the cluster that
+// served the read, which issued any lease on the secret.
+func (d *VaultDriver) readSecret(ctx context.Context, path string) (*api.Secret, *api.Client, error) {
+	// A hanging primary must leave the secondary time to answer, so with a
+	// secondary the primary only gets half of the remaining time
+	primaryCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok && d.secondary != nil {
+		var cancel context.CancelFunc
+		primaryCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/2)
+		defer cancel()
+	}
+	secret, err := d.primaryLogical().ReadWithContext(primaryCtx, path)
+	if err == nil || d.secondary == nil || !isFailoverError(err) || ctx.Err() != nil {
+		if err == nil {
+			d.setActiveCluster(false)
+		}
+		return secret, d.client, err
+	}
+
+	log.Warnf("Primary vault read failed, trying secondary cluster: %v", err)
+	secret, secondaryErr := d.secondary.Logical().ReadWithContext(ctx, path)
+	if secondaryErr != nil {
+		log.Errorf("Secondary vault read failed: %v", secondaryErr)
+		return nil, nil, err
+	}
+	d.setActiveCluster(true)
+	return secret, d.secondary, nil
+}
+
+// recordLease registers the lease of a dynamic secret so it is revoked on
+// Stop. Only leases of values that were served or rotated in are recorded;
+// reads that merely check for changes are left to expire.
+func (d *VaultDriver) recordLease(secret *api.Secret, client *api.Client) {
+	if secret != nil && secret.LeaseID != "" && client != nil {
+		d.leases.add(secret.LeaseID, client, time.Duration(secret.LeaseDuration)*time.Second, d.now())
+	}
+}
+
+// setActiveCluster records which cluster served the last successful read
+func (d *VaultDriver) setActiveCluster(secondary bool) {
+	if d.secondary == nil {
+		return
+	}
+	if d.usingSecondary.Swap(secondary) != secondary {
+		if secondary {
+			log.Warnf("Failed over to secondary vault cluster")
+			d.metrics.inc("vault_cluster_failovers_total")
+		} else {
+			log.Printf("Failed back to primary vault cluster")
+		}
+	}
+	if secondary {
+		d.metrics.setGauge(`vault_cluster_active{cluster="primary"}`, 0)
+		d.metrics.setGauge(`vault_cluster_active{cluster="secondary"}`, 1)
+	} else {
+		d.metrics.setGauge(`vault_cluster_active{cluster="primary"}`, 1)
+		d.metrics.setGauge(`vault_cluster_active{cluster="secondary"}`, 0)
+	}
+}
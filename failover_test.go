@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+func newFailoverDriver(t *testing.T) (*VaultDriver, *fakeVault, *fakeVault) {
+	primary := newFakeVault(t)
+	secondary := newFakeVault(t)
+	primary.setKV2("secret/data/app", map[string]interface{}{"value": "from-primary"})
+	secondary.setKV2("secret/data/app", map[string]interface{}{"value": "from-secondary"})
+
+	driver := &VaultDriver{
+		client:        primary.client(t),
+		secondary:     secondary.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	return driver, primary, secondary
+}
+
+func TestReadFailoverAndFailback(t *testing.T) {
+	driver, primary, _ := newFailoverDriver(t)
+	req := secrets.Request{SecretName: "app"}
+
+	if resp := driver.Get(req); string(resp.Value) != "from-primary" {
+		t.Fatalf("Expected primary value, got %q (err: %s)", resp.Value, resp.Err)
+	}
+
+	// Primary sealed: reads fail over to the secondary
+	primary.setStatus(http.StatusServiceUnavailable)
+	if resp := driver.Get(req); string(resp.Value) != "from-secondary" {
+		t.Fatalf("Expected secondary value after failover, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if driver.metrics.gauge(`vault_cluster_active{cluster="secondary"}`) != 1 {
+		t.Error("Expected secondary cluster to be reported active")
+	}
+	if driver.metrics.counter("vault_cluster_failovers_total") != 1 {
+		t.Errorf("Expected 1 failover, got %v", driver.metrics.counter("vault_cluster_failovers_total"))
+	}
+
+	// Primary recovers: reads fail back
+	primary.setStatus(0)
+	if resp := driver.Get(req); string(resp.Value) != "from-primary" {
+		t.Fatalf("Expected primary value after failback, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if driver.metrics.gauge(`vault_cluster_active{cluster="primary"}`) != 1 {
+		t.Error("Expected primary cluster to be reported active after failback")
+	}
+}
+
+func TestReadNoFailoverOnClientErrors(t *testing.T) {
+	driver, primary, secondary := newFailoverDriver(t)
+
+	// A permission error is a request problem, not a cluster outage
+	primary.setStatus(http.StatusForbidden)
+	if resp := driver.Get(secrets.Request{SecretName: "app"}); resp.Err == "" {
+		t.Fatal("Expected permission error to be returned")
+	}
+	if reads := secondary.readCount("secret/data/app"); reads != 0 {
+		t.Errorf("Expected no secondary reads, got %d", reads)
+	}
+}
+
+func TestReadFailoverFromHangingPrimary(t *testing.T) {
+	driver, _, _ := newFailoverDriver(t)
+
+	// The primary accepts connections but never answers
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(release) })
+	config := api.DefaultConfig()
+	config.Address = hanging.URL
+	config.MaxRetries = 0
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	driver.client = client
+	driver.config.GetTimeout = 500 * time.Millisecond
+
+	resp := driver.Get(secrets.Request{SecretName: "app"})
+	if string(resp.Value) != "from-secondary" {
+		t.Fatalf("Expected the secondary to answer within the timeout, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if driver.metrics.counter("vault_cluster_failovers_total") != 1 {
+		t.Errorf("Expected 1 failover, got %v", driver.metrics.counter("vault_cluster_failovers_total"))
+	}
+}
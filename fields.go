@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultJoinSeparator separates joined fields when vault_field_separator is unset
+const defaultJoinSeparator = ":"
+
+// parseFieldJoin returns the fields listed in the vault_field_join label and
+// the separator to join them with, or nil when the label is unset
+func parseFieldJoin(req secrets.Request) ([]string, string) {
+	fields := parseList(req.SecretLabels["vault_field_join"])
+	if len(fields) == 0 {
+		return nil, ""
+	}
+	separator, exists := req.SecretLabels["vault_field_separator"]
+	if !exists {
+		separator = defaultJoinSeparator
+	}
+	return fields, separator
+}
+
+// joinFields joins the values of several fields, e.g. "username,password"
+// into "app:s3cret". Every field must be present.
+func joinFields(data map[string]interface{}, fields []string, separator string) ([]byte, error) {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		value, ok := data[field]
+		if !ok {
+			return nil, fmt.Errorf("field %s not found in secret", field)
+		}
+		values[i] = fmt.Sprintf("%v", value)
+	}
+	return []byte(strings.Join(values, separator)), nil
+}
+
+// pemBundle concatenates PEM-encoded fields, e.g. "tls.crt,tls.key", into one
+// value with each block on its own lines. Every field must hold PEM data.
+func pemBundle(data map[string]interface{}, fields []string) ([]byte, error) {
+	var bundle []byte
+	for _, field := range fields {
+		value, ok := data[field]
+		if !ok {
+			return nil, fmt.Errorf("field %s not found in secret", field)
+		}
+		block := []byte(strings.TrimSpace(fmt.Sprintf("%v", value)))
+		if decoded, _ := pem.Decode(block); decoded == nil {
+			return nil, fmt.Errorf("field %s is not PEM encoded", field)
+		}
+		bundle = append(append(bundle, block...), '\n')
+	}
+	return bundle, nil
+}
+
+// trackedValue extracts the value of a tracked secret from freshly read data,
+// using the same field selection as the original request
+func (d *VaultDriver) trackedValue(secretInfo *SecretInfo, data map[string]interface{}) ([]byte, error) {
+	var value []byte
+	if secretInfo.Format == formatProperties {
+		file, err := propertiesFile(data, d.config.ExcludeFields)
+		if err != nil {
+			return nil, err
+		}
+		value = file
+	} else if secretInfo.PEMBundle {
+		bundle, err := pemBundle(data, secretInfo.JoinFields)
+		if err != nil {
+			return nil, err
+		}
+		value = bundle
+	} else if len(secretInfo.JoinFields) > 0 {
+		joined, err := joinFields(data, secretInfo.JoinFields, secretInfo.JoinSeparator)
+		if err != nil {
+			return nil, err
+		}
+		value = joined
+	} else {
+		selected, _, err := d.selectField(data, secretInfo.VaultField)
+		if err != nil {
+			return nil, err
+		}
+		value = selected
+	}
+	if secretInfo.JSONPath != "" && secretInfo.Format == "" {
+		selected, err := selectJSONPath(value, secretInfo.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+		value = selected
+	}
+	return applyTrailingNewline(value, secretInfo.TrailingNewline), nil
+}
+
+// checkBlankValue returns an error for an empty or whitespace-only value when
+// VAULT_REJECT_BLANK is set, logging the rejection
+func (d *VaultDriver) checkBlankValue(secretName, path string, value []byte) error {
+	if !d.config.RejectBlank || len(bytes.TrimSpace(value)) > 0 {
+		return nil
+	}
+	d.metrics.inc("vault_blank_values_rejected_total")
+	log.Warnf("Rejected blank value for secret %s at path %s", secretName, path)
+	return fmt.Errorf("value of secret %s is blank", secretName)
+}
+
+// selectJSONPath parses value as JSON and selects a dot-separated path in it,
+// e.g. "db.hosts.0", for fields holding stringified JSON. Strings are returned
+// as is and other values as JSON.
+func selectJSONPath(value []byte, path string) ([]byte, error) {
+	var current interface{}
+	if err := json.Unmarshal(value, &current); err != nil {
+		return nil, fmt.Errorf("field value is not valid JSON: %v", err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("JSON path %s not found: no key %q", path, key)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("JSON path %s not found: no index %q", path, key)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("JSON path %s not found: %q is not an object or array", path, key)
+		}
+	}
+	if str, ok := current.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(current)
+}
+
+// watchedInput returns what the change-detection hash is computed over: the
+// value itself, or the watched fields from the vault_watch_fields label so
+// churn in other fields (e.g. an injected last_accessed timestamp) is ignored
+func watchedInput(watchFields []string, data map[string]interface{}, value []byte) []byte {
+	if len(watchFields) == 0 {
+		return value
+	}
+	watched := make(map[string]interface{}, len(watchFields))
+	for _, field := range watchFields {
+		if fieldValue, ok := data[field]; ok {
+			watched[field] = fieldValue
+		}
+	}
+	encoded, _ := json.Marshal(watched) // map keys are sorted, so the encoding is stable
+	return encoded
+}
+
+// Policies for VAULT_EXTRACTION_FALLBACK when neither an explicit nor a
+// default field matches
+const (
+	fallbackFirstString = "first-string" // the first string field
+	fallbackRaw         = "raw"          // the whole secret data as JSON
+	fallbackError       = "error"        // fail the request
+)
+
+// parseExtractionFallback validates a VAULT_EXTRACTION_FALLBACK value,
+// defaulting to first-string
+func parseExtractionFallback(value string) string {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	switch policy {
+	case fallbackFirstString, fallbackRaw, fallbackError:
+		return policy
+	}
+	log.Warnf("Invalid extraction fallback %q, using %s", value, fallbackFirstString)
+	return fallbackFirstString
+}
+
+// extractionFallback picks a value from data that has no explicit or default
+// field, following VAULT_EXTRACTION_FALLBACK, and describes the choice
+func (d *VaultDriver) extractionFallback(data map[string]interface{}) ([]byte, string, error) {
+	switch d.config.FallbackPolicy {
+	case fallbackError:
+		return nil, "", fmt.Errorf("no explicit or default field found in secret, set vault_field")
+	case fallbackRaw:
+		fields := make(map[string]interface{}, len(data))
+		for field, value := range data {
+			if !d.config.ExcludeFields[field] {
+				fields[field] = value
+			}
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to encode secret data: %v", err)
+		}
+		return raw, "returning the raw data", nil
+	}
+
+	// Fields are tried in sorted order so every read picks the same one
+	names := make([]string, 0, len(data))
+	for field := range data {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	for _, field := range names {
+		if d.config.ExcludeFields[field] {
+			continue
+		}
+		if strValue, ok := data[field].(string); ok {
+			return []byte(strValue), fmt.Sprintf("falling back to field %q", field), nil
+		}
+	}
+	return nil, "", fmt.Errorf("no suitable secret value found")
+}
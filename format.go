@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// formatProperties serializes every field of a secret as a Java .properties
+// file, selected with vault_format=properties
+const formatProperties = "properties"
+
+// parseFormat validates the vault_format label. An empty value keeps the usual
+// single-value extraction.
+func parseFormat(label string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(label)); format {
+	case "", formatProperties:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported vault_format %q", label)
+}
+
+// propertiesFile renders secret data as sorted key=value lines, leaving out the
+// fields in exclude. Nested objects and arrays are flattened into dotted keys,
+// e.g. "db.hosts.0"; two fields flattening to the same key are an error.
+func propertiesFile(data map[string]interface{}, exclude map[string]bool) ([]byte, error) {
+	fields := make(map[string]interface{}, len(data))
+	for field, value := range data {
+		if !exclude[field] {
+			fields[field] = value
+		}
+	}
+	flat := make(map[string]string)
+	if err := flattenProperties("", fields, flat); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var file strings.Builder
+	for _, key := range keys {
+		file.WriteString(escapeProperty(key, true))
+		file.WriteByte('=')
+		file.WriteString(escapeProperty(flat[key], false))
+		file.WriteByte('\n')
+	}
+	return []byte(file.String()), nil
+}
+
+// flattenProperties adds the leaves of value to flat under dotted keys
+func flattenProperties(prefix string, value interface{}, flat map[string]string) error {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch node := value.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if err := flattenProperties(join(key), child, flat); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for i, child := range node {
+			if err := flattenProperties(join(strconv.Itoa(i)), child, flat); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// A key like "a.b" and a nested {"a": {"b": ...}} would otherwise take
+	// turns winning with map iteration order
+	if _, exists := flat[prefix]; exists {
+		return fmt.Errorf("properties key %q is produced by more than one field", prefix)
+	}
+	if value == nil {
+		flat[prefix] = ""
+	} else {
+		flat[prefix] = fmt.Sprintf("%v", value)
+	}
+	return nil
+}
+
+// escapeProperty escapes a key or value the way java.util.Properties.store
+// does: separators, comment characters and backslashes get a backslash,
+// control characters their escape sequence and non-ASCII characters \uXXXX.
+// Spaces are escaped everywhere in keys but only at the start of values.
+func escapeProperty(s string, isKey bool) string {
+	var escaped strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\', ':', '=', '#', '!':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				escaped.WriteByte('\\')
+			}
+			escaped.WriteByte(' ')
+		case '\t':
+			escaped.WriteString(`\t`)
+		case '\n':
+			escaped.WriteString(`\n`)
+		case '\r':
+			escaped.WriteString(`\r`)
+		case '\f':
+			escaped.WriteString(`\f`)
+		default:
+			if r < 0x20 || r > 0x7e {
+				for _, unit := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&escaped, `\u%04X`, unit)
+				}
+			} else {
+				escaped.WriteRune(r)
+			}
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestPropertiesEscaping(t *testing.T) {
+	cases := []struct {
+		key, value, expected string
+	}{
+		{"url", "jdbc:postgresql://db:5432/app?ssl=true", `url=jdbc\:postgresql\://db\:5432/app?ssl\=true`},
+		{"my key", " padded value", `my\ key=\ padded value`},
+		{"a=b:c", "x", `a\=b\:c=x`},
+		{"comment", "#!not a comment", `comment=\#\!not a comment`},
+		{"path", `C:\temp`, `path=C\:\\temp`},
+		{"multi", "line1\nline2\ttab", `multi=line1\nline2\ttab`},
+		{"name", "café", `name=caf\u00E9`},
+		{"emoji", "😀", `emoji=\uD83D\uDE00`},
+	}
+	for _, c := range cases {
+		got, err := propertiesFile(map[string]interface{}{c.key: c.value}, nil)
+		if err != nil || string(got) != c.expected+"\n" {
+			t.Errorf("Expected %q, got %q (%v)", c.expected+"\n", got, err)
+		}
+	}
+}
+
+func TestPropertiesFlattening(t *testing.T) {
+	data := map[string]interface{}{
+		"user": "app",
+		"db": map[string]interface{}{
+			"port":  5432,
+			"hosts": []interface{}{"a", "b"},
+			"tls":   map[string]interface{}{"enabled": true},
+		},
+		"empty": nil,
+	}
+	expected := "db.hosts.0=a\ndb.hosts.1=b\ndb.port=5432\ndb.tls.enabled=true\nempty=\nuser=app\n"
+	if got, err := propertiesFile(data, nil); err != nil || string(got) != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, got, err)
+	}
+
+	// Excluded fields are left out
+	if got, err := propertiesFile(data, map[string]bool{"db": true, "empty": true}); err != nil || string(got) != "user=app\n" {
+		t.Errorf("Expected excluded fields to be left out, got %q (%v)", got, err)
+	}
+}
+
+func TestPropertiesKeyCollision(t *testing.T) {
+	data := map[string]interface{}{
+		"a.b": "x",
+		"a":   map[string]interface{}{"b": "y"},
+	}
+	// Map iteration order varies, so check repeatedly
+	for i := 0; i < 20; i++ {
+		if _, err := propertiesFile(data, nil); err == nil {
+			t.Fatal("Expected an error for colliding keys")
+		}
+	}
+	// Excluding one of the colliding fields resolves it
+	if got, err := propertiesFile(data, map[string]bool{"a.b": true}); err != nil || string(got) != "a.b=y\n" {
+		t.Errorf("Expected a.b=y, got %q (%v)", got, err)
+	}
+}
+
+func TestPropertiesFormatLabel(t *testing.T) {
+	driver := &VaultDriver{config: &VaultConfig{}, metrics: newDriverMetrics()}
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"username": "app", "password": "p=1"},
+	}}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_format": "properties", "vault_field": "password"}}
+	value, err := driver.extractSecretValue(secret, req)
+	if err != nil || string(value) != "password=p\\=1\nusername=app\n" {
+		t.Errorf("Expected every field as properties, got %q (%v)", value, err)
+	}
+
+	// Rotation renders the tracked secret the same way
+	secretInfo := &SecretInfo{VaultField: "password", Format: formatProperties}
+	data, _ := secretFields(secret)
+	if rotated, err := driver.trackedValue(secretInfo, data); err != nil || string(rotated) != string(value) {
+		t.Errorf("Expected tracked value %q, got %q (%v)", value, rotated, err)
+	}
+
+	req.SecretLabels["vault_format"] = "yaml"
+	if _, err := driver.extractSecretValue(secret, req); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Change-detection hash algorithms for VAULT_HASH_ALGO
+const (
+	hashSHA256 = "sha256"
+	hashSHA512 = "sha512"
+	hashXXHash = "xxhash" // non-cryptographic, cheaper for large secrets
+)
+
+// parseHashAlgo validates a VAULT_HASH_ALGO value, defaulting to sha256
+func parseHashAlgo(value string) string {
+	algo := strings.ToLower(strings.TrimSpace(value))
+	switch algo {
+	case hashSHA256, hashSHA512, hashXXHash:
+		return algo
+	}
+	log.Warnf("Invalid hash algorithm %q, using %s", value, hashSHA256)
+	return hashSHA256
+}
+
+// hashValue hashes a secret value for change detection. SHA-256 hashes are
+// plain hex as before; other algorithms are prefixed with their name so a hash
+// computed with a different algorithm is never mistaken for a changed value.
+func hashValue(algo string, value []byte) string {
+	switch algo {
+	case hashSHA512:
+		return fmt.Sprintf("%s:%x", hashSHA512, sha512.Sum512(value))
+	case hashXXHash:
+		return fmt.Sprintf("%s:%016x", hashXXHash, xxhash.Sum64(value))
+	default:
+		return fmt.Sprintf("%x", sha256.Sum256(value))
+	}
+}
+
+// hashAlgoOf returns the algorithm a hash produced by hashValue was computed with
+func hashAlgoOf(hash string) string {
+	if algo, _, found := strings.Cut(hash, ":"); found {
+		return algo
+	}
+	return hashSHA256
+}
+
+// recordValueHash remembers the hash of the value first served for a tracked
+// secret, so a rotation to identical bytes can be skipped. Services started
+// before a later request keep the first value until a rotation replaces it,
+// so only rotations update the hash from then on.
+func (d *VaultDriver) recordValueHash(secretName string, value []byte) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo, exists := d.secretTracker[secretName]; exists && secretInfo.ValueHash == "" && secretInfo.CurrentSecretName == secretName {
+		secretInfo.ValueHash = hashValue(d.config.HashAlgo, value)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestHashValue(t *testing.T) {
+	for _, algo := range []string{hashSHA256, hashSHA512, hashXXHash} {
+		a := hashValue(algo, []byte("secret"))
+		if a != hashValue(algo, []byte("secret")) {
+			t.Errorf("%s: expected stable hash", algo)
+		}
+		if a == hashValue(algo, []byte("other")) {
+			t.Errorf("%s: expected different hashes for different values", algo)
+		}
+		if hashAlgoOf(a) != algo {
+			t.Errorf("%s: hash %q reported as %s", algo, a, hashAlgoOf(a))
+		}
+	}
+}
+
+func TestChangeDetectionPerAlgorithm(t *testing.T) {
+	for _, algo := range []string{hashSHA256, hashSHA512, hashXXHash} {
+		t.Run(algo, func(t *testing.T) {
+			fv := newFakeVault(t)
+			fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+			driver := &VaultDriver{
+				client:        fv.client(t),
+				config:        &VaultConfig{HashAlgo: algo},
+				secretTracker: make(map[string]*SecretInfo),
+			}
+			secretInfo := &SecretInfo{
+				DockerSecretName: "db",
+				VaultPath:        "secret/data/db",
+				VaultField:       "password",
+				LastHash:         hashValue(algo, []byte("v1")),
+			}
+
+			if driver.hasSecretChanged(secretInfo) {
+				t.Error("Expected unchanged secret")
+			}
+			fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+			if !driver.hasSecretChanged(secretInfo) {
+				t.Error("Expected changed secret")
+			}
+		})
+	}
+}
+
+func TestChangeDetectionAfterAlgorithmSwitch(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{HashAlgo: hashXXHash},
+		secretTracker: make(map[string]*SecretInfo),
+	}
+	secretInfo := &SecretInfo{
+		DockerSecretName: "db",
+		VaultPath:        "secret/data/db",
+		VaultField:       "password",
+		LastHash:         hashValue(hashSHA256, []byte("v1")),
+	}
+
+	// The stored SHA-256 hash is replaced rather than reported as a change
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Switching algorithms must not be reported as a change")
+	}
+	if secretInfo.LastHash != hashValue(hashXXHash, []byte("v1")) {
+		t.Errorf("Expected stored hash to be recomputed, got %q", secretInfo.LastHash)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	if !driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected changed secret after rehashing")
+	}
+}
+
+func TestChangeDetectionWatchFields(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1", "version": "1", "last_accessed": "t1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password", "vault_watch_fields": "password,version"}}
+	if resp := driver.Get(req); resp.Err != "" || string(resp.Value) != "v1" {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	secretInfo := driver.secretTracker["db"]
+
+	// Churn in an ignored field
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1", "version": "1", "last_accessed": "t2"})
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected a change of an ignored field not to trigger rotation")
+	}
+
+	// A watched field other than the returned one
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1", "version": "2", "last_accessed": "t3"})
+	if !driver.hasSecretChanged(secretInfo) {
+		t.Fatal("Expected a change of a watched field to trigger rotation")
+	}
+	if _, err := driver.rotateSecret(secretInfo); err != nil {
+		t.Fatalf("Unexpected rotation error: %v", err)
+	}
+
+	// The rotation stored the hash of the watched fields
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1", "version": "2", "last_accessed": "t4"})
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected no change after rotating to the watched values")
+	}
+}
+
+func TestRotationSkippedForIdenticalValue(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p", "version": "1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, HistorySize: 10},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		history:       newRotationHistory(10),
+		metrics:       newDriverMetrics(),
+	}
+	// The check fires on the version field, which isn't part of the value
+	labels := map[string]string{"vault_field": "password", "vault_watch_fields": "password,version"}
+	if resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: labels}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p", "version": "2"})
+	summary := driver.checkForSecretChanges()
+	if summary.Changed != 1 {
+		t.Fatalf("Expected the watched field change to be detected, got %+v", summary)
+	}
+	if name := driver.secretTracker["db"].CurrentSecretName; name != "db" {
+		t.Errorf("Expected no new version for an identical value, got %s", name)
+	}
+	if count := driver.metrics.counter(`vault_rotations_total{result="skipped"}`); count != 1 {
+		t.Errorf("Expected 1 skipped rotation, got %v", count)
+	}
+	if history := driver.RotationHistory(); len(history) != 1 || !history[0].Skipped || !history[0].Success {
+		t.Errorf("Expected a successful skipped record, got %+v", history)
+	}
+	// The new metadata is taken as the baseline, so the next sweep is quiet
+	if summary := driver.checkForSecretChanges(); summary.Changed != 0 {
+		t.Errorf("Expected no further change, got %+v", summary)
+	}
+
+	// A changed value still rotates
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "q", "version": "3"})
+	driver.checkForSecretChanges()
+	if name := driver.secretTracker["db"].CurrentSecretName; name == "db" {
+		t.Error("Expected a new version for a changed value")
+	}
+
+	// Serving the original secret after the rotation doesn't replace the hash
+	// of the value the current version holds
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "r", "version": "4"})
+	if resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: labels}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	result, err := driver.rotateSecret(driver.secretTracker["db"])
+	if err != nil || result.Skipped {
+		t.Errorf("Expected the changed value to be rotated, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RotationRecord describes the outcome of a single rotation. It never contains secret values.
+type RotationRecord struct {
+	SecretName string    `json:"secret"`
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Services   []string  `json:"services,omitempty"`
+	OldHash    string    `json:"old_hash,omitempty"` // hash prefix only
+	NewHash    string    `json:"new_hash,omitempty"` // hash prefix only
+	Skipped    bool      `json:"skipped,omitempty"`  // the value was unchanged, no version was created
+
+	UpdatedServices []string `json:"updated_services,omitempty"` // moved to the new version
+	FailedServices  []string `json:"failed_services,omitempty"`  // whose update failed
+	NewSecretName   string   `json:"new_secret,omitempty"`       // Docker secret created by the rotation
+	DurationSeconds float64  `json:"duration_seconds"`
+
+	Aliases       []AliasResult `json:"aliases,omitempty"`        // outcome of each alias, from the vault_aliases label
+	FailedAliases []string      `json:"failed_aliases,omitempty"` // aliases left on the old value, retried by the next sweep
+}
+
+// RotationResult is what a rotation changed, returned by rotateSecret even
+// when it fails part way. It never contains secret values.
+type RotationResult struct {
+	SecretName      string
+	NewSecretName   string // Docker secret created by the rotation, empty if none
+	NewSecretID     string
+	UpdatedServices []string // moved to the new version
+	FailedServices  []string // whose update failed
+	OldHash         string   // hash prefix only
+	NewHash         string   // hash prefix only
+	Skipped         bool     // the value was unchanged, no version was created
+	Duration        time.Duration
+	Aliases         []AliasResult // outcome of each alias
+	FailedAliases   []string      // aliases whose sync failed; the rotation itself still succeeded
+}
+
+// record converts a result to a history record. services are the services
+// tracked as using the secret when the rotation started.
+func (r RotationResult) record(start time.Time, services []string, err error) RotationRecord {
+	record := RotationRecord{
+		SecretName:      r.SecretName,
+		Time:            start,
+		Success:         err == nil,
+		Services:        services,
+		OldHash:         r.OldHash,
+		NewHash:         r.NewHash,
+		Skipped:         r.Skipped,
+		UpdatedServices: r.UpdatedServices,
+		FailedServices:  r.FailedServices,
+		NewSecretName:   r.NewSecretName,
+		DurationSeconds: r.Duration.Seconds(),
+		Aliases:         r.Aliases,
+		FailedAliases:   r.FailedAliases,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// rotationHistory is a bounded ring buffer of recent rotation records
+type rotationHistory struct {
+	mutex   sync.Mutex
+	records []RotationRecord
+	next    int
+	full    bool
+}
+
+// newRotationHistory creates a history holding at most size records
+func newRotationHistory(size int) *rotationHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &rotationHistory{records: make([]RotationRecord, size)}
+}
+
+// add appends a record, overwriting the oldest one when the buffer is full
+func (h *rotationHistory) add(record RotationRecord) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the recorded rotations, oldest first
+func (h *rotationHistory) list() []RotationRecord {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.full {
+		return append([]RotationRecord(nil), h.records[:h.next]...)
+	}
+	result := make([]RotationRecord, 0, len(h.records))
+	result = append(result, h.records[h.next:]...)
+	return append(result, h.records[:h.next]...)
+}
+
+// hashPrefix shortens a hash for display so full hashes are never exposed
+func hashPrefix(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// RotationHistory returns the most recent rotations, oldest first
+func (d *VaultDriver) RotationHistory() []RotationRecord {
+	return d.history.list()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestRotationHistoryCapped(t *testing.T) {
+	history := newRotationHistory(3)
+
+	if records := history.list(); len(records) != 0 {
+		t.Fatalf("Expected empty history, got %d records", len(records))
+	}
+
+	for i := 0; i < 5; i++ {
+		history.add(RotationRecord{SecretName: fmt.Sprintf("secret-%d", i), Success: true})
+	}
+
+	records := history.list()
+	if len(records) != 3 {
+		t.Fatalf("Expected history capped at 3 records, got %d", len(records))
+	}
+	for i, expected := range []string{"secret-2", "secret-3", "secret-4"} {
+		if records[i].SecretName != expected {
+			t.Errorf("Expected record %d to be %s, got %s", i, expected, records[i].SecretName)
+		}
+	}
+}
+
+func TestRotationHistoryAppends(t *testing.T) {
+	history := newRotationHistory(10)
+	history.add(RotationRecord{SecretName: "a", Success: true, OldHash: hashPrefix("0123456789abcdef0123")})
+	history.add(RotationRecord{SecretName: "b", Error: "boom"})
+
+	records := history.list()
+	if len(records) != 2 || records[0].SecretName != "a" || records[1].SecretName != "b" {
+		t.Fatalf("Expected records a, b in order, got %+v", records)
+	}
+	if records[0].OldHash != "0123456789ab" {
+		t.Errorf("Expected hash prefix to be truncated, got %s", records[0].OldHash)
+	}
+}
+
+func TestRotationHistoryDisabled(t *testing.T) {
+	history := newRotationHistory(0)
+	history.add(RotationRecord{SecretName: "a"})
+	if records := history.list(); records != nil {
+		t.Errorf("Expected no records when history is disabled, got %v", records)
+	}
+}
+
+func TestRotationResult(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+	fd.addService("svc-2", "api", "db")
+	clock := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		history:       newRotationHistory(10),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "db", ServiceName: "web", SecretLabels: map[string]string{"vault_field": "password", "vault_path": "db"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	oldHash := hashPrefix(driver.secretTracker["db"].LastHash)
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	result, err := driver.rotateSecret(driver.secretTracker["db"])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	created := fd.secretByName(result.NewSecretName)
+	if created == nil || created.ID != result.NewSecretID {
+		t.Errorf("Expected the new secret %s with ID %s, got %+v", result.NewSecretName, result.NewSecretID, created)
+	}
+	if !reflect.DeepEqual(result.UpdatedServices, []string{"web", "api"}) {
+		t.Errorf("Expected both services to be updated, got %v", result.UpdatedServices)
+	}
+	if result.OldHash != oldHash || result.NewHash == "" || result.NewHash == oldHash || len(result.NewHash) > 12 {
+		t.Errorf("Expected hash prefixes %s -> new, got %s -> %s", oldHash, result.OldHash, result.NewHash)
+	}
+
+	// The same result feeds the history and the duration histogram
+	records := driver.RotationHistory()
+	if len(records) != 1 || records[0].NewSecretName != result.NewSecretName || !reflect.DeepEqual(records[0].UpdatedServices, result.UpdatedServices) {
+		t.Errorf("Expected the result in the history, got %+v", records)
+	}
+	if count := driver.metrics.counter(`vault_rotation_duration_seconds_count{result="success"}`); count != 1 {
+		t.Errorf("Expected one observed rotation duration, got %v", count)
+	}
+
+	// An unchanged value is reported as skipped
+	result, err = driver.rotateSecret(driver.secretTracker["db"])
+	if err != nil || !result.Skipped || result.NewSecretName != "" {
+		t.Errorf("Expected a skipped rotation, got %+v (%v)", result, err)
+	}
+}
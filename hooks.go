@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// hookPath is the PATH given to rotation hooks. Hooks never inherit the plugin
+// environment, which holds Vault credentials.
+const hookPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// runRotationHook runs a hook command through /bin/sh with the secret name and
+// services, plus any extraEnv entries, passed as environment variables. Secret
+// values are never passed.
+func runRotationHook(command string, timeout time.Duration, secretName string, services []string, extraEnv ...string) error {
+	if command == "" {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = []string{
+		"PATH=" + hookPath,
+		"VAULT_SECRET_NAME=" + secretName,
+		"VAULT_SECRET_SERVICES=" + strings.Join(services, ","),
+	}
+	cmd.Env = append(cmd.Env, extraEnv...)
+	// Don't wait on children of a killed hook that still hold the output pipe
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook timed out after %v", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("hook failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
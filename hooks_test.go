@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRotationHookEnvironment(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "must-not-leak")
+	out := filepath.Join(t.TempDir(), "env")
+
+	err := runRotationHook("env > "+out, time.Second, "db_password", []string{"web", "api"}, "VAULT_SECRET_NEW_NAME=db_password-1")
+	if err != nil {
+		t.Fatalf("Unexpected hook error: %v", err)
+	}
+
+	env, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(env), "VAULT_SECRET_NAME=db_password") {
+		t.Errorf("Expected secret name in hook env, got %s", env)
+	}
+	if !strings.Contains(string(env), "VAULT_SECRET_SERVICES=web,api") {
+		t.Errorf("Expected services in hook env, got %s", env)
+	}
+	if !strings.Contains(string(env), "VAULT_SECRET_NEW_NAME=db_password-1") {
+		t.Errorf("Expected extra variables in hook env, got %s", env)
+	}
+	if strings.Contains(string(env), "must-not-leak") {
+		t.Error("Plugin environment leaked into hook")
+	}
+}
+
+func TestRunRotationHookFailures(t *testing.T) {
+	if err := runRotationHook("", time.Second, "db_password", nil); err != nil {
+		t.Errorf("Expected empty hook to be a no-op, got %v", err)
+	}
+	if err := runRotationHook("echo nope; exit 3", time.Second, "db_password", nil); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected failing hook error with output, got %v", err)
+	}
+	if err := runRotationHook("sleep 5", 50*time.Millisecond, "db_password", nil); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected hook timeout, got %v", err)
+	}
+}
+
+func TestPreRotationHookAbortsRotation(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "new"})
+
+	marker := filepath.Join(t.TempDir(), "post-hook-ran")
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			PreRotationHook:  "exit 1",
+			PostRotationHook: "touch " + marker,
+			HookTimeout:      time.Second,
+		},
+		secretTracker: make(map[string]*SecretInfo),
+		history:       newRotationHistory(10),
+	}
+	secretInfo := &SecretInfo{
+		DockerSecretName:  "db",
+		CurrentSecretName: "db",
+		VaultPath:         "secret/data/db",
+		VaultField:        "password",
+		LastHash:          "old",
+	}
+
+	// The Docker client is nil, so reaching the Docker update would panic
+	_, err := driver.rotateSecret(secretInfo)
+	if err == nil || !strings.Contains(err.Error(), "pre-rotation hook") {
+		t.Fatalf("Expected pre-rotation hook error, got %v", err)
+	}
+	if secretInfo.LastHash != "old" {
+		t.Error("Expected tracked hash to be unchanged after aborted rotation")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Post-rotation hook must not run for an aborted rotation")
+	}
+	if records := driver.RotationHistory(); len(records) != 1 || records[0].Success {
+		t.Errorf("Expected one failed history record, got %+v", records)
+	}
+}
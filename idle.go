@@ -0,0 +1,27 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkEmptyTracker warns once when no secret has been tracked for longer
+// than VAULT_EMPTY_TRACKER_WARN, which usually means no service uses the
+// plugin and rotation is idle. It is called from the monitor on every sweep.
+func (d *VaultDriver) checkEmptyTracker(tracked int, now time.Time) {
+	if tracked > 0 {
+		d.emptySince = time.Time{}
+		d.emptyWarned = false
+		return
+	}
+	if d.emptySince.IsZero() {
+		d.emptySince = now
+	}
+	if d.config.EmptyTrackerWarn <= 0 || d.emptyWarned || now.Sub(d.emptySince) < d.config.EmptyTrackerWarn {
+		return
+	}
+	d.emptyWarned = true
+	d.metrics.inc("vault_tracker_empty_warnings_total")
+	log.Warnf("No secrets have been requested for %v, check that services use the vault driver", now.Sub(d.emptySince).Round(time.Second))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestEmptyTrackerWarning(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	clock := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, EmptyTrackerWarn: time.Hour},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	warnings := func() float64 { return driver.metrics.counter("vault_tracker_empty_warnings_total") }
+
+	driver.checkForSecretChanges()
+	clock.Advance(59 * time.Minute)
+	driver.checkForSecretChanges()
+	if warnings() != 0 {
+		t.Fatal("Expected no warning before the threshold")
+	}
+
+	clock.Advance(time.Minute)
+	driver.checkForSecretChanges()
+	if warnings() != 1 {
+		t.Fatalf("Expected a warning once the tracker was empty for an hour, got %v", warnings())
+	}
+	clock.Advance(time.Hour)
+	driver.checkForSecretChanges()
+	if warnings() != 1 {
+		t.Errorf("Expected a single warning per empty period, got %v", warnings())
+	}
+
+	// Tracking a secret ends the empty period
+	if resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	driver.checkForSecretChanges()
+	if !driver.emptySince.IsZero() || driver.emptyWarned {
+		t.Error("Expected the empty period to be reset once a secret is tracked")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxInfoServices caps the services listed in a tracked secret's info series
+const maxInfoServices = 5
+
+// setTrackedInfo exposes vault_tracked_secret_info with value 1 for a tracked
+// secret, replacing its previous series when the labels changed. Only names
+// and paths are exported, never values or hashes. The caller must hold
+// trackerMutex.
+func (d *VaultDriver) setTrackedInfo(secretInfo *SecretInfo) {
+	services := secretInfo.ServiceNames
+	if len(services) > maxInfoServices {
+		services = append(services[:maxInfoServices:maxInfoServices], fmt.Sprintf("+%d", len(secretInfo.ServiceNames)-maxInfoServices))
+	}
+	series := fmt.Sprintf(`vault_tracked_secret_info{secret=%q,path=%q,provider="vault",services=%q}`,
+		secretInfo.DockerSecretName, secretInfo.VaultPath, strings.Join(services, ","))
+	if secretInfo.infoSeries != series {
+		d.clearTrackedInfo(secretInfo)
+		secretInfo.infoSeries = series
+	}
+	d.metrics.setGauge(series, 1)
+}
+
+// clearTrackedInfo removes a secret's info series, e.g. when it is evicted.
+// The caller must hold trackerMutex.
+func (d *VaultDriver) clearTrackedInfo(secretInfo *SecretInfo) {
+	if secretInfo.infoSeries != "" {
+		d.metrics.deleteGauge(secretInfo.infoSeries)
+		secretInfo.infoSeries = ""
+	}
+}
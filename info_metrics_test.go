@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// infoSeries returns the vault_tracked_secret_info series of a driver
+func infoSeries(driver *VaultDriver) []string {
+	var series []string
+	for name, value := range driver.Metrics() {
+		if strings.HasPrefix(name, "vault_tracked_secret_info{") && value == 1 {
+			series = append(series, name)
+		}
+	}
+	return series
+}
+
+func TestTrackedSecretInfoMetric(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		config:        &VaultConfig{MaxTrackedSecrets: 3},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	track := func(name, service string) {
+		driver.trackSecret(secrets.Request{SecretName: name, ServiceName: service}, "secret/data/"+name, []byte("v"), false)
+		clock.Advance(time.Second)
+	}
+
+	track("db", "web")
+	track("api", "web")
+	track("db", "worker")
+	if series := infoSeries(driver); len(series) != 2 {
+		t.Fatalf("Expected one series per tracked secret, got %v", series)
+	}
+	expected := `vault_tracked_secret_info{secret="db",path="secret/data/db",provider="vault",services="web,worker"}`
+	if driver.metrics.gauge(expected) != 1 {
+		t.Errorf("Expected %s, got %v", expected, infoSeries(driver))
+	}
+
+	// Long service lists are capped
+	for _, service := range []string{"a", "b", "c", "d", "e"} {
+		track("api", service)
+	}
+	capped := `vault_tracked_secret_info{secret="api",path="secret/data/api",provider="vault",services="web,a,b,c,d,+1"}`
+	if driver.metrics.gauge(capped) != 1 {
+		t.Errorf("Expected %s, got %v", capped, infoSeries(driver))
+	}
+
+	// Evicted secrets lose their series
+	track("cache", "web")
+	track("queue", "web")
+	series := infoSeries(driver)
+	if len(series) != 3 {
+		t.Fatalf("Expected one series per tracked secret after eviction, got %v", series)
+	}
+	for _, name := range series {
+		if strings.Contains(name, `secret="db"`) {
+			t.Errorf("Expected the evicted secret's series to be removed, got %v", series)
+		}
+	}
+}
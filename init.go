@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Behaviours for VAULT_INIT_FAILURE when authentication fails at startup
+const (
+	initFailureFail    = "fail"    // refuse to start
+	initFailureDegrade = "degrade" // start, fail requests and retry in the background
+)
+
+// Waits between authentication retries while degraded, doubling up to the max
+const (
+	initRetryInterval = time.Second
+	initRetryMax      = time.Minute
+)
+
+// parseInitFailure validates a VAULT_INIT_FAILURE value, defaulting to fail
+func parseInitFailure(value string) string {
+	mode := strings.ToLower(strings.TrimSpace(value))
+	switch mode {
+	case initFailureFail, initFailureDegrade:
+		return mode
+	}
+	log.Warnf("Invalid init failure mode %q, using %s", value, initFailureFail)
+	return initFailureFail
+}
+
+// setDegraded marks whether the driver is waiting for Vault authentication
+func (d *VaultDriver) setDegraded(degraded bool) {
+	d.degraded.Store(degraded)
+	ready := 1.0
+	if degraded {
+		ready = 0
+	}
+	d.metrics.setGauge("vault_ready", ready)
+}
+
+// Ready reports whether the driver authenticated with Vault and serves secrets
+func (d *VaultDriver) Ready() bool {
+	return !d.degraded.Load()
+}
+
+// retryAuthentication retries authenticating with Vault until it succeeds or
+// ctx is done, then finishes starting the driver
+func (d *VaultDriver) retryAuthentication(ctx context.Context, interval time.Duration) {
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := d.authenticate(d.client); err != nil {
+			d.metrics.inc("vault_init_retries_total")
+			interval = min(interval*2, initRetryMax)
+			log.Warnf("Vault authentication still failing, retrying in %v: %v", interval, err)
+			continue
+		}
+		log.Printf("Successfully authenticated with Vault using %s method, leaving degraded mode", d.config.AuthMethod)
+		d.setDegraded(false)
+		d.start()
+		return
+	}
+}
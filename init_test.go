@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestDegradedStartRetriesAuthentication(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	fv.setStatus(http.StatusServiceUnavailable)
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", AuthMethod: "approle", RoleID: "role", SecretID: "secret", InitFailure: initFailureDegrade},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	if err := driver.authenticate(driver.client); err == nil {
+		t.Fatal("Expected authentication to fail while Vault is unavailable")
+	}
+	driver.setDegraded(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go driver.retryAuthentication(ctx, 5*time.Millisecond)
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err == "" {
+		t.Error("Expected requests to fail while degraded")
+	}
+	for deadline := time.Now().Add(2 * time.Second); driver.metrics.counter("vault_init_retries_total") == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected authentication to be retried")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	fv.setStatus(0)
+	for deadline := time.Now().Add(2 * time.Second); !driver.Ready(); {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the driver to become ready once Vault is available")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ready := driver.metrics.gauge("vault_ready"); ready != 1 {
+		t.Errorf("Expected vault_ready to be 1, got %v", ready)
+	}
+	if resp := driver.Get(req); resp.Err != "" || string(resp.Value) != "p" {
+		t.Errorf("Expected the secret once ready, got %q (%s)", resp.Value, resp.Err)
+	}
+}
+
+func TestParseInitFailure(t *testing.T) {
+	for value, expected := range map[string]string{"degrade": initFailureDegrade, " FAIL ": initFailureFail, "bogus": initFailureFail} {
+		if mode := parseInitFailure(value); mode != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, value, mode)
+		}
+	}
+}
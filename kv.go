@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSecretDeleted is returned when the current KV v2 version of a secret has
+// been soft-deleted or destroyed
+var ErrSecretDeleted = errors.New("secret version has been deleted")
+
+// checkSecretDeleted returns an error wrapping ErrSecretDeleted when a KV v2
+// read returned a deleted or destroyed version, i.e. no data but metadata
+// recording the deletion
+func checkSecretDeleted(secret *api.Secret) error {
+	if data, ok := secret.Data["data"]; !ok || data != nil {
+		return nil
+	}
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	if destroyed, _ := metadata["destroyed"].(bool); destroyed {
+		return fmt.Errorf("%w: version %v was destroyed", ErrSecretDeleted, metadata["version"])
+	}
+	if deletionTime, _ := metadata["deletion_time"].(string); deletionTime != "" {
+		return fmt.Errorf("%w: version %v was deleted at %s", ErrSecretDeleted, metadata["version"], deletionTime)
+	}
+	return nil
+}
+
+// secretFields returns the fields of a read secret. KV v2 nests them under
+// "data", next to "metadata"; a KV v2 response whose "data" isn't an object
+// is an error rather than a panic. Without metadata the response is KV v1,
+// where "data" is an ordinary field.
+func secretFields(secret *api.Secret) (map[string]interface{}, error) {
+	value, exists := secret.Data["data"]
+	if !exists {
+		return secret.Data, nil
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		return fields, nil
+	}
+	if _, isKV2 := secret.Data["metadata"].(map[string]interface{}); isKV2 {
+		return nil, fmt.Errorf("unexpected KV v2 response: data is %T, not an object", value)
+	}
+	return secret.Data, nil
+}
+
+// errNotFoundPrefix starts every Get error for a secret that doesn't exist.
+// The plugin protocol has no status codes, so this prefix is the stable
+// signal that the failure is permanent and retrying won't help.
+const errNotFoundPrefix = "secret not found:"
+
+// Reasons reported in not-found errors
+const (
+	notFoundMissing = "missing" // nothing stored at the path
+	notFoundDeleted = "deleted" // the current KV v2 version was deleted or destroyed
+)
+
+// notFoundResponse returns the Get response for a missing secret, formatted as
+// "secret not found: name=<secret> path=<vault path> reason=<reason>", followed
+// by ": <detail>" when detail is set
+func notFoundResponse(secretName, path, reason string, detail error) secrets.Response {
+	msg := fmt.Sprintf("%s name=%s path=%s reason=%s", errNotFoundPrefix, secretName, path, reason)
+	if detail != nil {
+		msg += ": " + detail.Error()
+	}
+	return secrets.Response{Err: msg, DoNotReuse: true}
+}
+
+// logWarnings logs the warnings Vault attached to a read, such as a deprecated
+// path, so they are noticed before they turn into errors
+func (d *VaultDriver) logWarnings(secretName, path string, secret *api.Secret) {
+	for _, warning := range secret.Warnings {
+		log.Warnf("Vault warning reading secret %s at path %s: %s", secretName, path, warning)
+		d.metrics.inc("vault_read_warnings_total")
+	}
+}
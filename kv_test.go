@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestGetDeletedSecret(t *testing.T) {
+	for _, destroyed := range []bool{false, true} {
+		fv := newFakeVault(t)
+		fv.setKV2Deleted("secret/data/db", destroyed)
+		driver := &VaultDriver{
+			client:        fv.client(t),
+			config:        &VaultConfig{MountPath: "secret"},
+			secretTracker: make(map[string]*SecretInfo),
+			metrics:       newDriverMetrics(),
+		}
+
+		resp := driver.Get(secrets.Request{SecretName: "db"})
+		expected := "was deleted at"
+		if destroyed {
+			expected = "was destroyed"
+		}
+		if !strings.Contains(resp.Err, ErrSecretDeleted.Error()) || !strings.Contains(resp.Err, expected) {
+			t.Errorf("destroyed=%v: expected a deleted secret error, got %q", destroyed, resp.Err)
+		}
+	}
+}
+
+func TestCheckSecretDeleted(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2Deleted("secret/data/db", false)
+	secret, err := fv.client(t).Logical().Read("secret/data/db")
+	if err != nil || secret == nil {
+		t.Fatalf("Expected the deleted version's metadata, got %v (%v)", secret, err)
+	}
+	if err := checkSecretDeleted(secret); !errors.Is(err, ErrSecretDeleted) {
+		t.Errorf("Expected ErrSecretDeleted, got %v", err)
+	}
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	secret, _ = fv.client(t).Logical().Read("secret/data/db")
+	if err := checkSecretDeleted(secret); err != nil {
+		t.Errorf("Expected a live secret, got %v", err)
+	}
+}
+
+func TestChangeDetectionAcrossDeleteAndUndelete(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{},
+		secretTracker: make(map[string]*SecretInfo),
+	}
+	secretInfo := &SecretInfo{
+		DockerSecretName: "db",
+		VaultPath:        "secret/data/db",
+		VaultField:       "password",
+		LastHash:         hashValue(hashSHA256, []byte("p")),
+	}
+
+	fv.setKV2Deleted("secret/data/db", false)
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("A deleted secret must not be reported as changed")
+	}
+	if !secretInfo.Deleted {
+		t.Error("Expected the secret to be marked deleted")
+	}
+
+	// Undeleting restores the same value, which is still propagated once
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "p"})
+	if !driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected undelete to be reported as a change")
+	}
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected no further change after undelete")
+	}
+}
+
+func TestNotFoundResponseShape(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2Deleted("secret/data/gone", false)
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+	}{
+		{"missing", "secret not found: name=missing path=secret/data/missing reason=missing"},
+		{"gone", "secret not found: name=gone path=secret/data/gone reason=deleted: "},
+	}
+	for _, tt := range tests {
+		resp := driver.Get(secrets.Request{SecretName: tt.name})
+		if !strings.HasPrefix(resp.Err, tt.prefix) {
+			t.Errorf("Expected error starting with %q, got %q", tt.prefix, resp.Err)
+		}
+		if !strings.HasPrefix(resp.Err, errNotFoundPrefix) || !resp.DoNotReuse || resp.Value != nil {
+			t.Errorf("Unexpected not-found response for %s: %+v", tt.name, resp)
+		}
+	}
+	if resp := driver.Get(secrets.Request{SecretName: "missing"}); resp.Err != tests[0].prefix {
+		t.Errorf("Expected no detail for a missing secret, got %q", resp.Err)
+	}
+}
+
+func TestReadWarningsCounted(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/db": {
+			Data:     map[string]interface{}{"data": map[string]interface{}{"password": "p"}},
+			Warnings: []string{"path secret/db is deprecated"},
+		},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	if resp := driver.Get(secrets.Request{SecretName: "db"}); resp.Err != "" || string(resp.Value) != "p" {
+		t.Fatalf("Expected the value despite warnings, got %q and %q", resp.Value, resp.Err)
+	}
+	if count := driver.metrics.counter("vault_read_warnings_total"); count != 1 {
+		t.Errorf("Expected 1 warning after Get, got %v", count)
+	}
+	driver.hasSecretChanged(driver.secretTracker["db"])
+	if count := driver.metrics.counter("vault_read_warnings_total"); count != 2 {
+		t.Errorf("Expected 2 warnings after the change check, got %v", count)
+	}
+}
+
+func TestMalformedKV2Data(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/broken": {Data: map[string]interface{}{
+			"data":     "not-an-object",
+			"metadata": map[string]interface{}{"version": "1"},
+		}},
+		// KV v1 has no metadata, so "data" is an ordinary field
+		"secret/data/v1": {Data: map[string]interface{}{"data": "payload"}},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	resp := driver.Get(secrets.Request{SecretName: "broken"})
+	if !strings.Contains(resp.Err, "data is string, not an object") {
+		t.Errorf("Expected a malformed data error, got %q", resp.Err)
+	}
+	if resp := driver.Get(secrets.Request{SecretName: "v1"}); resp.Err != "" || string(resp.Value) != "payload" {
+		t.Errorf("Expected the KV v1 data field, got %q (%s)", resp.Value, resp.Err)
+	}
+
+	// Change detection and rotation read the same shape without panicking
+	secretInfo := &SecretInfo{DockerSecretName: "broken", VaultPath: "secret/data/broken", VaultField: "value"}
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected a malformed response not to count as a change")
+	}
+	if _, err := driver.rotateSecret(secretInfo); err == nil || !strings.Contains(err.Error(), "not an object") {
+		t.Errorf("Expected rotation to fail with a malformed data error, got %v", err)
+	}
+}
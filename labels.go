@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// controlLabels are the secret labels that change how the plugin reads or rotates a secret
+var controlLabels = []string{
+	"vault_path",
+	"vault_field",
+	"vault_field_template",
+	"vault_field_join",
+	"vault_field_separator",
+	"vault_pem_bundle",
+	"vault_json_field",
+	"vault_format",
+	"vault_watch_fields",
+	"vault_content_type",
+	"vault_reuse",
+	"vault_priority",
+	"vault_rotation_interval",
+	"vault_aliases",
+	"vault_trailing_newline",
+	"vault_rotate_cron",
+	"vault_rotation_mode",
+}
+
+// parseAllowedLabels parses VAULT_ALLOWED_LABELS. An empty value returns nil,
+// meaning every control label is honored.
+func parseAllowedLabels(value string) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for _, label := range parseList(value) {
+		if !isControlLabel(label) {
+			log.Warnf("Unknown label %q in VAULT_ALLOWED_LABELS", label)
+		}
+		allowed[label] = true
+	}
+	return allowed
+}
+
+// isControlLabel reports whether label is one of the plugin's control labels
+func isControlLabel(label string) bool {
+	for _, l := range controlLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLabels returns the request's labels without the control labels that
+// aren't in VAULT_ALLOWED_LABELS. Ignored labels are logged and counted so a
+// service trying to redirect reads shows up in the logs.
+func (d *VaultDriver) filterLabels(req secrets.Request) map[string]string {
+	if d.config.AllowedLabels == nil {
+		return req.SecretLabels
+	}
+
+	var ignored []string
+	filtered := make(map[string]string, len(req.SecretLabels))
+	for key, value := range req.SecretLabels {
+		if isControlLabel(key) && !d.config.AllowedLabels[key] {
+			ignored = append(ignored, key)
+			continue
+		}
+		filtered[key] = value
+	}
+	if len(ignored) == 0 {
+		return req.SecretLabels
+	}
+
+	sort.Strings(ignored)
+	for _, key := range ignored {
+		d.metrics.inc(`vault_labels_ignored_total{label="` + key + `"}`)
+	}
+	log.Warnf("Ignoring disallowed labels %v on secret %s requested by service %s", ignored, req.SecretName, req.ServiceName)
+	return filtered
+}
+
+// checkLabelCount refuses requests with more than VAULT_MAX_LABELS labels
+// before they are processed, logging and counting the refusal
+func (d *VaultDriver) checkLabelCount(req secrets.Request) error {
+	limit := d.config.MaxLabels
+	if limit <= 0 || len(req.SecretLabels) <= limit {
+		return nil
+	}
+	d.metrics.inc("vault_label_limit_rejections_total")
+	log.Warnf("Refusing secret request for %s from service %s: %d labels exceed the limit of %d",
+		req.SecretName, req.ServiceName, len(req.SecretLabels), limit)
+	return fmt.Errorf("secret %s has %d labels, more than the allowed %d", req.SecretName, len(req.SecretLabels), limit)
+}
+
+// validateLabels checks the values of control labels that would otherwise
+// fail silently or read from an unexpected place, and warns about unknown
+// vault_* labels, which are usually typos
+func (d *VaultDriver) validateLabels(req secrets.Request) error {
+	if path, exists := req.SecretLabels["vault_path"]; exists {
+		if err := validateVaultPath(path); err != nil {
+			return err
+		}
+	}
+	if reuse, exists := req.SecretLabels["vault_reuse"]; exists {
+		if _, err := strconv.ParseBool(strings.TrimSpace(reuse)); err != nil {
+			return fmt.Errorf("invalid vault_reuse %q: must be true or false", reuse)
+		}
+	}
+
+	var unknown []string
+	for key := range req.SecretLabels {
+		if strings.HasPrefix(key, "vault_") && !isControlLabel(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		d.metrics.inc(`vault_labels_unknown_total{label="` + key + `"}`)
+		if suggestion := closestControlLabel(key); suggestion != "" {
+			log.Warnf("Unknown label %q on secret %s, did you mean %q?", key, req.SecretName, suggestion)
+		} else {
+			log.Warnf("Unknown label %q on secret %s", key, req.SecretName)
+		}
+	}
+	return nil
+}
+
+// validateVaultPath rejects vault_path values that are empty, absolute or
+// contain empty, "." or ".." segments, so a label can't escape the mount
+func validateVaultPath(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return fmt.Errorf("invalid vault_path: must not be empty")
+	}
+	if strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid vault_path %q: must be relative to the mount", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		switch segment {
+		case "", ".", "..":
+			return fmt.Errorf("invalid vault_path %q: empty, \".\" and \"..\" segments are not allowed", path)
+		}
+	}
+	return nil
+}
+
+// closestControlLabel returns the control label within two edits of label,
+// or "" when none is that close
+func closestControlLabel(label string) string {
+	best, bestDistance := "", 3
+	for _, known := range controlLabels {
+		if distance := editDistance(label, known); distance < bestDistance {
+			best, bestDistance = known, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
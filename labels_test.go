@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestDisallowedLabelIgnored(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/web/db", map[string]interface{}{"password": "own"})
+	fv.setKV2("secret/data/admin/root", map[string]interface{}{"password": "stolen"})
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", AllowedLabels: parseAllowedLabels("vault_field")},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	labels := map[string]string{"vault_path": "admin/root", "vault_field": "password"}
+	resp := driver.Get(secrets.Request{SecretName: "db", ServiceName: "web", SecretLabels: labels})
+	if resp.Err != "" || string(resp.Value) != "own" {
+		t.Fatalf("Expected the default path to be used, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if fv.readCount("secret/data/admin/root") != 0 {
+		t.Error("Disallowed vault_path must not be read")
+	}
+	if count := driver.metrics.counter(`vault_labels_ignored_total{label="vault_path"}`); count != 1 {
+		t.Errorf("Expected ignored label to be counted, got %v", count)
+	}
+	if labels["vault_path"] != "admin/root" {
+		t.Error("The request's labels must not be modified")
+	}
+}
+
+func TestParseAllowedLabels(t *testing.T) {
+	if allowed := parseAllowedLabels(""); allowed != nil {
+		t.Errorf("Expected nil (all labels allowed), got %v", allowed)
+	}
+	allowed := parseAllowedLabels("vault_path, vault_field")
+	if !allowed["vault_path"] || !allowed["vault_field"] || allowed["vault_aliases"] {
+		t.Errorf("Unexpected allowed labels: %v", allowed)
+	}
+}
+
+func TestLabelValidation(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/app/db", map[string]interface{}{"password": "own"})
+	fv.setKV2("secret/data/admin/root", map[string]interface{}{"password": "stolen"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	for _, path := range []string{"../admin/root", "app/../../admin/root", "/admin/root", "app//db", "app/./db", ""} {
+		resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": path, "vault_field": "password"}})
+		if !strings.Contains(resp.Err, "invalid vault_path") || resp.Value != nil {
+			t.Errorf("Expected vault_path %q to be rejected, got %q (err: %s)", path, resp.Value, resp.Err)
+		}
+	}
+
+	resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "app/db", "vault_reuse": "sometimes"}})
+	if !strings.Contains(resp.Err, "invalid vault_reuse") {
+		t.Errorf("Expected a non-boolean vault_reuse to be rejected, got %q", resp.Err)
+	}
+
+	// Unknown vault_* labels are served but warned about and counted
+	resp = driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "app/db", "vault_feild": "password", "com.example.team": "x"}})
+	if resp.Err != "" || string(resp.Value) != "own" {
+		t.Fatalf("Expected the secret to be served, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if count := driver.metrics.counter(`vault_labels_unknown_total{label="vault_feild"}`); count != 1 {
+		t.Errorf("Expected the unknown label to be counted once, got %v", count)
+	}
+	if count := driver.metrics.counter(`vault_labels_unknown_total{label="com.example.team"}`); count != 0 {
+		t.Errorf("Expected labels without the vault_ prefix to be ignored, got %v", count)
+	}
+	if suggestion := closestControlLabel("vault_feild"); suggestion != "vault_field" {
+		t.Errorf("Expected vault_field to be suggested, got %q", suggestion)
+	}
+	if suggestion := closestControlLabel("vault_something_else"); suggestion != "" {
+		t.Errorf("Expected no suggestion, got %q", suggestion)
+	}
+}
+
+func TestLabelCountLimit(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"value": "v"})
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", MaxLabels: 5},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	labels := map[string]string{"vault_path": "db"}
+	for i := 0; len(labels) < 5; i++ {
+		labels[fmt.Sprintf("com.example.label%d", i)] = "x"
+	}
+	if resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: labels}); resp.Err != "" {
+		t.Fatalf("Expected a request at the limit to be served, got %s", resp.Err)
+	}
+
+	labels["com.example.extra"] = "x"
+	resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: labels})
+	if !strings.Contains(resp.Err, "6 labels, more than the allowed 5") || resp.Value != nil {
+		t.Errorf("Expected the request past the limit to be refused, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if reads := fv.readCount("secret/data/db"); reads != 1 {
+		t.Errorf("Expected the refused request not to reach Vault, got %d reads", reads)
+	}
+	if count := driver.metrics.counter("vault_label_limit_rejections_total"); count != 1 {
+		t.Errorf("Expected one counted refusal, got %v", count)
+	}
+}
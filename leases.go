@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// leaseRegistry tracks the leases of dynamic secrets served during this
+// session so they can be revoked when the plugin stops
+type leaseRegistry struct {
+	mutex  sync.Mutex
+	leases map[string]lease // by lease ID
+}
+
+// lease is a recorded lease and the client of the cluster that issued it
+type lease struct {
+	client  *api.Client
+	expires time.Time // zero when the lease has no TTL
+}
+
+// newLeaseRegistry creates an empty lease registry
+func newLeaseRegistry() *leaseRegistry {
+	return &leaseRegistry{leases: make(map[string]lease)}
+}
+
+// add records a lease issued by client with the given TTL, dropping recorded
+// leases that have expired by now, since Vault has already revoked them
+func (r *leaseRegistry) add(leaseID string, client *api.Client, ttl time.Duration, now time.Time) {
+	if r == nil || leaseID == "" {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id, recorded := range r.leases {
+		if !recorded.expires.IsZero() && !now.Before(recorded.expires) {
+			delete(r.leases, id)
+		}
+	}
+	recorded := lease{client: client}
+	if ttl > 0 {
+		recorded.expires = now.Add(ttl)
+	}
+	r.leases[leaseID] = recorded
+}
+
+// revokeAll revokes every recorded lease. Leases that fail to revoke are
+// logged and dropped; they still expire with their TTL.
+func (r *leaseRegistry) revokeAll(ctx context.Context, metrics *driverMetrics) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	leases := r.leases
+	r.leases = make(map[string]lease)
+	r.mutex.Unlock()
+
+	revoked := 0
+	for leaseID, recorded := range leases {
+		if err := recorded.client.Sys().RevokeWithContext(ctx, leaseID); err != nil {
+			log.Warnf("Failed to revoke lease %s: %v", leaseID, err)
+			metrics.inc(`vault_leases_revoked_total{result="error"}`)
+			continue
+		}
+		metrics.inc(`vault_leases_revoked_total{result="success"}`)
+		revoked++
+	}
+	if revoked > 0 {
+		log.Printf("Revoked %d vault leases", revoked)
+	}
+}
+
+// revokeLeases revokes the leases of dynamic secrets read during this session
+func (d *VaultDriver) revokeLeases() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	d.leases.revokeAll(ctx, d.metrics)
+}
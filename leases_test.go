@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestLeasesRevokedOnStop(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.set("database/creds/app", map[string]interface{}{"password": "dynamic"})
+	fv.setLease("database/creds/app", "database/creds/app/lease-1")
+	fv.setKV2("secret/data/static", map[string]interface{}{"password": "static"})
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "database"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		leases:        newLeaseRegistry(),
+	}
+
+	req := secrets.Request{SecretName: "app", SecretLabels: map[string]string{"vault_path": "creds/app", "vault_field": "password"}}
+	if resp := driver.Get(req); string(resp.Value) != "dynamic" {
+		t.Fatalf("Expected dynamic value, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	fv.setLease("database/creds/app", "database/creds/app/lease-2")
+	driver.Get(req)
+
+	// Secrets without a lease aren't tracked
+	driver.config.MountPath = "secret"
+	driver.Get(secrets.Request{SecretName: "static", SecretLabels: map[string]string{"vault_field": "password"}})
+
+	if err := driver.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revoked := fv.revokedLeases()
+	sort.Strings(revoked)
+	if expected := []string{"database/creds/app/lease-1", "database/creds/app/lease-2"}; !reflect.DeepEqual(revoked, expected) {
+		t.Errorf("Expected leases %v to be revoked, got %v", expected, revoked)
+	}
+	if count := driver.metrics.counter(`vault_leases_revoked_total{result="success"}`); count != 2 {
+		t.Errorf("Expected 2 revoked leases, got %v", count)
+	}
+
+	// Leases are only revoked once
+	driver.Stop()
+	if len(fv.revokedLeases()) != 2 {
+		t.Error("Expected no further revocations on a second Stop")
+	}
+}
+
+func TestLeasesRecordedOnlyWhenServed(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.set("database/creds/app", map[string]interface{}{"password": "dynamic"})
+	fv.setLease("database/creds/app", "database/creds/app/lease-1")
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "database", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		leases:        newLeaseRegistry(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "app", SecretLabels: map[string]string{"vault_path": "creds/app", "vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	// Change detection reads don't serve the value, so their leases aren't kept
+	for i := 2; i <= 4; i++ {
+		fv.setLease("database/creds/app", fmt.Sprintf("database/creds/app/lease-%d", i))
+		driver.hasSecretChanged(driver.secretTracker["app"])
+	}
+	if len(driver.leases.leases) != 1 {
+		t.Errorf("Expected only the served lease to be recorded, got %v", driver.leases.leases)
+	}
+
+	// Leases past their TTL were revoked by Vault and are dropped
+	clock.Advance(fakeLeaseTTL * time.Second)
+	fv.setLease("database/creds/app", "database/creds/app/lease-5")
+	driver.Get(req)
+	if _, exists := driver.leases.leases["database/creds/app/lease-1"]; exists || len(driver.leases.leases) != 1 {
+		t.Errorf("Expected the expired lease to be dropped, got %v", driver.leases.leases)
+	}
+}
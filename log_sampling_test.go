@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// captureLogs redirects the standard logger into a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &buf
+}
+
+func TestGetLogSampling(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/app", map[string]interface{}{"value": "s3cret"})
+
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			MountPath:      "secret",
+			LogSampleRate:  10,
+			EnableRotation: true,
+		},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	logs := captureLogs(t)
+	for i := 0; i < 100; i++ {
+		resp := driver.Get(secrets.Request{SecretName: "app"})
+		if resp.Err != "" {
+			t.Fatalf("Unexpected error: %s", resp.Err)
+		}
+	}
+
+	successLines := strings.Count(logs.String(), "Successfully returning secret value")
+	if successLines != 10 {
+		t.Errorf("Expected 10 sampled success lines, got %d", successLines)
+	}
+	if trackingLines := strings.Count(logs.String(), "Tracking secret: app"); trackingLines != 10 {
+		t.Errorf("Expected 10 sampled tracking lines, got %d", trackingLines)
+	}
+
+	// Errors are never sampled
+	logs.Reset()
+	for i := 0; i < 5; i++ {
+		driver.Get(secrets.Request{SecretName: "missing"})
+	}
+	if errorLines := strings.Count(logs.String(), "Secret missing not found"); errorLines != 5 {
+		t.Errorf("Expected 5 error lines, got %d", errorLines)
+	}
+}
+
+func TestGetLogSamplingDisabled(t *testing.T) {
+	driver := &VaultDriver{config: &VaultConfig{LogSampleRate: 1}}
+	for i := 0; i < 5; i++ {
+		if !driver.sampleGetLog() {
+			t.Fatal("Expected every request to be logged when sampling is disabled")
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+// mockLogical is an in-memory vaultLogical
+type mockLogical struct {
+	secrets map[string]*api.Secret
+	reads   []string
+}
+
+func (m *mockLogical) ReadWithContext(ctx context.Context, path string) (*api.Secret, error) {
+	m.reads = append(m.reads, path)
+	return m.secrets[path], nil
+}
+
+func TestGetWithMockLogical(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/db": {Data: map[string]interface{}{
+			"data": map[string]interface{}{"password": "p", "username": "app"},
+		}},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	tests := []struct {
+		name   string
+		req    secrets.Request
+		value  string
+		errMsg string
+	}{
+		{"success", secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "username"}}, "app", ""},
+		{"not found", secrets.Request{SecretName: "missing"}, "", "secret not found: name=missing path=secret/data/missing reason=missing"},
+		{"field missing", secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "token"}}, "", "field token not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := driver.Get(tt.req)
+			if string(resp.Value) != tt.value || !strings.Contains(resp.Err, tt.errMsg) || (tt.errMsg == "") != (resp.Err == "") {
+				t.Errorf("Expected value %q and error %q, got %q and %q", tt.value, tt.errMsg, resp.Value, resp.Err)
+			}
+		})
+	}
+
+	// The successful read is tracked, and change detection reads through the mock
+	secretInfo := driver.secretTracker["db"]
+	if secretInfo == nil {
+		t.Fatal("Expected db to be tracked")
+	}
+	if driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected no change")
+	}
+	logical.secrets["secret/data/db"].Data["data"].(map[string]interface{})["username"] = "other"
+	if !driver.hasSecretChanged(secretInfo) {
+		t.Error("Expected a change")
+	}
+	if len(logical.reads) != 5 {
+		t.Errorf("Expected every read to go through the mock, got %v", logical.reads)
+	}
+}
@@ -46,6 +46,11 @@ func main() {
         os.Exit(0)
     }()
 
+    // Approvals and other admin operations aren't part of the plugin protocol
+    if err := driver.serveAdmin(); err != nil {
+        log.Fatalf("Failed to start admin API: %v", err)
+    }
+
     // Create the plugin handler
     handler := secrets.NewHandler(driver)
 
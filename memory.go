@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// byteSize matches sizes such as "512MB", "1GiB" or "1048576"
+var byteSize = regexp.MustCompile(`^(\d+)\s*([kmgKMG]i?[bB]?|[bB]?)$`)
+
+// byteUnits maps lower-cased size suffixes to their multipliers
+var byteUnits = map[string]uint64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+}
+
+// parseByteSize parses VAULT_MEM_SOFT_LIMIT. Units are binary, so "1MB" is
+// 1048576 bytes. Empty or invalid values return 0, disabling the check.
+func parseByteSize(value string) uint64 {
+	value = strings.TrimSpace(value)
+	match := byteSize.FindStringSubmatch(value)
+	if match == nil {
+		if value != "" {
+			log.Warnf("Invalid size %q, memory soft limit disabled", value)
+		}
+		return 0
+	}
+	n, _ := strconv.ParseUint(match[1], 10, 64)
+	return n * byteUnits[strings.ToLower(match[2])]
+}
+
+// currentMemSys returns the memory obtained from the OS by the Go runtime
+func currentMemSys() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys
+}
+
+// checkMemory records the plugin's memory use and reports whether it exceeds
+// VAULT_MEM_SOFT_LIMIT, warning when it does
+func (d *VaultDriver) checkMemory(sys uint64) bool {
+	d.metrics.setGauge("vault_memory_sys_bytes", float64(sys))
+	limit := d.config.MemSoftLimit
+	if limit == 0 || sys <= limit {
+		return false
+	}
+	d.metrics.inc("vault_memory_pressure_total")
+	action := ""
+	if d.config.MemShedLoad {
+		action = ", pausing change detection and reconciliation"
+	}
+	log.Warnf("Memory use of %s exceeds the soft limit of %s%s", formatBytes(sys), formatBytes(limit), action)
+	return true
+}
+
+// formatBytes formats a size in MiB for logs
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]uint64{
+		"":        0,
+		"1048576": 1 << 20,
+		"512MB":   512 << 20,
+		"512 mib": 512 << 20,
+		"2G":      2 << 30,
+		"64k":     64 << 10,
+		"lots":    0,
+		"1.5GB":   0,
+	}
+	for value, expected := range tests {
+		if got := parseByteSize(value); got != expected {
+			t.Errorf("parseByteSize(%q) = %d, expected %d", value, got, expected)
+		}
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	driver := &VaultDriver{config: &VaultConfig{MemSoftLimit: 100 << 20}, metrics: newDriverMetrics()}
+
+	if driver.checkMemory(50 << 20) {
+		t.Error("Expected no pressure below the limit")
+	}
+	if !driver.checkMemory(150 << 20) {
+		t.Error("Expected pressure above the limit")
+	}
+	if gauge := driver.metrics.gauge("vault_memory_sys_bytes"); gauge != 150<<20 {
+		t.Errorf("Expected the last reading to be exported, got %v", gauge)
+	}
+	if count := driver.metrics.counter("vault_memory_pressure_total"); count != 1 {
+		t.Errorf("Expected 1 pressure event, got %v", count)
+	}
+
+	driver.config.MemSoftLimit = 0
+	if driver.checkMemory(1 << 40) {
+		t.Error("Expected the check to be disabled without a limit")
+	}
+}
+
+func TestSweepShedsLoadUnderMemoryPressure(t *testing.T) {
+	// Any running process exceeds a 1 byte limit
+	driver := &VaultDriver{
+		config:        &VaultConfig{MemSoftLimit: 1, MemShedLoad: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	driver.sweep(time.Now())
+	if count := driver.metrics.counter("vault_sweeps_total"); count != 0 {
+		t.Errorf("Expected change detection to be skipped, got %v sweeps", count)
+	}
+
+	driver.config.MemShedLoad = false
+	driver.sweep(time.Now())
+	if count := driver.metrics.counter("vault_sweeps_total"); count != 1 {
+		t.Errorf("Expected change detection to run when not shedding load, got %v sweeps", count)
+	}
+}
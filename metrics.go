@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Outcomes recorded for each Get request
+const (
+	getResultSuccess         = "success"
+	getResultNotFound        = "not_found"
+	getResultAuthError       = "auth_error"
+	getResultBackendError    = "backend_error"
+	getResultExtractionError = "extraction_error"
+)
+
+// driverMetrics holds the plugin's counters and gauges. Metric names follow
+// Prometheus conventions, with labels encoded in the name, e.g.
+// vault_cluster_active{cluster="primary"}.
+type driverMetrics struct {
+	mutex      sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string]bool // names observed as histograms, whose series are counters
+}
+
+// newDriverMetrics creates an empty metrics registry
+func newDriverMetrics() *driverMetrics {
+	return &driverMetrics{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]bool),
+	}
+}
+
+// inc increments a counter by one
+func (m *driverMetrics) inc(name string) {
+	m.add(name, 1)
+}
+
+// add increments a counter by delta
+func (m *driverMetrics) add(name string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[name] += delta
+}
+
+// setGauge sets a gauge to value
+func (m *driverMetrics) setGauge(name string, value float64) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gauges[name] = value
+}
+
+// addGauge moves a gauge by delta, e.g. the length of a queue
+func (m *driverMetrics) addGauge(name string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gauges[name] += delta
+}
+
+// deleteGauge removes a gauge, e.g. an info series that no longer applies
+func (m *driverMetrics) deleteGauge(name string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.gauges, name)
+}
+
+// latencyBuckets are the upper bounds, in seconds, of latency histograms
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// observe records a value in a histogram, stored as Prometheus-style
+// cumulative _bucket, _sum and _count counters. labels are the series labels
+// without braces, e.g. `provider="vault"`.
+func (m *driverMetrics) observe(name, labels string, value float64) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.histograms[name] = true
+	for _, bound := range latencyBuckets {
+		if value <= bound {
+			m.counters[fmt.Sprintf(`%s_bucket{%s,le="%g"}`, name, labels, bound)]++
+		}
+	}
+	m.counters[fmt.Sprintf(`%s_bucket{%s,le="+Inf"}`, name, labels)]++
+	m.counters[fmt.Sprintf("%s_sum{%s}", name, labels)] += value
+	m.counters[fmt.Sprintf("%s_count{%s}", name, labels)]++
+}
+
+// counter returns the current value of a counter
+func (m *driverMetrics) counter(name string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.counters[name]
+}
+
+// gauge returns the current value of a gauge
+func (m *driverMetrics) gauge(name string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.gauges[name]
+}
+
+// snapshot returns a copy of all counters and gauges
+func (m *driverMetrics) snapshot() map[string]float64 {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := make(map[string]float64, len(m.counters)+len(m.gauges))
+	for name, value := range m.counters {
+		result[name] = value
+	}
+	for name, value := range m.gauges {
+		result[name] = value
+	}
+	return result
+}
+
+// Metrics returns a snapshot of the driver's counters and gauges
+func (d *VaultDriver) Metrics() map[string]float64 {
+	return d.metrics.snapshot()
+}
+
+// DriverStatus summarizes the driver for health checks
+type DriverStatus struct {
+	State          string  `json:"state"` // healthy, or degraded while Vault authentication is retried
+	UptimeSeconds  float64 `json:"uptime_seconds"`
+	Tracked        int     `json:"tracked"`
+	Rotations      float64 `json:"rotations"`
+	RotationErrors float64 `json:"rotation_errors"`
+	GetErrors      float64 `json:"get_errors"` // every Get request that wasn't served, missing secrets included
+}
+
+// Status returns the driver's health and activity counts
+func (d *VaultDriver) Status() DriverStatus {
+	state := "healthy"
+	if !d.Ready() {
+		state = "degraded"
+	}
+	d.trackerMutex.RLock()
+	tracked := len(d.secretTracker)
+	d.trackerMutex.RUnlock()
+
+	var getErrors float64
+	for _, result := range []string{getResultNotFound, getResultAuthError, getResultBackendError, getResultExtractionError} {
+		getErrors += d.metrics.counter(fmt.Sprintf(`vault_secret_requests_total{result=%q,provider="vault"}`, result))
+	}
+	return DriverStatus{
+		State:          state,
+		UptimeSeconds:  d.now().Sub(d.started).Truncate(time.Second).Seconds(),
+		Tracked:        tracked,
+		Rotations:      d.metrics.counter(`vault_rotations_total{result="success"}`),
+		RotationErrors: d.metrics.counter(`vault_rotations_total{result="error"}`),
+		GetErrors:      getErrors,
+	}
+}
+
+// StatusLine formats Status on one line for quick checks, e.g.
+// "healthy uptime=2h0m0s tracked=3 rotations=5 rotation_errors=0 get_errors=1"
+func (d *VaultDriver) StatusLine() string {
+	status := d.Status()
+	return fmt.Sprintf("%s uptime=%s tracked=%d rotations=%.0f rotation_errors=%.0f get_errors=%.0f",
+		status.State, time.Duration(status.UptimeSeconds)*time.Second, status.Tracked,
+		status.Rotations, status.RotationErrors, status.GetErrors)
+}
+
+// classifyReadError maps a Vault read error to a Get outcome
+func classifyReadError(err error) string {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return getResultAuthError
+		case http.StatusNotFound:
+			return getResultNotFound
+		}
+	}
+	return getResultBackendError
+}
+
+// recordGetOutcome counts a Get request under its outcome
+func (d *VaultDriver) recordGetOutcome(result string) {
+	d.metrics.inc(fmt.Sprintf(`vault_secret_requests_total{result=%q,provider="vault"}`, result))
+}
+
+// recordSecretAge sets vault_secret_age_seconds from the created_time of the
+// KV v2 version returned with a read. Secrets without that metadata are skipped.
+func (d *VaultDriver) recordSecretAge(secretName string, secret *api.Secret) {
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	createdTime, ok := metadata["created_time"].(string)
+	if !ok {
+		return
+	}
+	created, err := time.Parse(time.RFC3339Nano, createdTime)
+	if err != nil {
+		return
+	}
+	d.metrics.setGauge(fmt.Sprintf(`vault_secret_age_seconds{secret=%q}`, secretName), d.now().Sub(created).Seconds())
+}
+
+// Operations timed by vault_provider_request_duration_seconds
+const (
+	operationGet    = "get"    // Get requests from Swarm
+	operationCheck  = "check"  // change detection
+	operationRotate = "rotate" // re-read during a rotation
+)
+
+// defaultReadTimeout bounds a Vault read when its operation has no timeout set
+const defaultReadTimeout = 30 * time.Second
+
+// readTimeout returns the timeout of Vault reads for an operation, from
+// VAULT_GET_TIMEOUT, VAULT_CHECK_TIMEOUT or VAULT_ROTATE_TIMEOUT
+func (d *VaultDriver) readTimeout(operation string) time.Duration {
+	var timeout time.Duration
+	switch operation {
+	case operationGet:
+		timeout = d.config.GetTimeout
+	case operationCheck:
+		timeout = d.config.CheckTimeout
+	case operationRotate:
+		timeout = d.config.RotateTimeout
+	}
+	if timeout <= 0 {
+		return defaultReadTimeout
+	}
+	return timeout
+}
+
+// timedRead reads a secret and records the latency of the backend call under
+// the given operation
+func (d *VaultDriver) timedRead(ctx context.Context, operation, path string) (*api.Secret, *api.Client, error) {
+	start := d.now()
+	secret, client, err := d.readSecret(ctx, path)
+	d.metrics.observe("vault_provider_request_duration_seconds",
+		fmt.Sprintf(`provider="vault",operation=%q`, operation), d.now().Sub(start).Seconds())
+	return secret, client, err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestGetOutcomeMetrics(t *testing.T) {
+	vault := newFakeVault(t)
+	vault.setKV2("secret/data/app", map[string]interface{}{"value": "v"})
+	vault.setKV2("secret/data/nostring", map[string]interface{}{"port": 42})
+
+	driver := &VaultDriver{
+		client:        vault.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		status int
+		result string
+	}{
+		{"success", "app", 0, getResultSuccess},
+		{"not found", "missing", 0, getResultNotFound},
+		{"extraction error", "nostring", 0, getResultExtractionError},
+		{"auth error", "app", http.StatusForbidden, getResultAuthError},
+		{"backend error", "app", http.StatusServiceUnavailable, getResultBackendError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault.setStatus(tt.status)
+			defer vault.setStatus(0)
+
+			driver.Get(secrets.Request{SecretName: tt.secret})
+			series := fmt.Sprintf(`vault_secret_requests_total{result=%q,provider="vault"}`, tt.result)
+			if count := driver.metrics.counter(series); count != 1 {
+				t.Errorf("Expected %s to be 1, got %v", series, count)
+			}
+		})
+	}
+}
+
+func TestSecretAgeMetric(t *testing.T) {
+	fv := newFakeVault(t)
+	created := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	fv.set("secret/data/db", map[string]interface{}{
+		"data":     map[string]interface{}{"password": "p"},
+		"metadata": map[string]interface{}{"created_time": created, "version": 3},
+	})
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	secretInfo := &SecretInfo{DockerSecretName: "db", VaultPath: "secret/data/db", VaultField: "password"}
+	driver.hasSecretChanged(secretInfo)
+
+	age := driver.metrics.gauge(`vault_secret_age_seconds{secret="db"}`)
+	if age < 3600 || age > 3660 {
+		t.Errorf("Expected secret age of about an hour, got %vs", age)
+	}
+}
+
+func TestProviderLatencyHistogram(t *testing.T) {
+	logical := &mockLogical{secrets: map[string]*api.Secret{
+		"secret/data/db": {Data: map[string]interface{}{"data": map[string]interface{}{"password": "p"}}},
+	}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	driver.Get(secrets.Request{SecretName: "db"})
+	driver.hasSecretChanged(driver.secretTracker["db"])
+
+	metrics := driver.Metrics()
+	for _, operation := range []string{operationGet, operationCheck} {
+		labels := fmt.Sprintf(`provider="vault",operation=%q`, operation)
+		for _, series := range []string{
+			"vault_provider_request_duration_seconds_count{" + labels + "}",
+			"vault_provider_request_duration_seconds_bucket{" + labels + `,le="+Inf"}`,
+			"vault_provider_request_duration_seconds_bucket{" + labels + `,le="10"}`,
+		} {
+			if metrics[series] != 1 {
+				t.Errorf("Expected %s to be 1, got %v", series, metrics[series])
+			}
+		}
+		if _, ok := metrics["vault_provider_request_duration_seconds_sum{"+labels+"}"]; !ok {
+			t.Errorf("Expected a sum series for %s", operation)
+		}
+	}
+}
+
+func TestObserveBuckets(t *testing.T) {
+	m := newDriverMetrics()
+	m.observe("latency", `op="x"`, 0.03)
+	m.observe("latency", `op="x"`, 20)
+
+	expected := map[string]float64{
+		`latency_bucket{op="x",le="0.025"}`: 0,
+		`latency_bucket{op="x",le="0.05"}`:  1,
+		`latency_bucket{op="x",le="10"}`:    1,
+		`latency_bucket{op="x",le="+Inf"}`:  2,
+		`latency_sum{op="x"}`:               20.03,
+		`latency_count{op="x"}`:             2,
+	}
+	for series, value := range expected {
+		if got := m.counter(series); got != value {
+			t.Errorf("Expected %s to be %v, got %v", series, value, got)
+		}
+	}
+}
+
+// deadlineLogical serves one secret and records the time left before the
+// deadline of each read's context
+type deadlineLogical struct {
+	secret    *api.Secret
+	remaining []time.Duration
+}
+
+func (l *deadlineLogical) ReadWithContext(ctx context.Context, path string) (*api.Secret, error) {
+	deadline, _ := ctx.Deadline()
+	l.remaining = append(l.remaining, time.Until(deadline))
+	return l.secret, nil
+}
+
+func TestReadTimeoutPerOperation(t *testing.T) {
+	logical := &deadlineLogical{secret: &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"password": "p"},
+	}}}
+	driver := &VaultDriver{
+		logical:       logical,
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, GetTimeout: 2 * time.Minute, CheckTimeout: 5 * time.Second},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	if resp := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	driver.hasSecretChanged(driver.secretTracker["db"])
+
+	if len(logical.remaining) != 2 {
+		t.Fatalf("Expected a get and a check read, got %d reads", len(logical.remaining))
+	}
+	if get := logical.remaining[0]; get <= time.Minute || get > 2*time.Minute {
+		t.Errorf("Expected the get to use the 2m timeout, got %v left", get)
+	}
+	if check := logical.remaining[1]; check <= 0 || check > 5*time.Second {
+		t.Errorf("Expected the check to use the 5s timeout, got %v left", check)
+	}
+	if timeout := driver.readTimeout(operationRotate); timeout != defaultReadTimeout {
+		t.Errorf("Expected an unset timeout to default to %v, got %v", defaultReadTimeout, timeout)
+	}
+}
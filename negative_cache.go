@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// negativeCache remembers Vault paths that returned no secret for
+// VAULT_NEGATIVE_CACHE_TTL, so services restarting on a secret that doesn't
+// exist yet don't send a read to Vault on every attempt
+type negativeCache struct {
+	mutex   sync.Mutex
+	expires map[string]time.Time // path -> when the not-found result expires
+}
+
+// cachedNotFound reports whether path recently returned no secret
+func (d *VaultDriver) cachedNotFound(path string, now time.Time) bool {
+	if d.config.NegativeCacheTTL <= 0 {
+		return false
+	}
+	c := &d.notFound
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expires, ok := c.expires[path]
+	if ok && now.Before(expires) {
+		return true
+	}
+	if ok {
+		delete(c.expires, path)
+	}
+	return false
+}
+
+// rememberNotFound caches a not-found result for path. Expired entries are
+// dropped at the same time, so the cache only holds recent misses.
+func (d *VaultDriver) rememberNotFound(path string, now time.Time) {
+	if d.config.NegativeCacheTTL <= 0 {
+		return
+	}
+	c := &d.notFound
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.expires == nil {
+		c.expires = make(map[string]time.Time)
+	}
+	for cached, expires := range c.expires {
+		if !now.Before(expires) {
+			delete(c.expires, cached)
+		}
+	}
+	c.expires[path] = now.Add(d.config.NegativeCacheTTL)
+}
+
+// forgetNotFound drops a cached not-found result once path has a secret
+func (d *VaultDriver) forgetNotFound(path string) {
+	c := &d.notFound
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.expires, path)
+}
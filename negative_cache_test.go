@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestNegativeCache(t *testing.T) {
+	fv := newFakeVault(t)
+	clock := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", NegativeCacheTTL: 10 * time.Second},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "db"}}
+
+	for i := 0; i < 5; i++ {
+		if resp := driver.Get(req); !strings.HasPrefix(resp.Err, errNotFoundPrefix) {
+			t.Fatalf("Expected a not-found error, got %q", resp.Err)
+		}
+		clock.Advance(time.Second)
+	}
+	if reads := fv.readCount("secret/data/db"); reads != 1 {
+		t.Errorf("Expected one read within the TTL, got %d", reads)
+	}
+	if hits := driver.metrics.counter("vault_negative_cache_hits_total"); hits != 4 {
+		t.Errorf("Expected 4 cache hits, got %v", hits)
+	}
+
+	// Once the entry expires, a newly created secret is picked up
+	fv.setKV2("secret/data/db", map[string]interface{}{"value": "created"})
+	clock.Advance(5 * time.Second)
+	if resp := driver.Get(req); resp.Err != "" || string(resp.Value) != "created" {
+		t.Errorf("Expected the new secret after the TTL, got %q (err: %s)", resp.Value, resp.Err)
+	}
+	if reads := fv.readCount("secret/data/db"); reads != 2 {
+		t.Errorf("Expected a second read after the TTL, got %d", reads)
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	fv := newFakeVault(t)
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret"},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "db"}}
+	driver.Get(req)
+	driver.Get(req)
+	if reads := fv.readCount("secret/data/db"); reads != 2 {
+		t.Errorf("Expected every Get to read Vault without a TTL, got %d reads", reads)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// configFile is the declarative plugin configuration read with -config. Fields
+// that are present replace the corresponding flag or environment settings.
+//
+//	{
+//	  "env": ["VAULT_ADDR=https://vault:8200", "VAULT_ROTATION_INTERVAL=1m"],
+//	  "network": "host",
+//	  "mounts": ["/var/run/docker.sock"],
+//	  "capabilities": []
+//	}
+type configFile struct {
+	Env          []string `json:"env"`
+	Network      *string  `json:"network"`
+	Mounts       []string `json:"mounts"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// loadConfigFile reads and validates a plugin configuration file
+func loadConfigFile(filePath string) (*configFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var file configFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", filePath, err)
+	}
+
+	for _, entry := range file.Env {
+		if key, _, found := strings.Cut(entry, "="); !found || key == "" {
+			return nil, fmt.Errorf("invalid config file %s: env entry %q is not KEY=VALUE", filePath, entry)
+		}
+	}
+	for _, mount := range file.Mounts {
+		if !path.IsAbs(mount) {
+			return nil, fmt.Errorf("invalid config file %s: mount %q is not an absolute path", filePath, mount)
+		}
+	}
+	return &file, nil
+}
+
+// apply merges the file into the installer configuration. Vault settings in
+// env set the matching installer fields; other entries are passed through.
+func (f *configFile) apply(c *installerConfig) {
+	for _, entry := range f.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		switch key {
+		case "VAULT_ADDR":
+			c.vaultAddr = value
+		case "VAULT_AUTH_METHOD":
+			c.authMethod = value
+		case "VAULT_ROLE_ID":
+			c.roleID = value
+		case "VAULT_SECRET_ID":
+			c.secretID = value
+		case "VAULT_TOKEN":
+			c.token = value
+		case "VAULT_MOUNT_PATH":
+			c.mountPath = value
+		default:
+			c.extraEnv = append(c.extraEnv, entry)
+		}
+	}
+	if f.Network != nil {
+		c.network = *f.Network
+	}
+	if f.Mounts != nil {
+		c.mounts = f.Mounts
+	}
+	if f.Capabilities != nil {
+		c.capabilities = f.Capabilities
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// serviceClient is the part of the Docker client used to install the plugin service
+type serviceClient interface {
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+}
+
+// installService creates the plugin service, or updates it in place if a
+// service with the same name already exists so the installer can be re-run
+// to upgrade. With forceRecreate the existing service is removed first.
+func installService(ctx context.Context, cli serviceClient, spec swarm.ServiceSpec, forceRecreate bool) (string, error) {
+	services, err := cli.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", spec.Name)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list services: %v", err)
+	}
+
+	// The name filter matches prefixes, so look for an exact match
+	var existing *swarm.Service
+	for i := range services {
+		if services[i].Spec.Name == spec.Name {
+			existing = &services[i]
+			break
+		}
+	}
+
+	if existing != nil && forceRecreate {
+		log.Printf("Removing existing plugin service %s", spec.Name)
+		if err := cli.ServiceRemove(ctx, existing.ID); err != nil {
+			return "", fmt.Errorf("failed to remove service %s: %v", spec.Name, err)
+		}
+		existing = nil
+	}
+
+	if existing == nil {
+		response, err := cli.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to create plugin service: %v", err)
+		}
+		return response.ID, nil
+	}
+
+	log.Printf("Updating existing plugin service %s", spec.Name)
+	response, err := cli.ServiceUpdate(ctx, existing.ID, existing.Version, spec, types.ServiceUpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to update service %s: %v", spec.Name, err)
+	}
+	for _, warning := range response.Warnings {
+		log.Warnf("Service update warning for %s: %s", spec.Name, warning)
+	}
+	return existing.ID, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// fakeServiceClient records the service calls made by the installer
+type fakeServiceClient struct {
+	services []swarm.Service
+	calls    []string
+	updated  swarm.ServiceSpec
+	version  swarm.Version
+}
+
+func (f *fakeServiceClient) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	f.calls = append(f.calls, "list")
+	return f.services, nil
+}
+
+func (f *fakeServiceClient) ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error) {
+	f.calls = append(f.calls, "create")
+	return swarm.ServiceCreateResponse{ID: "new-service"}, nil
+}
+
+func (f *fakeServiceClient) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	f.calls = append(f.calls, "update "+serviceID)
+	f.updated = service
+	f.version = version
+	return swarm.ServiceUpdateResponse{}, nil
+}
+
+func (f *fakeServiceClient) ServiceRemove(ctx context.Context, serviceID string) error {
+	f.calls = append(f.calls, "remove "+serviceID)
+	return nil
+}
+
+// existingPluginService returns a client that already runs the plugin service,
+// next to a service whose name shares the prefix
+func existingPluginService() *fakeServiceClient {
+	existing := swarm.Service{ID: "svc-1"}
+	existing.Spec.Name = "vault-secrets-plugin"
+	existing.Version.Index = 7
+	other := swarm.Service{ID: "svc-2"}
+	other.Spec.Name = "vault-secrets-plugin-old"
+	return &fakeServiceClient{services: []swarm.Service{other, existing}}
+}
+
+func testSpec() swarm.ServiceSpec {
+	spec := swarm.ServiceSpec{}
+	spec.Name = "vault-secrets-plugin"
+	return spec
+}
+
+func TestInstallServiceCreatesNewService(t *testing.T) {
+	cli := &fakeServiceClient{}
+	id, err := installService(context.Background(), cli, testSpec(), false)
+	if err != nil || id != "new-service" {
+		t.Fatalf("Expected new service, got %q (%v)", id, err)
+	}
+	if len(cli.calls) != 2 || cli.calls[1] != "create" {
+		t.Errorf("Unexpected calls: %v", cli.calls)
+	}
+}
+
+func TestInstallServiceUpdatesExistingService(t *testing.T) {
+	cli := existingPluginService()
+	spec := testSpec()
+	spec.Labels = map[string]string{"upgraded": "true"}
+
+	id, err := installService(context.Background(), cli, spec, false)
+	if err != nil || id != "svc-1" {
+		t.Fatalf("Expected existing service to be kept, got %q (%v)", id, err)
+	}
+	if len(cli.calls) != 2 || cli.calls[1] != "update svc-1" {
+		t.Errorf("Expected the exact-name service to be updated, got calls %v", cli.calls)
+	}
+	if cli.updated.Labels["upgraded"] != "true" || cli.version.Index != 7 {
+		t.Errorf("Expected the new spec to be applied at the current version, got version %d", cli.version.Index)
+	}
+}
+
+func TestInstallServiceForceRecreate(t *testing.T) {
+	cli := existingPluginService()
+	id, err := installService(context.Background(), cli, testSpec(), true)
+	if err != nil || id != "new-service" {
+		t.Fatalf("Expected recreated service, got %q (%v)", id, err)
+	}
+	if len(cli.calls) != 3 || cli.calls[1] != "remove svc-1" || cli.calls[2] != "create" {
+		t.Errorf("Expected remove then create, got %v", cli.calls)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/api/types/swarm/runtime"
 	dockerclient "github.com/docker/docker/client"
@@ -17,67 +19,197 @@ var (
 	log = logrus.New()
 )
 
-func main() {
-	cli, err := dockerclient.NewEnvClient()
-	if err != nil {
-		log.Fatalf("Error creating Docker client: %v", err)
+// serviceNameFromPlugin derives the service name from a plugin reference,
+// e.g. "org/vault-secrets-plugin:latest" -> "vault-secrets-plugin"
+var serviceNameFromPlugin = regexp.MustCompile("^(?:.+/|)([^:$]+)(?::.*|)$")
+
+// installerConfig describes the plugin service to create. Vault credentials
+// have no defaults and must be provided through flags or the environment.
+type installerConfig struct {
+	serviceName   string
+	pluginName    string
+	remote        string
+	forceRecreate bool // remove an existing service instead of updating it
+
+	vaultAddr  string
+	authMethod string
+	roleID     string
+	secretID   string
+	token      string
+	mountPath  string
+	extraEnv   []string // additional plugin settings from the config file
+
+	// Privileges granted to the plugin. They must match what the plugin's
+	// config.json requests, or Docker refuses to enable it.
+	network      string // "" grants no network privilege
+	mounts       []string
+	capabilities []string
+}
+
+// loadInstallerConfig reads the installer configuration from command line
+// flags, falling back to environment variables for anything not set as a flag
+func loadInstallerConfig(args []string, getenv func(string) string) (*installerConfig, error) {
+	env := func(key, defaultValue string) string {
+		if value := getenv(key); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+
+	c := &installerConfig{}
+	var mounts, capabilities, configPath string
+	fs := flag.NewFlagSet("plugin_installer", flag.ContinueOnError)
+	fs.StringVar(&c.pluginName, "plugin", env("plugin_name", "sanjay7178/vault-secrets-plugin:latest"), "plugin reference to install (env plugin_name)")
+	fs.StringVar(&c.remote, "remote", env("remote", ""), "remote to pull the plugin from, defaults to -plugin (env remote)")
+	fs.StringVar(&c.vaultAddr, "vault-addr", env("VAULT_ADDR", ""), "Vault address (env VAULT_ADDR)")
+	fs.StringVar(&c.authMethod, "auth-method", env("VAULT_AUTH_METHOD", "approle"), "Vault auth method: approle or token (env VAULT_AUTH_METHOD)")
+	fs.StringVar(&c.roleID, "role-id", env("VAULT_ROLE_ID", ""), "AppRole role ID (env VAULT_ROLE_ID)")
+	fs.StringVar(&c.secretID, "secret-id", env("VAULT_SECRET_ID", ""), "AppRole secret ID (env VAULT_SECRET_ID)")
+	fs.StringVar(&c.token, "token", env("VAULT_TOKEN", ""), "Vault token (env VAULT_TOKEN)")
+	fs.StringVar(&c.mountPath, "mount-path", env("VAULT_MOUNT_PATH", "secret"), "Vault KV mount path (env VAULT_MOUNT_PATH)")
+	fs.StringVar(&c.network, "network", env("PLUGIN_NETWORK", "host"), "network privilege to grant, empty for none (env PLUGIN_NETWORK)")
+	fs.StringVar(&mounts, "mounts", env("PLUGIN_MOUNTS", "/var/run/docker.sock"), "comma-separated host paths to grant (env PLUGIN_MOUNTS)")
+	fs.StringVar(&capabilities, "capabilities", env("PLUGIN_CAPABILITIES", "CAP_SYS_ADMIN"), "comma-separated capabilities to grant, empty for none (env PLUGIN_CAPABILITIES)")
+	fs.BoolVar(&c.forceRecreate, "force-recreate", env("PLUGIN_FORCE_RECREATE", "false") == "true", "remove and recreate an existing plugin service instead of updating it (env PLUGIN_FORCE_RECREATE)")
+	fs.StringVar(&configPath, "config", env("PLUGIN_CONFIG_FILE", ""), "JSON file with plugin env, mounts and privileges (env PLUGIN_CONFIG_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
-	serviceName := "vault-secrets-plugin"
-	pluginName := "sanjay7178/vault-secrets-plugin:latest"
-	if override, exists := os.LookupEnv("plugin_name"); exists {
-		pluginName = override
-		re := regexp.MustCompile("^(?:.+/|)([^:$]+)(?::.*|)$")
-		serviceName = re.ReplaceAllString(pluginName, "${1}")
+
+	c.serviceName = serviceNameFromPlugin.ReplaceAllString(c.pluginName, "${1}")
+	if c.remote == "" {
+		c.remote = c.pluginName
+	}
+	c.mounts = splitList(mounts)
+	c.capabilities = splitList(capabilities)
+
+	if configPath != "" {
+		file, err := loadConfigFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		file.apply(c)
+	}
+	return c, c.validate()
+}
+
+// validate checks that the settings required to authenticate are present
+func (c *installerConfig) validate() error {
+	var missing []string
+	if c.vaultAddr == "" {
+		missing = append(missing, "VAULT_ADDR")
+	}
+	switch c.authMethod {
+	case "approle":
+		if c.roleID == "" {
+			missing = append(missing, "VAULT_ROLE_ID")
+		}
+		if c.secretID == "" {
+			missing = append(missing, "VAULT_SECRET_ID")
+		}
+	case "token":
+		if c.token == "" {
+			missing = append(missing, "VAULT_TOKEN")
+		}
+	default:
+		return fmt.Errorf("unsupported auth method %q", c.authMethod)
+	}
+	if len(missing) > 0 {
+		return errors.New("missing required settings: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// env returns the environment passed to the plugin
+func (c *installerConfig) env() []string {
+	env := []string{
+		"policy-template={{ .ServiceName }},{{ .TaskImage }},{{ ServiceLabel \"com.docker.ucp.access.label\" }}",
+		"DOCKER_API_VERSION=1.37",
+		"VAULT_ADDR=" + c.vaultAddr,
+		"VAULT_AUTH_METHOD=" + c.authMethod,
+		"VAULT_MOUNT_PATH=" + c.mountPath,
 	}
-	remote := pluginName
-	if override, exists := os.LookupEnv("remote"); exists {
-		remote = override
+	if c.authMethod == "approle" {
+		env = append(env, "VAULT_ROLE_ID="+c.roleID, "VAULT_SECRET_ID="+c.secretID)
+	} else {
+		env = append(env, "VAULT_TOKEN="+c.token)
 	}
-	service, err := cli.ServiceCreate(context.Background(), swarm.ServiceSpec{
+	return append(env, c.extraEnv...)
+}
+
+// privileges returns the privileges granted to the plugin
+func (c *installerConfig) privileges() []*runtime.PluginPrivilege {
+	var privileges []*runtime.PluginPrivilege
+	if c.network != "" {
+		privileges = append(privileges, &runtime.PluginPrivilege{
+			Name:        "network",
+			Description: "permissions to access a network",
+			Value:       []string{c.network},
+		})
+	}
+	if len(c.mounts) > 0 {
+		privileges = append(privileges, &runtime.PluginPrivilege{
+			Name:        "mount",
+			Description: "host path to mount",
+			Value:       c.mounts,
+		})
+	}
+	if len(c.capabilities) > 0 {
+		privileges = append(privileges, &runtime.PluginPrivilege{
+			Name:        "capabilities",
+			Description: "list of additional capabilities required",
+			Value:       c.capabilities,
+		})
+	}
+	return privileges
+}
+
+// buildServiceSpec builds the spec of the swarm service running the plugin
+func buildServiceSpec(c *installerConfig) swarm.ServiceSpec {
+	return swarm.ServiceSpec{
 		Annotations: swarm.Annotations{
-			Name: serviceName,
+			Name: c.serviceName,
 		},
 		TaskTemplate: swarm.TaskSpec{
 			PluginSpec: &runtime.PluginSpec{
-				Name:     pluginName,
-				Remote:   remote,
-				Disabled: false,
-				Privileges: []*runtime.PluginPrivilege{
-					{
-						Name:        "network",
-						Description: "permissions to access a network",
-						Value:       []string{"host"},
-					},
-					{
-						Name:        "mount",
-						Description: "host path to mount",
-						Value:       []string{"/var/run/docker.sock"},
-					},
-					{
-						Name:        "capabilities",
-						Description: "list of additional capabilities required",
-						Value:       []string{"CAP_SYS_ADMIN"},
-					},
-				},
-				Env: []string{
-					"policy-template={{ .ServiceName }},{{ .TaskImage }},{{ ServiceLabel \"com.docker.ucp.access.label\" }}",
-					"DOCKER_API_VERSION=1.37",
-					"VAULT_ADDR=https://152.53.244.80:8200",
-					"VAULT_AUTH_METHOD=approle",
-					"VAULT_ROLE_ID=8ff294a6-9d5c-c5bb-b494-bc0bfe02a97e",
-					"VAULT_SECRET_ID=aedde801-0616-18a5-a62d-c6d7eb483cff",
-					"VAULT_MOUNT_PATH=secret",
-					"DOCKER_API_VERSION=1.37",
-				},
+				Name:       c.pluginName,
+				Remote:     c.remote,
+				Disabled:   false,
+				Privileges: c.privileges(),
+				Env:        c.env(),
 			},
 			Placement: &swarm.Placement{
 				Constraints: []string{"node.role == manager"},
 			},
 			Runtime: swarm.RuntimePlugin,
 		},
-	}, types.ServiceCreateOptions{})
+	}
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func main() {
+	config, err := loadInstallerConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid installer configuration: %v", err)
+	}
+
+	cli, err := dockerclient.NewEnvClient()
+	if err != nil {
+		log.Fatalf("Error creating Docker client: %v", err)
+	}
+	serviceID, err := installService(context.Background(), cli, buildServiceSpec(config), config.forceRecreate)
 	if err != nil {
-		log.Fatalf("Failed to create plugin service: %v", err)
+		log.Fatal(err)
 	}
-	fmt.Println(service.ID)
+	fmt.Println(serviceID)
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEnv returns a getenv function backed by a map
+func testEnv(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestLoadInstallerConfigRequiresCredentials(t *testing.T) {
+	_, err := loadInstallerConfig(nil, testEnv(nil))
+	if err == nil {
+		t.Fatal("Expected an error without Vault settings")
+	}
+	for _, key := range []string{"VAULT_ADDR", "VAULT_ROLE_ID", "VAULT_SECRET_ID"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s to be reported missing, got %v", key, err)
+		}
+	}
+
+	_, err = loadInstallerConfig([]string{"-auth-method", "token", "-vault-addr", "https://vault:8200"}, testEnv(nil))
+	if err == nil || !strings.Contains(err.Error(), "VAULT_TOKEN") {
+		t.Errorf("Expected VAULT_TOKEN to be reported missing, got %v", err)
+	}
+}
+
+func TestBuildServiceSpecDefaultPrivileges(t *testing.T) {
+	config, err := loadInstallerConfig(nil, testEnv(map[string]string{
+		"VAULT_ADDR":      "https://vault:8200",
+		"VAULT_ROLE_ID":   "role",
+		"VAULT_SECRET_ID": "secret",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spec := buildServiceSpec(config)
+	if spec.Name != "vault-secrets-plugin" {
+		t.Errorf("Expected default service name, got %s", spec.Name)
+	}
+
+	plugin := spec.TaskTemplate.PluginSpec
+	granted := make(map[string][]string)
+	for _, privilege := range plugin.Privileges {
+		granted[privilege.Name] = privilege.Value
+	}
+	expected := map[string][]string{
+		"network":      {"host"},
+		"mount":        {"/var/run/docker.sock"},
+		"capabilities": {"CAP_SYS_ADMIN"},
+	}
+	if !reflect.DeepEqual(granted, expected) {
+		t.Errorf("Expected default privileges %v, got %v", expected, granted)
+	}
+
+	env := strings.Join(plugin.Env, "\n")
+	for _, entry := range []string{"VAULT_ADDR=https://vault:8200", "VAULT_AUTH_METHOD=approle", "VAULT_ROLE_ID=role", "VAULT_SECRET_ID=secret", "VAULT_MOUNT_PATH=secret"} {
+		if !strings.Contains(env, entry) {
+			t.Errorf("Expected %s in plugin env, got %v", entry, plugin.Env)
+		}
+	}
+	if strings.Contains(env, "VAULT_TOKEN") {
+		t.Error("AppRole installs must not pass a token")
+	}
+}
+
+func TestBuildServiceSpecOverriddenPrivileges(t *testing.T) {
+	args := []string{"-plugin", "registry.local/org/my-plugin:1.2", "-network", "", "-capabilities", "", "-mounts", "/var/run/docker.sock,/etc/ssl/certs"}
+	config, err := loadInstallerConfig(args, testEnv(map[string]string{
+		"VAULT_ADDR":        "https://vault:8200",
+		"VAULT_AUTH_METHOD": "token",
+		"VAULT_TOKEN":       "hvs.test",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spec := buildServiceSpec(config)
+	if spec.Name != "my-plugin" || spec.TaskTemplate.PluginSpec.Remote != "registry.local/org/my-plugin:1.2" {
+		t.Errorf("Unexpected name %s or remote %s", spec.Name, spec.TaskTemplate.PluginSpec.Remote)
+	}
+
+	privileges := spec.TaskTemplate.PluginSpec.Privileges
+	if len(privileges) != 1 || privileges[0].Name != "mount" {
+		t.Fatalf("Expected only the mount privilege, got %+v", privileges)
+	}
+	if !reflect.DeepEqual(privileges[0].Value, []string{"/var/run/docker.sock", "/etc/ssl/certs"}) {
+		t.Errorf("Unexpected mounts: %v", privileges[0].Value)
+	}
+	if !strings.Contains(strings.Join(spec.TaskTemplate.PluginSpec.Env, "\n"), "VAULT_TOKEN=hvs.test") {
+		t.Error("Expected token in plugin env")
+	}
+}
+
+func TestLoadConfigFileIntoPluginSpec(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "plugin.json")
+	os.WriteFile(configPath, []byte(`{
+		"env": ["VAULT_ADDR=https://vault:8200", "VAULT_AUTH_METHOD=token", "VAULT_TOKEN=hvs.file", "VAULT_ROTATION_INTERVAL=1m"],
+		"network": "",
+		"mounts": ["/var/run/docker.sock", "/etc/ssl/certs"],
+		"capabilities": []
+	}`), 0600)
+
+	config, err := loadInstallerConfig([]string{"-config", configPath}, testEnv(nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plugin := buildServiceSpec(config).TaskTemplate.PluginSpec
+	env := strings.Join(plugin.Env, "\n")
+	for _, entry := range []string{"VAULT_ADDR=https://vault:8200", "VAULT_TOKEN=hvs.file", "VAULT_ROTATION_INTERVAL=1m"} {
+		if !strings.Contains(env, entry) {
+			t.Errorf("Expected %s in plugin env, got %v", entry, plugin.Env)
+		}
+	}
+	if len(plugin.Privileges) != 1 || plugin.Privileges[0].Name != "mount" ||
+		!reflect.DeepEqual(plugin.Privileges[0].Value, []string{"/var/run/docker.sock", "/etc/ssl/certs"}) {
+		t.Errorf("Expected only the mounts from the file, got %+v", plugin.Privileges)
+	}
+}
+
+func TestLoadConfigFileRejectsMalformedInput(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":  `{"env": [`,
+		"unknown field": `{"volumes": ["/data"]}`,
+		"bad env":       `{"env": ["VAULT_ADDR"]}`,
+		"relative path": `{"mounts": ["var/run/docker.sock"]}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "plugin.json")
+			os.WriteFile(configPath, []byte(content), 0600)
+			if _, err := loadConfigFile(configPath); err == nil || !strings.Contains(err.Error(), configPath) {
+				t.Errorf("Expected an error naming the file, got %v", err)
+			}
+		})
+	}
+
+	if _, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Secret check priorities, set with the vault_priority label
+const (
+	priorityHigh = iota
+	priorityNormal
+	priorityLow
+)
+
+// parsePriority maps a vault_priority label value to a priority, defaulting to normal
+func parsePriority(label string) int {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "high":
+		return priorityHigh
+	case "low":
+		return priorityLow
+	case "", "normal":
+		return priorityNormal
+	default:
+		log.Warnf("Unknown vault_priority %q, using normal", label)
+		return priorityNormal
+	}
+}
+
+// secretsDueForCheck orders tracked secrets by priority (then name) and drops
+// low-priority secrets on ticks where they aren't due. lowPriorityEvery <= 1
+// checks low-priority secrets on every tick.
+func secretsDueForCheck(tracked []*SecretInfo, tick uint64, lowPriorityEvery int) []*SecretInfo {
+	due := make([]*SecretInfo, 0, len(tracked))
+	for _, secretInfo := range tracked {
+		if secretInfo.Priority == priorityLow && lowPriorityEvery > 1 && tick%uint64(lowPriorityEvery) != 0 {
+			continue
+		}
+		due = append(due, secretInfo)
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority < due[j].Priority
+		}
+		return due[i].DockerSecretName < due[j].DockerSecretName
+	})
+	return due
+}
+
+// parseCheckInterval parses a vault_rotation_interval label. Empty or invalid
+// values return 0, checking the secret on every sweep.
+func parseCheckInterval(label, secretName string) time.Duration {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(label)
+	if err != nil || interval < 0 {
+		log.Warnf("Invalid vault_rotation_interval %q for secret %s, checking on every sweep", label, secretName)
+		return 0
+	}
+	return interval
+}
+
+// dueByInterval drops the secrets whose own check interval hasn't passed since
+// their last check and schedules the next check of the others
+func (d *VaultDriver) dueByInterval(candidates []*SecretInfo, now time.Time) []*SecretInfo {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	due := candidates[:0]
+	for _, secretInfo := range candidates {
+		if secretInfo.CheckInterval > 0 {
+			if now.Before(secretInfo.NextCheck) {
+				continue
+			}
+			secretInfo.NextCheck = now.Add(secretInfo.CheckInterval)
+		}
+		due = append(due, secretInfo)
+	}
+	return due
+}
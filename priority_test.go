@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func secretNames(secrets []*SecretInfo) []string {
+	names := make([]string, len(secrets))
+	for i, secretInfo := range secrets {
+		names[i] = secretInfo.DockerSecretName
+	}
+	return names
+}
+
+func TestSecretsDueForCheckOrdering(t *testing.T) {
+	tracked := []*SecretInfo{
+		{DockerSecretName: "cache", Priority: parsePriority("low")},
+		{DockerSecretName: "web", Priority: parsePriority("")},
+		{DockerSecretName: "db", Priority: parsePriority("HIGH")},
+		{DockerSecretName: "api", Priority: parsePriority("normal")},
+	}
+
+	due := secretNames(secretsDueForCheck(tracked, 1, 1))
+	expected := []string{"db", "api", "web", "cache"}
+	if len(due) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, due)
+	}
+	for i := range expected {
+		if due[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, due)
+		}
+	}
+}
+
+func TestSecretsDueForCheckCadence(t *testing.T) {
+	tracked := []*SecretInfo{
+		{DockerSecretName: "db", Priority: priorityHigh},
+		{DockerSecretName: "cache", Priority: priorityLow},
+	}
+
+	lowChecks := 0
+	for tick := uint64(1); tick <= 9; tick++ {
+		due := secretNames(secretsDueForCheck(tracked, tick, 3))
+		if due[0] != "db" {
+			t.Fatalf("Expected high-priority secret on every tick, got %v at tick %d", due, tick)
+		}
+		if len(due) == 2 {
+			lowChecks++
+		}
+	}
+	if lowChecks != 3 {
+		t.Errorf("Expected low-priority secret checked 3 times in 9 ticks, got %d", lowChecks)
+	}
+}
+
+func TestPerSecretCheckInterval(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/cert", map[string]interface{}{"value": "c"})
+	fv.setKV2("secret/data/db", map[string]interface{}{"value": "d"})
+	clock := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	driver.Get(secrets.Request{SecretName: "cert", SecretLabels: map[string]string{"vault_rotation_interval": "1h"}})
+	driver.Get(secrets.Request{SecretName: "db"})
+
+	checks := func() (int, int) {
+		return fv.readCount("secret/data/cert"), fv.readCount("secret/data/db")
+	}
+	certBefore, dbBefore := checks()
+
+	// The first sweep checks both and schedules the next check of cert
+	driver.checkForSecretChanges()
+	for _, step := range []time.Duration{10 * time.Minute, 20 * time.Minute, 29 * time.Minute} {
+		clock.Advance(step)
+		driver.checkForSecretChanges()
+	}
+	cert, db := checks()
+	if cert-certBefore != 1 {
+		t.Errorf("Expected cert to be checked once within its interval, got %d checks", cert-certBefore)
+	}
+	if db-dbBefore != 4 {
+		t.Errorf("Expected db to be checked on every sweep, got %d checks", db-dbBefore)
+	}
+
+	clock.Advance(time.Minute)
+	driver.checkForSecretChanges()
+	if cert, _ := checks(); cert-certBefore != 2 {
+		t.Errorf("Expected cert to be checked again after an hour, got %d checks", cert-certBefore)
+	}
+
+	if interval := parseCheckInterval("monthly", "cert"); interval != 0 {
+		t.Errorf("Expected an invalid interval to check on every sweep, got %v", interval)
+	}
+}
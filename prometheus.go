@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prometheusContentType is the version of the text exposition format written
+// by writePrometheus
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricFamily groups the series sharing a metric name
+type metricFamily struct {
+	kind   string // counter, gauge or histogram
+	series []string
+}
+
+// writePrometheus writes all counters, gauges and histograms in the Prometheus
+// text format, one family at a time with its TYPE line
+func (m *driverMetrics) writePrometheus(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	values := make(map[string]float64, len(m.counters)+len(m.gauges))
+	families := make(map[string]*metricFamily)
+	group := func(series, kind string) {
+		name, _, _ := strings.Cut(series, "{")
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && m.histograms[base] {
+				name, kind = base, "histogram"
+				break
+			}
+		}
+		family, exists := families[name]
+		if !exists {
+			family = &metricFamily{kind: kind}
+			families[name] = family
+		}
+		family.series = append(family.series, series)
+	}
+	for series, value := range m.counters {
+		values[series] = value
+		group(series, "counter")
+	}
+	for series, value := range m.gauges {
+		values[series] = value
+		group(series, "gauge")
+	}
+	m.mutex.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := families[name]
+		sort.Strings(family.series)
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, family.kind); err != nil {
+			return err
+		}
+		for _, series := range family.series {
+			if _, err := fmt.Fprintf(w, "%s %s\n", series, strconv.FormatFloat(values[series], 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// readCache holds the Vault reads of one change-detection sweep by path, so
+// Docker secrets sharing a path cost a single read per sweep
+type readCache struct {
+	mutex   sync.Mutex
+	results map[string]readResult
+}
+
+type readResult struct {
+	secret *api.Secret
+	client *api.Client // cluster that served the read
+	err    error
+}
+
+func newReadCache() *readCache {
+	return &readCache{results: make(map[string]readResult)}
+}
+
+func (c *readCache) get(path string) (readResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result, ok := c.results[path]
+	return result, ok
+}
+
+func (c *readCache) put(path string, result readResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.results[path] = result
+}
+
+// sweepRead reads a secret for change detection or rotation. During a sweep,
+// a path already read in it is served from the sweep's cache, so every
+// secret on the path sees the same response, including a failed one.
+func (d *VaultDriver) sweepRead(ctx context.Context, operation, path string) (*api.Secret, *api.Client, error) {
+	cache := d.sweepReads.Load()
+	if cache == nil {
+		return d.timedRead(ctx, operation, path)
+	}
+	if result, ok := cache.get(path); ok {
+		d.metrics.inc("vault_coalesced_reads_total")
+		return result.secret, result.client, result.err
+	}
+	secret, client, err := d.timedRead(ctx, operation, path)
+	cache.put(path, readResult{secret: secret, client: client, err: err})
+	return secret, client, err
+}
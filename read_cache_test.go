@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestSweepCoalescesReadsPerPath(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/shared", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	for _, name := range []string{"web_db", "api_db"} {
+		fd.addSecret(name+"-id", name, nil)
+		fd.addService("svc-"+name, name, name)
+	}
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	labels := map[string]string{"vault_path": "shared", "vault_field": "password"}
+	for _, name := range []string{"web_db", "api_db"} {
+		if resp := driver.Get(secrets.Request{SecretName: name, SecretLabels: labels}); resp.Err != "" {
+			t.Fatalf("Unexpected error for %s: %s", name, resp.Err)
+		}
+	}
+
+	fv.setKV2("secret/data/shared", map[string]interface{}{"password": "v2"})
+	before := fv.readCount("secret/data/shared")
+	summary := driver.checkForSecretChanges()
+
+	if reads := fv.readCount("secret/data/shared") - before; reads != 1 {
+		t.Errorf("Expected a single Vault read for the shared path, got %d", reads)
+	}
+	if summary.Rotated != 2 {
+		t.Errorf("Expected both secrets to rotate, got %+v", summary)
+	}
+	for _, name := range []string{"web_db", "api_db"} {
+		if current := driver.secretTracker[name].CurrentSecretName; current == name {
+			t.Errorf("Expected %s to move to a new version", name)
+		}
+	}
+
+	// The cache lives for one sweep only
+	fv.setKV2("secret/data/shared", map[string]interface{}{"password": "v3"})
+	before = fv.readCount("secret/data/shared")
+	driver.checkForSecretChanges()
+	if reads := fv.readCount("secret/data/shared") - before; reads != 1 {
+		t.Errorf("Expected a fresh read in the next sweep, got %d", reads)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// danglingReference is a service secret reference pointing at a removed secret
+type danglingReference struct {
+	ServiceID  string
+	SecretName string
+	Target     *swarm.Secret // current version the reference should point at
+}
+
+// versionMatcher recognizes the Docker secrets that are versions of a tracked
+// secret. The pattern of rotated version names is compiled once per secret.
+type versionMatcher struct {
+	secretInfo *SecretInfo
+	pattern    *regexp.Regexp
+}
+
+// newVersionMatcher creates a matcher for the <prefix><alias>-<n><suffix>
+// versions of secretInfo
+func newVersionMatcher(secretInfo *SecretInfo, prefix, suffix string) *versionMatcher {
+	pattern := "^" + regexp.QuoteMeta(prefix+secretInfo.DockerSecretName) + `-[0-9]+` + regexp.QuoteMeta(suffix) + "$"
+	return &versionMatcher{secretInfo: secretInfo, pattern: regexp.MustCompile(pattern)}
+}
+
+// matches reports whether name is the alias itself, its tracked current
+// version, or a rotated version. aliases maps existing secret names to their
+// alias label, and a rotated version must carry this secret's alias to match.
+// Removed secrets have no labels, so a nil map matches on the name alone.
+func (m *versionMatcher) matches(name string, aliases map[string]string) bool {
+	if name == m.secretInfo.DockerSecretName || name == m.secretInfo.CurrentSecretName {
+		return true
+	}
+	if !m.pattern.MatchString(name) {
+		return false
+	}
+	return aliases == nil || aliases[name] == m.secretInfo.DockerSecretName
+}
+
+// secretAliases maps secret names to their alias label, for secrets that have one
+func secretAliases(secrets []swarm.Secret) map[string]string {
+	aliases := make(map[string]string)
+	for _, secret := range secrets {
+		if alias := secret.Spec.Labels[secretAliasLabel]; alias != "" {
+			aliases[secret.Spec.Name] = alias
+		}
+	}
+	return aliases
+}
+
+// findDanglingReferences returns references to secrets that no longer exist
+// and can be resolved to the current version of a tracked secret. Secrets
+// deployed in a stack are only resolved for services of the same stack.
+func findDanglingReferences(services []swarm.Service, secrets []swarm.Secret, tracked []*SecretInfo, prefix, suffix string) []danglingReference {
+	existing := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		existing[secret.ID] = true
+	}
+
+	matchers := make([]*versionMatcher, len(tracked))
+	for i, secretInfo := range tracked {
+		matchers[i] = newVersionMatcher(secretInfo, prefix, suffix)
+	}
+
+	var dangling []danglingReference
+	for _, service := range services {
+		if service.Spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		for _, secretRef := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+			if existing[secretRef.SecretID] {
+				continue
+			}
+			// The referenced secret was removed, so only its name is left to match
+			for _, matcher := range matchers {
+				if !matcher.matches(secretRef.SecretName, nil) {
+					continue
+				}
+				secretInfo := matcher.secretInfo
+				if secretInfo.Stack != "" && service.Spec.Labels[stackNamespaceLabel] != secretInfo.Stack {
+					continue
+				}
+				target := findCurrentSecret(inStack(secrets, secretInfo.Stack), secretInfo.DockerSecretName, secretInfo.CurrentSecretName)
+				if target != nil {
+					dangling = append(dangling, danglingReference{
+						ServiceID:  service.ID,
+						SecretName: secretRef.SecretName,
+						Target:     target,
+					})
+				}
+				break
+			}
+		}
+	}
+	return dangling
+}
+
+// reconcileDanglingSecrets rewires services that reference removed secrets,
+// e.g. after an interrupted rotation, to the current tracked version
+func (d *VaultDriver) reconcileDanglingSecrets() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	secrets, err := d.listSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+	services, err := d.listServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+
+	d.trackerMutex.RLock()
+	tracked := make([]*SecretInfo, 0, len(d.secretTracker))
+	for _, secretInfo := range d.secretTracker {
+		copied := *secretInfo
+		tracked = append(tracked, &copied)
+	}
+	d.trackerMutex.RUnlock()
+
+	dangling := findDanglingReferences(services, secrets, tracked, d.config.SecretNamePrefix, d.config.SecretNameSuffix)
+	if len(dangling) == 0 {
+		return nil
+	}
+
+	// Group repairs per service so each service is updated once
+	repairs := make(map[string]map[string]*swarm.Secret)
+	for _, ref := range dangling {
+		if repairs[ref.ServiceID] == nil {
+			repairs[ref.ServiceID] = make(map[string]*swarm.Secret)
+		}
+		repairs[ref.ServiceID][ref.SecretName] = ref.Target
+	}
+
+	for _, service := range services {
+		targets, ok := repairs[service.ID]
+		if !ok {
+			continue
+		}
+		serviceSpec := service.Spec
+		updatedSecrets := make([]*swarm.SecretReference, len(serviceSpec.TaskTemplate.ContainerSpec.Secrets))
+		for i, secretRef := range serviceSpec.TaskTemplate.ContainerSpec.Secrets {
+			if target, ok := targets[secretRef.SecretName]; ok {
+				log.Warnf("Service %s references removed secret %s, rewiring to %s", service.Spec.Name, secretRef.SecretName, target.Spec.Name)
+				updatedSecrets[i] = &swarm.SecretReference{
+					File:       secretRef.File,
+					SecretID:   target.ID,
+					SecretName: target.Spec.Name,
+				}
+			} else {
+				updatedSecrets[i] = secretRef
+			}
+		}
+		serviceSpec.TaskTemplate.ContainerSpec.Secrets = updatedSecrets
+		if serviceSpec.Labels == nil {
+			serviceSpec.Labels = make(map[string]string)
+		}
+		serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", d.now().Unix())
+
+		if _, err := d.updateService(ctx, service, serviceSpec, types.ServiceUpdateOptions{}); err != nil {
+			log.Errorf("Failed to repair service %s: %v", service.Spec.Name, err)
+			continue
+		}
+		d.metrics.inc("vault_dangling_references_repaired_total")
+	}
+	return nil
+}
+
+// reconcileServiceNames rebuilds the service list of every tracked secret from
+// the services that currently reference one of its versions. Requests only
+// ever add services, so without this the lists keep services that were
+// redeployed without the secret or removed. Secrets deployed in a stack only
+// count services of the same stack.
+func (d *VaultDriver) reconcileServiceNames() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	secrets, err := d.listSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+	services, err := d.listServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+	aliases := secretAliases(secrets)
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	for _, secretInfo := range d.secretTracker {
+		matcher := newVersionMatcher(secretInfo, d.config.SecretNamePrefix, d.config.SecretNameSuffix)
+		var names []string
+		for _, service := range services {
+			if service.Spec.TaskTemplate.ContainerSpec == nil {
+				continue
+			}
+			if secretInfo.Stack != "" && service.Spec.Labels[stackNamespaceLabel] != secretInfo.Stack {
+				continue
+			}
+			for _, secretRef := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+				if matcher.matches(secretRef.SecretName, aliases) {
+					names = append(names, service.Spec.Name)
+					break
+				}
+			}
+		}
+		if reflect.DeepEqual(names, secretInfo.ServiceNames) {
+			continue
+		}
+		log.Debugf("Services using secret %s changed from %v to %v", secretInfo.DockerSecretName, secretInfo.ServiceNames, names)
+		secretInfo.ServiceNames = names
+		d.setTrackedInfo(secretInfo)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionMatcher(t *testing.T) {
+	secretInfo := &SecretInfo{DockerSecretName: "db_password", CurrentSecretName: "db_password-200"}
+	matcher := newVersionMatcher(secretInfo, "", "")
+	aliases := map[string]string{"db_password-100": "db_password", "db_password-300": "other"}
+
+	for _, name := range []string{"db_password", "db_password-200", "db_password-100"} {
+		if !matcher.matches(name, aliases) {
+			t.Errorf("Expected %s to be a version of db_password", name)
+		}
+	}
+	// db_password-300 and db_password-400 follow the scheme but aren't labelled as versions of db_password
+	for _, name := range []string{"db_password_old", "other-100", "db_password-abc", "db_password-300", "db_password-400"} {
+		if matcher.matches(name, aliases) {
+			t.Errorf("Expected %s not to be a version of db_password", name)
+		}
+	}
+	if !matcher.matches("db_password-400", nil) {
+		t.Error("Expected a removed version to match on its name")
+	}
+	if !newVersionMatcher(secretInfo, "team_", ".v").matches("team_db_password-100.v", nil) {
+		t.Error("Expected prefixed/suffixed name to be a version")
+	}
+}
+
+func TestReconcileDanglingSecrets(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("current-id", "db_password-200", map[string]string{secretAliasLabel: "db_password"})
+	fd.addSecret("other-id", "other", nil)
+	// web references a version that was removed, api references an untracked secret
+	fd.addService("svc-web", "web", "db_password-100")
+	fd.addService("svc-api", "api", "other")
+
+	driver := &VaultDriver{
+		config:       &VaultConfig{ReconcileDangling: true},
+		dockerClient: fd.client(t),
+		secretTracker: map[string]*SecretInfo{
+			"db_password": {DockerSecretName: "db_password", CurrentSecretName: "db_password-200"},
+		},
+		metrics: newDriverMetrics(),
+	}
+
+	if err := driver.reconcileDanglingSecrets(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !fd.called("POST /services/svc-web/update") {
+		t.Fatal("Expected service with dangling reference to be repaired")
+	}
+	if fd.called("POST /services/svc-api/update") {
+		t.Error("Service with valid references must not be updated")
+	}
+
+	ref := fd.services[0].Spec.TaskTemplate.ContainerSpec.Secrets[0]
+	if ref.SecretName != "db_password-200" || ref.SecretID != "current-id" {
+		t.Errorf("Expected reference rewired to current version, got %s (%s)", ref.SecretName, ref.SecretID)
+	}
+	if driver.metrics.counter("vault_dangling_references_repaired_total") != 1 {
+		t.Error("Expected repair to be counted")
+	}
+}
+
+func TestReconcileServiceNames(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db-200", map[string]string{secretAliasLabel: "db"})
+	fd.addSecret("db-old-id", "db-100", map[string]string{secretAliasLabel: "db"})
+	// Named like a version of db, but created by someone else
+	fd.addSecret("lookalike-id", "db-300", nil)
+	fd.addSecret("app-tls-id", "tls", map[string]string{stackNamespaceLabel: "app"})
+	fd.addService("svc-1", "web", "db-200")
+	fd.addService("svc-2", "worker", "cache")
+	fd.addService("svc-3", "api", "db-200", "cache")
+	fd.addService("svc-4", "legacy", "db-100")
+	fd.addService("svc-5", "imposter", "db-300")
+	fd.addService("svc-6", "app_web", "tls")
+	fd.addService("svc-7", "other_web", "tls")
+	fd.services[5].Spec.Labels = map[string]string{stackNamespaceLabel: "app"}
+	fd.services[6].Spec.Labels = map[string]string{stackNamespaceLabel: "other"}
+	driver := &VaultDriver{
+		config:       &VaultConfig{},
+		dockerClient: fd.client(t),
+		secretTracker: map[string]*SecretInfo{
+			// worker was redeployed without the secret and batch was removed
+			"db":  {DockerSecretName: "db", CurrentSecretName: "db-200", ServiceNames: []string{"web", "worker", "batch"}},
+			"tls": {DockerSecretName: "tls", CurrentSecretName: "tls", Stack: "app", ServiceNames: []string{"web"}},
+		},
+		metrics: newDriverMetrics(),
+	}
+
+	if err := driver.reconcileServiceNames(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if names := driver.secretTracker["db"].ServiceNames; !reflect.DeepEqual(names, []string{"web", "api", "legacy"}) {
+		t.Errorf("Expected stale services to be pruned and labelled versions counted, got %v", names)
+	}
+	if names := driver.secretTracker["tls"].ServiceNames; !reflect.DeepEqual(names, []string{"app_web"}) {
+		t.Errorf("Expected only services of the secret's stack, got %v", names)
+	}
+	if driver.metrics.gauge(`vault_tracked_secret_info{secret="db",path="",provider="vault",services="web,api,legacy"}`) != 1 {
+		t.Errorf("Expected the info series to list the reconciled services, got %v", driver.Metrics())
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// ResolveResult describes where Get would read a secret from and which fields
+// it would use. It never contains secret values.
+type ResolveResult struct {
+	Path   string   `json:"path"`
+	Exists bool     `json:"exists"`
+	Fields []string `json:"fields,omitempty"` // fields the value would be built from
+	Error  string   `json:"error,omitempty"`  // why Get would fail for an existing secret
+}
+
+// ResolveSecret resolves a secret request the way Get does, without serving
+// it. Labels the plugin would refuse are returned as an error.
+func (d *VaultDriver) ResolveSecret(req secrets.Request) (ResolveResult, error) {
+	if req.SecretName == "" {
+		return ResolveResult{}, fmt.Errorf("secret name is required")
+	}
+	if err := d.checkLabelCount(req); err != nil {
+		return ResolveResult{}, err
+	}
+	req.SecretLabels = d.filterLabels(req)
+	if err := d.validateLabels(req); err != nil {
+		return ResolveResult{}, err
+	}
+
+	result := ResolveResult{Path: d.buildSecretPath(req)}
+	ctx, cancel := context.WithTimeout(context.Background(), d.readTimeout(operationGet))
+	defer cancel()
+	secret, _, err := d.readSecret(ctx, result.Path)
+	if err != nil {
+		return result, fmt.Errorf("failed to read secret from vault: %v", err)
+	}
+	if secret == nil || checkSecretDeleted(secret) != nil {
+		return result, nil
+	}
+	result.Exists = true
+
+	data, err := secretFields(secret)
+	if err == nil {
+		result.Fields, err = d.resolveFields(data, req)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// resolveFields returns the names of the fields extractSecretValue would
+// build the value from, failing where it would fail on a missing field
+func (d *VaultDriver) resolveFields(data map[string]interface{}, req secrets.Request) ([]string, error) {
+	format, err := parseFormat(req.SecretLabels["vault_format"])
+	if err != nil {
+		return nil, err
+	}
+	if format == formatProperties {
+		return d.includedFields(data), nil
+	}
+
+	fields := parseList(req.SecretLabels["vault_pem_bundle"])
+	if fields == nil {
+		fields, _ = parseFieldJoin(req)
+	}
+	if fields != nil {
+		for _, field := range fields {
+			if _, ok := data[field]; !ok {
+				return nil, fmt.Errorf("field %s not found in secret", field)
+			}
+		}
+		return fields, nil
+	}
+
+	field, err := resolveVaultField(req)
+	if err != nil {
+		return nil, err
+	}
+	if field != "" {
+		if _, ok := data[field]; !ok {
+			return nil, fmt.Errorf("field %s not found in secret", field)
+		}
+		return []string{field}, nil
+	}
+	for _, field := range []string{"value", "password", "secret", "data"} {
+		if _, ok := data[field]; ok && !d.config.ExcludeFields[field] {
+			return []string{field}, nil
+		}
+	}
+
+	switch d.config.FallbackPolicy {
+	case fallbackError:
+		return nil, fmt.Errorf("no explicit or default field found in secret, set vault_field")
+	case fallbackRaw:
+		return d.includedFields(data), nil
+	}
+	for _, field := range d.includedFields(data) {
+		if _, ok := data[field].(string); ok {
+			return []string{field}, nil
+		}
+	}
+	return nil, fmt.Errorf("no suitable secret value found")
+}
+
+// includedFields returns the sorted field names not excluded by VAULT_EXCLUDE_FIELDS
+func (d *VaultDriver) includedFields(data map[string]interface{}) []string {
+	names := make([]string, 0, len(data))
+	for field := range data {
+		if !d.config.ExcludeFields[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// retryAfterBackoff returns a Vault client backoff that waits as long as a 429
+// or 503 response's Retry-After header asks, capped at limit. Other retries
+// keep the client's default linear jitter backoff. Waits end early when the
+// request's context is done.
+func retryAfterBackoff(limit time.Duration) retryablehttp.Backoff {
+	return func(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+		if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+			if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if wait > limit {
+					wait = limit
+				}
+				return wait
+			}
+		}
+		return retryablehttp.LinearJitterBackoff(min, max, attempt, resp)
+	}
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP
+// date, relative to now
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		wait, ok := parseRetryAfter(tt.value, now)
+		if wait != tt.wait || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", tt.value, wait, ok, tt.wait, tt.ok)
+		}
+	}
+}
+
+func TestVaultClientHonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"data":{"password":"p"}}}`))
+	}))
+	defer server.Close()
+
+	// Retry-After asks for 10s, capped to 200ms
+	client, err := newVaultClient(&VaultConfig{MaxRetryAfter: 200 * time.Millisecond}, server.URL, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client.SetToken("test")
+
+	start := time.Now()
+	secret, err := client.Logical().Read("secret/data/db")
+	elapsed := time.Since(start)
+	if err != nil || secret == nil {
+		t.Fatalf("Expected the read to succeed after a retry, got %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests.Load())
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Expected to wait the capped Retry-After, waited %v", elapsed)
+	}
+}
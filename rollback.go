@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rollbackCandidate is the previous version of a rotated secret, kept for
+// VAULT_ROLLBACK_TTL so services can be rewired back to it
+type rollbackCandidate struct {
+	SecretName string    // Docker secret holding the previous value
+	ValueHash  string    // hash of the previous value
+	Until      time.Time // when the version is removed
+}
+
+// keepForRollback reports whether the version replaced by a rotation of
+// secretName is kept as a rollback candidate instead of being removed.
+// Aliases aren't tracked and are never rolled back.
+func (d *VaultDriver) keepForRollback(secretName string) bool {
+	if d.config.RollbackTTL <= 0 {
+		return false
+	}
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	_, tracked := d.secretTracker[secretName]
+	return tracked
+}
+
+// setRollback records the version a rotation replaced, dropping the candidate
+// of an earlier rotation
+func (d *VaultDriver) setRollback(secretInfo *SecretInfo, previousName, previousHash string) {
+	if d.config.RollbackTTL <= 0 {
+		return
+	}
+	d.trackerMutex.Lock()
+	replaced := secretInfo.Rollback
+	secretInfo.Rollback = &rollbackCandidate{
+		SecretName: previousName,
+		ValueHash:  previousHash,
+		Until:      d.now().Add(d.config.RollbackTTL),
+	}
+	d.trackerMutex.Unlock()
+	if replaced != nil {
+		d.removeSecretVersion(replaced.SecretName)
+	}
+}
+
+// expireRollbacks removes the rollback candidates whose TTL has passed
+func (d *VaultDriver) expireRollbacks(now time.Time) {
+	var expired []string
+	d.trackerMutex.Lock()
+	for _, secretInfo := range d.secretTracker {
+		if secretInfo.Rollback != nil && !now.Before(secretInfo.Rollback.Until) {
+			expired = append(expired, secretInfo.Rollback.SecretName)
+			secretInfo.Rollback = nil
+		}
+	}
+	d.trackerMutex.Unlock()
+	for _, name := range expired {
+		d.removeSecretVersion(name)
+	}
+}
+
+// removeSecretVersion removes a Docker secret version by name unless old
+// versions are kept
+func (d *VaultDriver) removeSecretVersion(name string) {
+	if d.config.KeepOldSecrets {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	secrets, err := d.listSecrets(ctx)
+	if err != nil {
+		log.Warnf("Failed to list secrets to remove old version %s: %v", name, err)
+		return
+	}
+	for _, secret := range secrets {
+		if secret.Spec.Name == name {
+			if err := d.dockerClient.SecretRemove(ctx, secret.ID); err != nil {
+				log.Warnf("Failed to remove old secret version %s: %v", name, err)
+			}
+			return
+		}
+	}
+}
+
+// RollbackRotation rewires the services of a secret back to the version its
+// last rotation replaced, as long as the candidate hasn't expired. The
+// rolled-back value stays in use until the value in Vault changes again.
+func (d *VaultDriver) RollbackRotation(secretName string) error {
+	d.rotationMutex.Lock()
+	defer d.rotationMutex.Unlock()
+
+	d.trackerMutex.RLock()
+	secretInfo, exists := d.secretTracker[secretName]
+	var candidate *rollbackCandidate
+	var currentName string
+	if exists {
+		candidate = secretInfo.Rollback
+		currentName = secretInfo.CurrentSecretName
+	}
+	d.trackerMutex.RUnlock()
+	if candidate == nil || !d.now().Before(candidate.Until) {
+		return fmt.Errorf("no rollback available for secret %s", secretName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	secrets, err := d.listSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+	var previousID, currentID string
+	for _, secret := range secrets {
+		switch secret.Spec.Name {
+		case candidate.SecretName:
+			previousID = secret.ID
+		case currentName:
+			currentID = secret.ID
+		}
+	}
+	if previousID == "" {
+		return fmt.Errorf("previous version %s of secret %s no longer exists", candidate.SecretName, secretName)
+	}
+
+	updated, failed, err := d.updateServicesSecretReference([]string{currentName}, candidate.SecretName, previousID, true)
+	if err != nil {
+		// Move the services that were rolled back forward again, so every
+		// service stays on the tracked current version
+		if len(updated) > 0 {
+			if _, _, forwardErr := d.updateServicesSecretReference([]string{candidate.SecretName}, currentName, currentID, true); forwardErr != nil {
+				log.Errorf("Failed to move services of secret %s back to version %s: %v", secretName, currentName, forwardErr)
+			}
+		}
+		return fmt.Errorf("failed to roll back secret %s: updated %v, failed %v: %v", secretName, updated, failed, err)
+	}
+
+	d.trackerMutex.Lock()
+	secretInfo.CurrentSecretName = candidate.SecretName
+	secretInfo.ValueHash = candidate.ValueHash
+	secretInfo.Rollback = nil
+	d.trackerMutex.Unlock()
+
+	d.removeSecretVersion(currentName)
+	d.metrics.inc("vault_rollbacks_total")
+	log.Printf("Rolled back secret %s to version %s for services %v", secretName, candidate.SecretName, updated)
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func newRollbackTestDriver(t *testing.T) (*VaultDriver, *fakeVault, *fakeDocker, *fakeClock) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+	clock := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, RollbackTTL: time.Hour},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	return driver, fv, fd, clock
+}
+
+func TestRollbackRotation(t *testing.T) {
+	driver, fv, fd, clock := newRollbackTestDriver(t)
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	rotated := driver.secretTracker["db"].CurrentSecretName
+	if rotated == "db" {
+		t.Fatal("Expected the secret to be rotated")
+	}
+	// The replaced version is kept as the rollback candidate
+	if fd.secretByName("db") == nil {
+		t.Fatal("Expected the previous version to be kept for rollback")
+	}
+	if candidate := driver.secretTracker["db"].Rollback; candidate == nil || candidate.SecretName != "db" || !candidate.Until.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("Expected db to be the rollback candidate for an hour, got %+v", candidate)
+	}
+
+	if err := driver.RollbackRotation("db"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if names := fd.serviceSecretNames("svc-1"); !reflect.DeepEqual(names, []string{"db"}) {
+		t.Errorf("Expected the service to be rewired to the previous version, got %v", names)
+	}
+	if fd.secretByName(rotated) != nil {
+		t.Errorf("Expected the rolled-back version %s to be removed", rotated)
+	}
+	if name := driver.secretTracker["db"].CurrentSecretName; name != "db" {
+		t.Errorf("Expected db to be current again, got %s", name)
+	}
+	if count := driver.metrics.counter("vault_rollbacks_total"); count != 1 {
+		t.Errorf("Expected 1 rollback, got %v", count)
+	}
+
+	// The rolled-back value stays until Vault changes again
+	if summary := driver.checkForSecretChanges(); summary.Changed != 0 {
+		t.Errorf("Expected no rotation after a rollback, got %+v", summary)
+	}
+	if err := driver.RollbackRotation("db"); err == nil {
+		t.Error("Expected a second rollback to fail")
+	}
+}
+
+func TestRollbackCandidateExpires(t *testing.T) {
+	driver, fv, fd, clock := newRollbackTestDriver(t)
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	clock.Advance(time.Hour)
+	driver.expireRollbacks(clock.Now())
+	if fd.secretByName("db") != nil {
+		t.Error("Expected the previous version to be removed once the TTL passed")
+	}
+	if err := driver.RollbackRotation("db"); err == nil {
+		t.Error("Expected no rollback after the TTL")
+	}
+}
+
+func TestRollbackPartialFailureKeepsCurrentVersion(t *testing.T) {
+	driver, fv, fd, _ := newRollbackTestDriver(t)
+	fd.addService("svc-2", "api", "db")
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+	rotated := driver.secretTracker["db"].CurrentSecretName
+
+	fd.failUpdates("svc-2")
+	if err := driver.RollbackRotation("db"); err == nil {
+		t.Fatal("Expected the rollback to fail")
+	}
+	// web was rolled back and moved forward again, so no service is left on
+	// an untracked version
+	for _, id := range []string{"svc-1", "svc-2"} {
+		if names := fd.serviceSecretNames(id); !reflect.DeepEqual(names, []string{rotated}) {
+			t.Errorf("Expected service %s to stay on %s, got %v", id, rotated, names)
+		}
+	}
+	secretInfo := driver.secretTracker["db"]
+	if secretInfo.CurrentSecretName != rotated || secretInfo.Rollback == nil {
+		t.Errorf("Expected %s to stay current with its rollback candidate, got %+v", rotated, secretInfo)
+	}
+	if fd.secretByName(rotated) == nil || fd.secretByName("db") == nil {
+		t.Error("Expected both versions to be kept")
+	}
+}
@@ -51,7 +51,7 @@ func TestSecretRotationWorkflow(t *testing.T) {
 	vaultPath := "secret/data/app/config"
 
 	// Track the initial secret
-	driver.trackSecret(req, vaultPath, initialValue)
+	driver.trackSecret(req, vaultPath, initialValue, false)
 
 	// Verify tracking
 	if len(driver.secretTracker) != 1 {
@@ -84,7 +84,7 @@ func TestSecretRotationWorkflow(t *testing.T) {
 	// Test service tracking for multiple services
 	req2 := req
 	req2.ServiceName = "api-service"
-	driver.trackSecret(req2, vaultPath, initialValue)
+	driver.trackSecret(req2, vaultPath, initialValue, false)
 
 	// Should still have 1 secret but with 2 services
 	if len(driver.secretTracker) != 1 {
@@ -219,6 +219,6 @@ func BenchmarkSecretTracking(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		req.SecretName = fmt.Sprintf("secret-%d", i)
-		driver.trackSecret(req, vaultPath, value)
+		driver.trackSecret(req, vaultPath, value, false)
 	}
 }
\ No newline at end of file
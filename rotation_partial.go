@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Behaviours for VAULT_ROTATION_PARTIAL when some service updates fail during a rotation
+const (
+	partialAbort    = "abort"    // stop at the first failure, leaving updated services on the new version
+	partialContinue = "continue" // keep updating the remaining services
+	partialRollback = "rollback" // move updated services back to the old version
+)
+
+// parsePartialMode validates a VAULT_ROTATION_PARTIAL value, defaulting to abort
+func parsePartialMode(value string) string {
+	mode := strings.ToLower(strings.TrimSpace(value))
+	switch mode {
+	case partialAbort, partialContinue, partialRollback:
+		return mode
+	}
+	log.Warnf("Invalid rotation partial mode %q, using %s", value, partialAbort)
+	return partialAbort
+}
+
+// serviceUpdateError reports a rotation whose service updates failed, along
+// with the services that were and weren't moved to the new secret version
+type serviceUpdateError struct {
+	updated []string
+	failed  []string
+	err     error
+}
+
+func (e *serviceUpdateError) Error() string {
+	return fmt.Sprintf("failed to update services to use new secret: %v", e.err)
+}
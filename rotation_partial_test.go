@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// newPartialDriver sets up three services using db_password, where the update
+// of the second one fails
+func newPartialDriver(t *testing.T, mode string) (*VaultDriver, *fakeDocker) {
+	fd := newFakeDocker(t)
+	fd.addSecret("old-id", "db_password", nil)
+	fd.addService("svc-1", "web", "db_password")
+	fd.addService("svc-2", "api", "db_password")
+	fd.addService("svc-3", "worker", "db_password")
+	fd.failUpdates("svc-2")
+
+	driver := &VaultDriver{
+		config:        &VaultConfig{RotationPartial: mode},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		history:       newRotationHistory(10),
+	}
+	return driver, fd
+}
+
+func TestRotationPartialModes(t *testing.T) {
+	tests := []struct {
+		mode      string
+		updated   []string
+		failed    []string
+		keepNew   bool
+		onVersion map[string]bool // service ID -> references the new version
+	}{
+		{partialAbort, []string{"web"}, []string{"api"}, true, map[string]bool{"svc-1": true, "svc-2": false, "svc-3": false}},
+		{partialContinue, []string{"web", "worker"}, []string{"api"}, true, map[string]bool{"svc-1": true, "svc-2": false, "svc-3": true}},
+		{partialRollback, nil, []string{"api"}, false, map[string]bool{"svc-1": false, "svc-2": false, "svc-3": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			driver, fd := newPartialDriver(t, tt.mode)
+
+			_, _, _, err := driver.updateDockerSecret("db_password", "db_password", "", []byte("new"))
+			var updateErr *serviceUpdateError
+			if !errors.As(err, &updateErr) {
+				t.Fatalf("Expected service update error, got %v", err)
+			}
+			if !reflect.DeepEqual(updateErr.updated, tt.updated) || !reflect.DeepEqual(updateErr.failed, tt.failed) {
+				t.Errorf("Expected updated %v and failed %v, got %v and %v", tt.updated, tt.failed, updateErr.updated, updateErr.failed)
+			}
+
+			if fd.called("DELETE /secrets/old-id") {
+				t.Error("Old secret version must not be removed after a failed rotation")
+			}
+			if kept := !fd.called("DELETE /secrets/new-secret-1"); kept != tt.keepNew {
+				t.Errorf("Expected new version kept to be %v", tt.keepNew)
+			}
+			for id, onNew := range tt.onVersion {
+				names := fd.serviceSecretNames(id)
+				if (names[0] != "db_password") != onNew {
+					t.Errorf("Service %s references %v, expected new version: %v", id, names, onNew)
+				}
+			}
+		})
+	}
+}
+
+func TestRotationPartialRecordsServices(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db_password", map[string]interface{}{"password": "new"})
+	driver, _ := newPartialDriver(t, partialContinue)
+	driver.client = fv.client(t)
+
+	secretInfo := &SecretInfo{
+		DockerSecretName:  "db_password",
+		CurrentSecretName: "db_password",
+		VaultPath:         "secret/data/db_password",
+		VaultField:        "password",
+		LastHash:          "old",
+	}
+	if _, err := driver.rotateSecret(secretInfo); err == nil {
+		t.Fatal("Expected partial rotation to fail")
+	}
+	if secretInfo.LastHash != "old" || secretInfo.CurrentSecretName != "db_password" {
+		t.Error("Expected tracking to be unchanged so the next sweep retries")
+	}
+
+	records := driver.RotationHistory()
+	if len(records) != 1 {
+		t.Fatalf("Expected one history record, got %d", len(records))
+	}
+	if !reflect.DeepEqual(records[0].UpdatedServices, []string{"web", "worker"}) || !reflect.DeepEqual(records[0].FailedServices, []string{"api"}) {
+		t.Errorf("Expected updated and failed services in history, got %+v", records[0])
+	}
+	if count := driver.metrics.counter(`vault_rotation_service_updates_total{result="success"}`); count != 2 {
+		t.Errorf("Expected 2 successful service updates, got %v", count)
+	}
+	if count := driver.metrics.counter(`vault_rotation_service_updates_total{result="error"}`); count != 1 {
+		t.Errorf("Expected 1 failed service update, got %v", count)
+	}
+}
+
+func TestParsePartialMode(t *testing.T) {
+	for input, expected := range map[string]string{
+		"abort":    partialAbort,
+		"Continue": partialContinue,
+		"rollback": partialRollback,
+		"":         partialAbort,
+		"retry":    partialAbort,
+	} {
+		if got := parsePartialMode(input); got != expected {
+			t.Errorf("parsePartialMode(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestPartialRotationCompletedByNextSweep(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db_password", map[string]interface{}{"password": "old"})
+	driver, fd := newPartialDriver(t, partialContinue)
+	driver.client = fv.client(t)
+	driver.config.MountPath = "secret"
+	driver.config.EnableRotation = true
+	clock := newFakeClock(time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC))
+	driver.clock = clock
+
+	req := secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+
+	fv.setKV2("secret/data/db_password", map[string]interface{}{"password": "new"})
+	if summary := driver.checkForSecretChanges(); summary.Failed != 1 {
+		t.Fatalf("Expected the partial rotation to fail, got %+v", summary)
+	}
+	partial := fd.serviceSecretNames("svc-1")[0]
+	if partial == "db_password" {
+		t.Fatal("Expected web to be moved to the partially applied version")
+	}
+
+	// The next sweep moves every service, including those already on the
+	// partially applied version, and removes that version
+	fd.allowUpdates("svc-2")
+	clock.Advance(time.Minute)
+	if summary := driver.checkForSecretChanges(); summary.Rotated != 1 {
+		t.Fatalf("Expected the rotation to complete, got %+v", summary)
+	}
+	current := driver.secretTracker["db_password"].CurrentSecretName
+	if current == partial || current == "db_password" {
+		t.Fatalf("Expected a new current version, got %s", current)
+	}
+	for _, id := range []string{"svc-1", "svc-2", "svc-3"} {
+		if names := fd.serviceSecretNames(id); names[0] != current {
+			t.Errorf("Expected service %s to use %s, got %v", id, current, names)
+		}
+	}
+	for _, name := range []string{"db_password", partial} {
+		if fd.secretByName(name) != nil {
+			t.Errorf("Expected version %s to be removed", name)
+		}
+	}
+}
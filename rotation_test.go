@@ -30,7 +30,7 @@ func TestSecretTracking(t *testing.T) {
 	secretValue := []byte("test-password")
 
 	// Test secret tracking
-	driver.trackSecret(req, vaultPath, secretValue)
+	driver.trackSecret(req, vaultPath, secretValue, false)
 
 	// Check if secret is tracked
 	if len(driver.secretTracker) != 1 {
@@ -57,7 +57,7 @@ func TestSecretTracking(t *testing.T) {
 	// Test adding same secret with different service
 	req2 := req
 	req2.ServiceName = "another-service"
-	driver.trackSecret(req2, vaultPath, secretValue)
+	driver.trackSecret(req2, vaultPath, secretValue, false)
 
 	// Should still have 1 secret but with 2 services
 	if len(driver.secretTracker) != 1 {
@@ -77,12 +77,21 @@ func TestParseDurationOrDefault(t *testing.T) {
 		{"5m", 5 * time.Minute},
 		{"1h", 1 * time.Hour},
 		{"30s", 30 * time.Second},
-		{"invalid", 5 * time.Minute}, // Should return default
-		{"", 5 * time.Minute},        // Should return default
+		{"invalid", 10 * time.Second}, // Should return default
+		{"", 10 * time.Second},        // Should return default
+		{"300", 5 * time.Minute},      // Bare integers are seconds
+		{" 5m ", 5 * time.Minute},
+		{"5 min", 5 * time.Minute},
+		{"2 hours", 2 * time.Hour},
+		{"90sec", 90 * time.Second},
+		{"5 fortnights", 10 * time.Second}, // Unknown unit returns default
+		{"-10", 10 * time.Second},
+		{"-5m", 10 * time.Second},
+		{"0", 0},
 	}
 
 	for _, test := range tests {
-		result := parseDurationOrDefault(test.input)
+		result := parseDurationOrDefault(test.input, 10*time.Second)
 		if result != test.expected {
 			t.Errorf("For input '%s', expected %v, got %v", test.input, test.expected, result)
 		}
@@ -101,4 +110,27 @@ func TestConfigurationDefaults(t *testing.T) {
 	if !enableRotation {
 		t.Error("Expected rotation to be enabled by default")
 	}
-}
\ No newline at end of file
+}
+func TestRotationRequireConsumers(t *testing.T) {
+	driver := &VaultDriver{
+		config:  &VaultConfig{RequireConsumers: false},
+		metrics: newDriverMetrics(),
+	}
+
+	// Default: zero consumers is only a warning
+	if err := driver.checkRotationConsumers("db_password", nil); err != nil {
+		t.Errorf("Expected no error when consumers are not required, got %v", err)
+	}
+
+	driver.config.RequireConsumers = true
+	if err := driver.checkRotationConsumers("db_password", nil); err == nil {
+		t.Error("Expected error for zero-consumer rotation")
+	}
+	if err := driver.checkRotationConsumers("db_password", []string{"web"}); err != nil {
+		t.Errorf("Expected no error when a service was updated, got %v", err)
+	}
+
+	if count := driver.metrics.counter("vault_rotation_no_consumers_total"); count != 2 {
+		t.Errorf("Expected 2 zero-consumer rotations counted, got %v", count)
+	}
+}
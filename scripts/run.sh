@@ -1,5 +1,7 @@
 #!/bin/bash
 
+# The installer needs VAULT_ADDR plus VAULT_ROLE_ID/VAULT_SECRET_ID (or
+# VAULT_AUTH_METHOD=token and VAULT_TOKEN) in the environment
 ./plugin_installer/plugin_installer
 until [[ "$(docker plugin inspect sanjay7178/vault-secrets-plugin:latest --format '{{.Enabled}}' 2>/dev/null)" == "true" ]]
 do
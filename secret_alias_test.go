@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func newTestSecret(id, name string, created time.Time, labels map[string]string) swarm.Secret {
+	secret := swarm.Secret{ID: id}
+	secret.CreatedAt = created
+	secret.Spec.Name = name
+	secret.Spec.Labels = labels
+	return secret
+}
+
+func TestFindCurrentSecret(t *testing.T) {
+	now := time.Now()
+	list := []swarm.Secret{
+		newTestSecret("id-other", "other", now, nil),
+		newTestSecret("id-v1", "db_password-100", now.Add(-time.Hour), map[string]string{secretAliasLabel: "db_password"}),
+		newTestSecret("id-v2", "db_password-200", now, map[string]string{secretAliasLabel: "db_password"}),
+	}
+
+	// The tracked current name wins
+	if secret := findCurrentSecret(list, "db_password", "db_password-100"); secret == nil || secret.ID != "id-v1" {
+		t.Errorf("Expected tracked version id-v1, got %v", secret)
+	}
+
+	// Without a matching current name, the newest aliased version is used
+	if secret := findCurrentSecret(list, "db_password", "db_password"); secret == nil || secret.ID != "id-v2" {
+		t.Errorf("Expected newest aliased version id-v2, got %v", secret)
+	}
+
+	// The original secret is found by name before any rotation
+	original := []swarm.Secret{newTestSecret("id-orig", "db_password", now, nil)}
+	if secret := findCurrentSecret(original, "db_password", "db_password"); secret == nil || secret.ID != "id-orig" {
+		t.Errorf("Expected original secret id-orig, got %v", secret)
+	}
+
+	if secret := findCurrentSecret(list, "missing", "missing"); secret != nil {
+		t.Errorf("Expected no secret for unknown alias, got %s", secret.ID)
+	}
+}
+
+func TestTrackSecretKeepsCurrentVersion(t *testing.T) {
+	driver := &VaultDriver{
+		config:        &VaultConfig{EnableRotation: true},
+		secretTracker: make(map[string]*SecretInfo),
+	}
+	req := secrets.Request{SecretName: "db_password", ServiceName: "web"}
+
+	driver.trackSecret(req, "secret/data/db_password", []byte("v1"), false)
+	secretInfo := driver.secretTracker["db_password"]
+	if secretInfo.CurrentSecretName != "db_password" {
+		t.Fatalf("Expected current name to start as the alias, got %s", secretInfo.CurrentSecretName)
+	}
+
+	// Simulate a completed rotation, then a new request for the alias
+	secretInfo.CurrentSecretName = "db_password-200"
+	driver.trackSecret(req, "secret/data/db_password", []byte("v2"), false)
+	if secretInfo.CurrentSecretName != "db_password-200" {
+		t.Errorf("Expected current version to be kept after re-tracking, got %s", secretInfo.CurrentSecretName)
+	}
+}
+
+func TestUpdateDockerSecretRotatesAlias(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("old-id", "db_password", map[string]string{"vault_path": "database/mysql"})
+	fd.addService("svc-1", "web", "db_password")
+
+	driver := &VaultDriver{
+		config:       &VaultConfig{},
+		dockerClient: fd.client(t),
+		metrics:      newDriverMetrics(),
+	}
+
+	newName, _, _, err := driver.updateDockerSecret("db_password", "db_password", "", []byte("new"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	created := fd.secretByName(newName)
+	if created == nil {
+		t.Fatalf("Expected new secret version %s to be created", newName)
+	}
+	if created.Spec.Labels[secretAliasLabel] != "db_password" || created.Spec.Labels["vault_path"] != "database/mysql" {
+		t.Errorf("Expected alias and original labels on new version, got %v", created.Spec.Labels)
+	}
+	if !fd.called("POST /services/svc-1/update") {
+		t.Error("Expected service to be updated")
+	}
+	if !fd.called("DELETE /secrets/old-id") {
+		t.Error("Expected old secret version to be removed")
+	}
+}
+
+func TestUpdateDockerSecretKeepOld(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("old-id", "db_password", nil)
+	fd.addService("svc-1", "web", "db_password")
+
+	driver := &VaultDriver{
+		config:       &VaultConfig{KeepOldSecrets: true},
+		dockerClient: fd.client(t),
+		metrics:      newDriverMetrics(),
+	}
+
+	if _, _, _, err := driver.updateDockerSecret("db_password", "db_password", "", []byte("new")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !fd.called("POST /services/svc-1/update") {
+		t.Error("Expected service to be updated")
+	}
+	if fd.called("DELETE /secrets/old-id") {
+		t.Error("Old secret version must not be removed when keeping old versions")
+	}
+}
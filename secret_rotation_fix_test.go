@@ -32,6 +32,34 @@ func TestSecretNameGeneration(t *testing.T) {
 	t.Logf("Success: Secret name generation works correctly: '%s' -> '%s'", originalName, newSecretName)
 }
 
+func TestVersionedSecretNamePrefixSuffix(t *testing.T) {
+	name, err := versionedSecretName("mysql_root_password", 1625731200, "team-a_", ".v")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "team-a_mysql_root_password-1625731200.v"
+	if name != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, name)
+	}
+
+	// Without prefix/suffix the name keeps the original scheme
+	if name, _ := versionedSecretName("mysql_root_password", 1625731200, "", ""); name != "mysql_root_password-1625731200" {
+		t.Errorf("Expected unchanged scheme without prefix/suffix, got '%s'", name)
+	}
+
+	// Names that Docker would reject are refused
+	invalid := []struct{ prefix, suffix string }{
+		{"team a/", ""},
+		{"", "-"},
+		{strings.Repeat("x", 60), ""},
+	}
+	for _, tc := range invalid {
+		if name, err := versionedSecretName("mysql_root_password", 1625731200, tc.prefix, tc.suffix); err == nil {
+			t.Errorf("Expected invalid name error, got '%s'", name)
+		}
+	}
+}
+
 func TestSecretReferenceUpdate(t *testing.T) {
 	// Test that secret references are updated correctly
 	oldSecretName := "myapp_mysql_root_password"
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rotated versions of tracked secrets record where their value came from and
+// its hash, so a restarted plugin can track them again before any service
+// requests them
+const (
+	secretPathLabel      = "vault.secret.path"
+	secretValueHashLabel = "vault.secret.value_hash"
+)
+
+// labelTrackedVersion adds the seed labels to a new version of secretName.
+// Only tracked secrets get them; aliases and self-test secrets aren't tracked.
+func (d *VaultDriver) labelTrackedVersion(labels map[string]string, secretName string, value []byte) {
+	d.trackerMutex.RLock()
+	secretInfo, tracked := d.secretTracker[secretName]
+	var vaultPath string
+	if tracked {
+		vaultPath = secretInfo.VaultPath
+	}
+	d.trackerMutex.RUnlock()
+	if !tracked {
+		return
+	}
+	labels[secretPathLabel] = vaultPath
+	labels[secretValueHashLabel] = hashValue(d.config.HashAlgo, value)
+}
+
+// seedTracker tracks the secrets this plugin rotated before it was restarted,
+// from the newest version carrying the seed labels. The recorded value hash
+// is the change-detection baseline, so the first sweep rotates secrets that
+// changed while the plugin was down. Secrets already tracked are left alone.
+func (d *VaultDriver) seedTracker() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	secretList, err := d.listSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+	services, err := d.listServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+
+	newest := make(map[string]swarm.Secret)
+	for _, secret := range secretList {
+		labels := secret.Spec.Labels
+		name := labels[secretAliasLabel]
+		if name == "" || labels[secretPathLabel] == "" || labels[secretValueHashLabel] == "" {
+			continue
+		}
+		if current, found := newest[name]; !found || secret.CreatedAt.After(current.CreatedAt) {
+			newest[name] = secret
+		}
+	}
+
+	seeded := 0
+	for name, version := range newest {
+		d.trackerMutex.RLock()
+		_, tracked := d.secretTracker[name]
+		d.trackerMutex.RUnlock()
+		if tracked {
+			continue
+		}
+
+		// The version carries the labels of the secret services requested
+		req := secrets.Request{SecretName: name, SecretLabels: version.Spec.Labels}
+		req.SecretLabels = d.filterLabels(req)
+		if err := d.validateLabels(req); err != nil {
+			log.Warnf("Not seeding secret %s: %v", name, err)
+			continue
+		}
+		hash := version.Spec.Labels[secretValueHashLabel]
+		d.trackSecretHash(req, version.Spec.Labels[secretPathLabel], hash, false)
+
+		d.trackerMutex.Lock()
+		if secretInfo, exists := d.secretTracker[name]; exists {
+			secretInfo.CurrentSecretName = version.Spec.Name
+			secretInfo.ValueHash = hash
+			secretInfo.ServiceNames = servicesUsing(services, version.Spec.Name, secretInfo.Stack)
+			d.setTrackedInfo(secretInfo)
+		}
+		d.trackerMutex.Unlock()
+		seeded++
+	}
+	if seeded > 0 {
+		log.Printf("Seeded %d tracked secrets from Docker", seeded)
+	}
+	return nil
+}
+
+// servicesUsing returns the names of the services referencing a secret,
+// limited to a stack unless it is empty
+func servicesUsing(services []swarm.Service, secretName, stack string) []string {
+	var names []string
+	for _, service := range services {
+		if service.Spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		if stack != "" && service.Spec.Labels[stackNamespaceLabel] != stack {
+			continue
+		}
+		for _, secretRef := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+			if secretRef.SecretName == secretName {
+				names = append(names, service.Spec.Name)
+				break
+			}
+		}
+	}
+	return names
+}
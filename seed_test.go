@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestRotationLabelsTrackedVersions(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", map[string]string{"vault_field": "password"})
+	fd.addService("svc-1", "web", "db")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         newFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	driver.trackerMutex.RLock()
+	current := driver.secretTracker["db"].CurrentSecretName
+	driver.trackerMutex.RUnlock()
+	version := fd.secretByName(current)
+	if version == nil {
+		t.Fatalf("Expected rotated version %s, got calls %v", current, fd.recordedCalls())
+	}
+	labels := version.Spec.Labels
+	if labels[secretPathLabel] != "secret/data/db" {
+		t.Errorf("Expected path label secret/data/db, got %q", labels[secretPathLabel])
+	}
+	if expected := hashValue("", []byte("v2")); labels[secretValueHashLabel] != expected {
+		t.Errorf("Expected value hash %s, got %q", expected, labels[secretValueHashLabel])
+	}
+	if labels["vault_field"] != "password" {
+		t.Errorf("Expected the driver labels to be kept, got %v", labels)
+	}
+}
+
+func TestMonitorSeedsAndSweepsOnStart(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", map[string]string{"vault_field": "password"})
+	// Left behind by a rotation before the plugin restarted
+	fd.addSecret("db-v2-id", "db-1714564800", map[string]string{
+		"vault_field":        "password",
+		secretAliasLabel:     "db",
+		secretPathLabel:      "secret/data/db",
+		secretValueHashLabel: hashValue("", []byte("v2")),
+	})
+	fd.addService("svc-1", "web", "db-1714564800")
+	// Changed while the plugin was down
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v3"})
+
+	start := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	monitorCtx, monitorCancel := context.WithCancel(context.Background())
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true, RotationInterval: time.Hour, SweepOnStart: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		monitorCtx:    monitorCtx,
+		monitorCancel: monitorCancel,
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		driver.startMonitoring()
+		close(done)
+	}()
+	// Seeding and the initial sweep finish before the ticker is created
+	<-clock.created
+	monitorCancel()
+	<-done
+
+	expected := fmt.Sprintf("db-%d", start.Unix())
+	if fd.secretByName(expected) == nil {
+		t.Fatalf("Expected rotation to %s before the first tick, got calls %v", expected, fd.recordedCalls())
+	}
+	if names := fd.serviceSecretNames("svc-1"); len(names) != 1 || names[0] != expected {
+		t.Errorf("Expected web to reference %s, got %v", expected, names)
+	}
+}
+
+func TestSeedTrackerSkipsUnlabelledSecrets(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", map[string]string{"vault_field": "password"})
+	// An alias copy has no path or value hash
+	fd.addSecret("alias-id", "db-alias-1714564800", map[string]string{secretAliasLabel: "db-alias"})
+
+	driver := &VaultDriver{
+		config:        &VaultConfig{MountPath: "secret"},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	if err := driver.seedTracker(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(driver.secretTracker) != 0 {
+		t.Errorf("Expected nothing seeded, got %v", driver.secretTracker)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// selfTestLabel marks the sentinel secrets created by SelfTest so leftovers
+// of an interrupted run can be recognized
+const selfTestLabel = "vault.selftest"
+
+// selfTestImage is the image of the dummy service SelfTest rotates the
+// sentinel for. The service is scaled to zero, so the image is never pulled.
+const selfTestImage = "busybox:latest"
+
+// SelfTestStage is the outcome of one stage of SelfTest
+type SelfTestStage struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// SelfTest runs the Docker side of a rotation against a throwaway sentinel
+// secret: it creates the secret and a dummy service scaled to zero that
+// references it, finds the secret again, rotates it with the same code as a
+// real rotation, which needs permission to update the service, and removes the
+// service and every sentinel version. It reports each stage; stages after the
+// first failure are skipped, but cleanup always runs.
+func (d *VaultDriver) SelfTest() []SelfTestStage {
+	d.rotationMutex.Lock()
+	defer d.rotationMutex.Unlock()
+
+	var stages []SelfTestStage
+	failed := false
+	stage := func(name string, run func() error) {
+		if failed {
+			stages = append(stages, SelfTestStage{Name: name, Error: "skipped"})
+			return
+		}
+		if err := run(); err != nil {
+			failed = true
+			stages = append(stages, SelfTestStage{Name: name, Error: err.Error()})
+			return
+		}
+		stages = append(stages, SelfTestStage{Name: name, OK: true})
+	}
+
+	if d.dockerClient == nil {
+		stages = append(stages, SelfTestStage{Name: "create", Error: "docker client not initialized"})
+		d.metrics.inc(`vault_selftests_total{result="failure"}`)
+		return stages
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sentinel := fmt.Sprintf("vault-selftest-%d", d.now().UnixNano())
+	labels := map[string]string{selfTestLabel: sentinel}
+	var sentinelID, serviceID string
+
+	stage("create", func() error {
+		resp, err := d.dockerClient.SecretCreate(ctx, swarm.SecretSpec{
+			Annotations: swarm.Annotations{Name: sentinel, Labels: labels},
+			Data:        []byte("selftest-1"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create sentinel secret: %v", err)
+		}
+		sentinelID = resp.ID
+		return nil
+	})
+
+	stage("service", func() error {
+		replicas := uint64(0)
+		resp, err := d.dockerClient.ServiceCreate(ctx, swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: sentinel, Labels: labels},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Image:   selfTestImage,
+					Secrets: []*swarm.SecretReference{{SecretName: sentinel, SecretID: sentinelID}},
+				},
+			},
+			Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		}, types.ServiceCreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create sentinel service: %v", err)
+		}
+		serviceID = resp.ID
+		return nil
+	})
+
+	stage("lookup", func() error {
+		secrets, err := d.listSecrets(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list secrets: %v", err)
+		}
+		if findCurrentSecret(secrets, sentinel, sentinel) == nil {
+			return fmt.Errorf("sentinel secret %s not found", sentinel)
+		}
+		return nil
+	})
+
+	stage("rotate", func() error {
+		_, _, updated, err := d.updateDockerSecret(sentinel, sentinel, "", []byte("selftest-2"))
+		if err != nil {
+			return err
+		}
+		if len(updated) != 1 || updated[0] != sentinel {
+			return fmt.Errorf("sentinel rotation updated services %v instead of %s", updated, sentinel)
+		}
+		return nil
+	})
+
+	// Cleanup runs even after a failure, removing the service first so the
+	// sentinel versions it references can be removed
+	failedBefore := failed
+	failed = false
+	stage("cleanup", func() error {
+		if serviceID != "" {
+			if err := d.dockerClient.ServiceRemove(ctx, serviceID); err != nil {
+				return fmt.Errorf("failed to remove sentinel service: %v", err)
+			}
+		}
+		secrets, err := d.listSecrets(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list secrets: %v", err)
+		}
+		for _, secret := range secrets {
+			if secret.Spec.Labels[selfTestLabel] != sentinel {
+				continue
+			}
+			if err := d.dockerClient.SecretRemove(ctx, secret.ID); err != nil {
+				return fmt.Errorf("failed to remove sentinel secret %s: %v", secret.Spec.Name, err)
+			}
+		}
+		return nil
+	})
+	failed = failed || failedBefore
+
+	if failed {
+		d.metrics.inc(`vault_selftests_total{result="failure"}`)
+		log.Warnf("Self-test failed: %+v", stages)
+	} else {
+		d.metrics.inc(`vault_selftests_total{result="success"}`)
+		log.Printf("Self-test passed")
+	}
+	return stages
+}
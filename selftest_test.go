@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+	driver := &VaultDriver{
+		config:        &VaultConfig{},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+
+	stages := driver.SelfTest()
+	want := []string{"create", "service", "lookup", "rotate", "cleanup"}
+	if len(stages) != len(want) {
+		t.Fatalf("Expected stages %v, got %+v", want, stages)
+	}
+	for i, stage := range stages {
+		if stage.Name != want[i] || !stage.OK {
+			t.Errorf("Expected stage %s to succeed, got %+v", want[i], stage)
+		}
+	}
+	// The dummy service was rewired by the rotation, then everything the
+	// self-test created was removed and the existing service is untouched
+	if !fd.called("POST /services/create") || !fd.called("POST /services/new-service-2/update") || !fd.called("DELETE /services/new-service-2") {
+		t.Errorf("Expected the sentinel service to be created, rotated and removed, got %v", fd.recordedCalls())
+	}
+	if len(fd.secrets) != 1 || fd.secrets[0].ID != "db-id" {
+		t.Errorf("Expected sentinel secrets to be cleaned up, got %+v", fd.secrets)
+	}
+	if len(fd.services) != 1 || fd.services[0].ID != "svc-1" {
+		t.Errorf("Expected the sentinel service to be cleaned up, got %+v", fd.services)
+	}
+	if names := fd.serviceSecretNames("svc-1"); len(names) != 1 || names[0] != "db" {
+		t.Errorf("Expected the service to keep referencing db, got %v", names)
+	}
+	if got := driver.metrics.counter(`vault_selftests_total{result="success"}`); got != 1 {
+		t.Errorf("Expected one successful self-test, got %v", got)
+	}
+}
+
+func TestSelfTestReportsFailedStage(t *testing.T) {
+	fd := newFakeDocker(t)
+	driver := &VaultDriver{
+		config:        &VaultConfig{},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	fd.server.Close()
+
+	stages := driver.SelfTest()
+	if len(stages) != 5 {
+		t.Fatalf("Expected five stages, got %+v", stages)
+	}
+	if stages[0].OK || stages[0].Error == "" {
+		t.Errorf("Expected create to fail, got %+v", stages[0])
+	}
+	for _, stage := range stages[1:4] {
+		if stage.OK || stage.Error != "skipped" {
+			t.Errorf("Expected %s to be skipped, got %+v", stage.Name, stage)
+		}
+	}
+	// Cleanup is always attempted
+	if stages[4].Name != "cleanup" || stages[4].Error == "skipped" {
+		t.Errorf("Expected cleanup to run, got %+v", stages[4])
+	}
+	if got := driver.metrics.counter(`vault_selftests_total{result="failure"}`); got != 1 {
+		t.Errorf("Expected one failed self-test, got %v", got)
+	}
+}
+
+func TestSelfTestReportsMissingUpdatePermission(t *testing.T) {
+	fd := newFakeDocker(t)
+	driver := &VaultDriver{
+		config:        &VaultConfig{},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	// The sentinel service is the second object the fake creates
+	fd.failUpdates("new-service-2")
+
+	stages := driver.SelfTest()
+	if len(stages) != 5 || stages[3].Name != "rotate" || stages[3].OK || stages[3].Error == "" {
+		t.Fatalf("Expected the rotate stage to fail, got %+v", stages)
+	}
+	if !stages[4].OK {
+		t.Errorf("Expected cleanup to succeed, got %+v", stages[4])
+	}
+	if len(fd.secrets) != 0 || len(fd.services) != 0 {
+		t.Errorf("Expected everything to be cleaned up, got %+v and %+v", fd.secrets, fd.services)
+	}
+}
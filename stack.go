@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// stackNamespaceLabel is set by docker stack deploy on the secrets and
+// services of a stack
+const stackNamespaceLabel = "com.docker.stack.namespace"
+
+// inStack returns the secrets deployed in stack, or all secrets when stack is
+// empty. Rotated versions copy the labels of the secret they replace, so they
+// stay in the stack of the original.
+func inStack(secrets []swarm.Secret, stack string) []swarm.Secret {
+	if stack == "" {
+		return secrets
+	}
+	var matching []swarm.Secret
+	for _, secret := range secrets {
+		if secret.Spec.Labels[stackNamespaceLabel] == stack {
+			matching = append(matching, secret)
+		}
+	}
+	return matching
+}
+
+// secretStack returns the stack a tracked secret was deployed in, empty when
+// it isn't tracked or not part of a stack
+func (d *VaultDriver) secretStack(secretName string) string {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	if secretInfo, exists := d.secretTracker[secretName]; exists {
+		return secretInfo.Stack
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestRotationStaysInStack(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("a-id", "db-200", map[string]string{secretAliasLabel: "db", stackNamespaceLabel: "a"})
+	fd.addSecret("b-id", "db-300", map[string]string{secretAliasLabel: "db", stackNamespaceLabel: "b"})
+	// The other stack's version is newer, so a global scan would pick it
+	fd.secrets[0].CreatedAt = time.Now().Add(-time.Hour)
+	fd.addService("svc-a", "a_web", "db-200")
+	fd.addService("svc-b", "b_web", "db-300")
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	labels := map[string]string{"vault_path": "db", "vault_field": "password", stackNamespaceLabel: "a"}
+	if resp := driver.Get(secrets.Request{SecretName: "db", ServiceName: "a_web", SecretLabels: labels}); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	// The tracked current version is gone, e.g. after a restart
+	driver.secretTracker["db"].CurrentSecretName = "db-100"
+
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	driver.checkForSecretChanges()
+
+	rotated := driver.secretTracker["db"].CurrentSecretName
+	created := fd.secretByName(rotated)
+	if created == nil || created.Spec.Labels[stackNamespaceLabel] != "a" {
+		t.Fatalf("Expected a new version in stack a, got %s (%+v)", rotated, created)
+	}
+	if names := fd.serviceSecretNames("svc-a"); !reflect.DeepEqual(names, []string{rotated}) {
+		t.Errorf("Expected the stack a service to use %s, got %v", rotated, names)
+	}
+	if fd.secretByName("db-200") != nil {
+		t.Error("Expected the replaced stack a version to be removed")
+	}
+	if fd.secretByName("db-300") == nil {
+		t.Error("Expected the stack b version to be left alone")
+	}
+	if names := fd.serviceSecretNames("svc-b"); !reflect.DeepEqual(names, []string{"db-300"}) {
+		t.Errorf("Expected the stack b service to be untouched, got %v", names)
+	}
+}
+
+func TestDanglingReferencesStayInStack(t *testing.T) {
+	secretList := []swarm.Secret{
+		{ID: "a-id", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db-200", Labels: map[string]string{secretAliasLabel: "db", stackNamespaceLabel: "a"}}}},
+	}
+	service := func(id, stack string) swarm.Service {
+		svc := swarm.Service{ID: id}
+		svc.Spec.Labels = map[string]string{stackNamespaceLabel: stack}
+		svc.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{
+			Secrets: []*swarm.SecretReference{{SecretName: "db", SecretID: "removed"}},
+		}
+		return svc
+	}
+	tracked := []*SecretInfo{{DockerSecretName: "db", CurrentSecretName: "db-200", Stack: "a"}}
+
+	dangling := findDanglingReferences([]swarm.Service{service("svc-a", "a"), service("svc-b", "b")}, secretList, tracked, "", "")
+	if len(dangling) != 1 || dangling[0].ServiceID != "svc-a" || dangling[0].Target.ID != "a-id" {
+		t.Errorf("Expected only the stack a service to be repaired, got %+v", dangling)
+	}
+}
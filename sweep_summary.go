@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sweepSummary aggregates the outcome of one change-detection sweep
+type sweepSummary struct {
+	Checked  int // secrets due and checked in this sweep
+	Changed  int // secrets whose value changed, including held manual rotations
+	Held     int // changes held for manual approval
+	Deferred int // changes deferred until the next rotation window
+	Rotated  int
+	Failed   int // rotations that failed
+	// secrets with aliases whose sync failed, rotated or not
+	AliasesFailed int
+	Duration      time.Duration
+}
+
+// String formats the summary as a single log line
+func (s sweepSummary) String() string {
+	return fmt.Sprintf("checked=%d changed=%d held=%d deferred=%d rotated=%d failed=%d aliases_failed=%d duration=%v",
+		s.Checked, s.Changed, s.Held, s.Deferred, s.Rotated, s.Failed, s.AliasesFailed, s.Duration)
+}
+
+// recordSweep logs a sweep summary and exposes it as metrics
+func (d *VaultDriver) recordSweep(s sweepSummary) {
+	d.metrics.inc("vault_sweeps_total")
+	for state, count := range map[string]int{"checked": s.Checked, "changed": s.Changed, "held": s.Held, "deferred": s.Deferred, "rotated": s.Rotated, "failed": s.Failed, "aliases_failed": s.AliasesFailed} {
+		d.metrics.setGauge(fmt.Sprintf(`vault_last_sweep_secrets{state=%q}`, state), float64(count))
+	}
+	d.metrics.setGauge("vault_last_sweep_duration_seconds", s.Duration.Seconds())
+	if s.Checked > 0 {
+		log.Printf("Sweep finished: %s", s)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestSweepSummary(t *testing.T) {
+	fv := newFakeVault(t)
+	fd := newFakeDocker(t)
+	for _, name := range []string{"same", "rotates", "fails", "manual"} {
+		fv.setKV2("secret/data/"+name, map[string]interface{}{"password": "v1"})
+	}
+	fd.addSecret("rotates-id", "rotates", nil)
+	fd.addService("svc-1", "web", "rotates")
+	// "fails" has no Docker secret, so its rotation can't find a version to replace
+
+	driver := &VaultDriver{
+		client:        fv.client(t),
+		config:        &VaultConfig{MountPath: "secret", EnableRotation: true},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+	}
+	for _, name := range []string{"same", "rotates", "fails", "manual"} {
+		labels := map[string]string{"vault_field": "password"}
+		if name == "manual" {
+			labels["vault_rotation_mode"] = rotationModeManual
+		}
+		if resp := driver.Get(secrets.Request{SecretName: name, SecretLabels: labels}); resp.Err != "" {
+			t.Fatalf("Unexpected error for %s: %s", name, resp.Err)
+		}
+	}
+	for _, name := range []string{"rotates", "fails", "manual"} {
+		fv.setKV2("secret/data/"+name, map[string]interface{}{"password": "v2"})
+	}
+
+	summary := driver.checkForSecretChanges()
+	expected := sweepSummary{Checked: 4, Changed: 3, Held: 1, Rotated: 1, Failed: 1, Duration: summary.Duration}
+	if summary != expected {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+	for state, count := range map[string]float64{"checked": 4, "changed": 3, "held": 1, "rotated": 1, "failed": 1} {
+		series := `vault_last_sweep_secrets{state="` + state + `"}`
+		if got := driver.metrics.gauge(series); got != count {
+			t.Errorf("Expected %s to be %v, got %v", series, count, got)
+		}
+	}
+	if count := driver.metrics.counter("vault_sweeps_total"); count != 1 {
+		t.Errorf("Expected 1 sweep, got %v", count)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// normalizeFingerprint lowercases a hex SHA-256 fingerprint and strips ':' separators
+func normalizeFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	decoded, err := hex.DecodeString(normalized)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	return normalized, nil
+}
+
+// verifyPinnedCertificate returns a VerifyConnection callback that rejects
+// servers whose leaf certificate doesn't match the pinned fingerprint
+func verifyPinnedCertificate(pin string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("vault server presented no certificate")
+		}
+		sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+		if actual := hex.EncodeToString(sum[:]); actual != pin {
+			return fmt.Errorf("vault server certificate fingerprint %s does not match pinned fingerprint", actual)
+		}
+		return nil
+	}
+}
+
+// configureTLSPin installs certificate pinning on the Vault client transport
+func configureTLSPin(vaultConfig *api.Config, fingerprint string) error {
+	pin, err := normalizeFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	transport, ok := vaultConfig.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unsupported vault client transport %T", vaultConfig.HttpClient.Transport)
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.VerifyConnection = verifyPinnedCertificate(pin)
+	return nil
+}
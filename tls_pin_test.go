@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func newPinnedClient(t *testing.T, server *httptest.Server, pin string) *api.Client {
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+	if err := config.ConfigureTLS(&api.TLSConfig{Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := configureTLSPin(config, pin); err != nil {
+		t.Fatalf("Failed to configure pin: %v", err)
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("test-token")
+	return client
+}
+
+func TestTLSPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"value":"ok"}}`))
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Matching fingerprint, in upper case colon-separated form
+	var parts []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, fingerprint[i:i+2])
+	}
+	client := newPinnedClient(t, server, strings.Join(parts, ":"))
+	if _, err := client.Logical().Read("secret/app"); err != nil {
+		t.Errorf("Expected read to succeed with matching pin, got %v", err)
+	}
+
+	// Mismatching fingerprint
+	client = newPinnedClient(t, server, strings.Repeat("ab", sha256.Size))
+	_, err := client.Logical().Read("secret/app")
+	if err == nil || !strings.Contains(err.Error(), "does not match pinned fingerprint") {
+		t.Errorf("Expected pin mismatch error, got %v", err)
+	}
+}
+
+func TestNormalizeFingerprintRejectsInvalid(t *testing.T) {
+	for _, fingerprint := range []string{"", "zz", "abcd"} {
+		if _, err := normalizeFingerprint(fingerprint); err == nil {
+			t.Errorf("Expected error for fingerprint %q", fingerprint)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// evictTrackedSecrets makes room for one more tracked secret when
+// MaxTrackedSecrets is set. Low-priority secrets go first, and within a
+// priority the least recently updated. Evicted secrets are no longer rotated
+// until they are requested again, which leaves services still using them on
+// a stale value, so those evictions are counted separately. The caller must
+// hold trackerMutex.
+func (d *VaultDriver) evictTrackedSecrets() {
+	limit := d.config.MaxTrackedSecrets
+	if limit <= 0 {
+		return
+	}
+	for len(d.secretTracker) >= limit {
+		var victim *SecretInfo
+		for _, secretInfo := range d.secretTracker {
+			if victim == nil || evictBefore(secretInfo, victim) {
+				victim = secretInfo
+			}
+		}
+		delete(d.secretTracker, victim.DockerSecretName)
+		d.clearTrackedInfo(victim)
+		d.metrics.inc("vault_tracked_secrets_evicted_total")
+		if len(victim.ServiceNames) > 0 {
+			d.metrics.inc("vault_tracked_secrets_evicted_referenced_total")
+		}
+		log.Warnf("Tracking limit of %d secrets reached, no longer rotating secret %s (priority %d, last updated %s, services %v)",
+			limit, victim.DockerSecretName, victim.Priority, victim.LastUpdated.Format("2006-01-02T15:04:05Z07:00"), victim.ServiceNames)
+	}
+}
+
+// evictBefore reports whether a should be evicted before b: lower priority
+// first, then least recently updated
+func evictBefore(a, b *SecretInfo) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.LastUpdated.Before(b.LastUpdated)
+}
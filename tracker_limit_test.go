@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestTrackedSecretsEviction(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		config:        &VaultConfig{MaxTrackedSecrets: 2},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	track := func(name string) {
+		driver.trackSecret(secrets.Request{SecretName: name, ServiceName: "web"}, "secret/data/"+name, []byte(name), false)
+		clock.Advance(time.Minute)
+	}
+
+	track("a")
+	track("b")
+	track("a") // refreshes a, leaving b least recently updated
+	if len(driver.secretTracker) != 2 {
+		t.Fatalf("Expected 2 tracked secrets below the limit, got %d", len(driver.secretTracker))
+	}
+
+	track("c")
+	if _, exists := driver.secretTracker["b"]; exists {
+		t.Error("Expected the least recently updated secret b to be evicted")
+	}
+	for _, name := range []string{"a", "c"} {
+		if _, exists := driver.secretTracker[name]; !exists {
+			t.Errorf("Expected %s to stay tracked", name)
+		}
+	}
+	if count := driver.metrics.counter("vault_tracked_secrets_evicted_total"); count != 1 {
+		t.Errorf("Expected 1 eviction, got %v", count)
+	}
+	if count := driver.metrics.counter("vault_tracked_secrets_evicted_referenced_total"); count != 1 {
+		t.Errorf("Expected 1 eviction of a secret still used by a service, got %v", count)
+	}
+
+	// Without a limit nothing is evicted
+	driver.config.MaxTrackedSecrets = 0
+	track("d")
+	if len(driver.secretTracker) != 3 {
+		t.Errorf("Expected 3 tracked secrets without a limit, got %d", len(driver.secretTracker))
+	}
+}
+
+func TestTrackedSecretsEvictionPrefersLowPriority(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		config:        &VaultConfig{MaxTrackedSecrets: 2},
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	track := func(name, priority string) {
+		req := secrets.Request{SecretName: name, ServiceName: "web", SecretLabels: map[string]string{"vault_priority": priority}}
+		driver.trackSecret(req, "secret/data/"+name, []byte(name), false)
+		clock.Advance(time.Minute)
+	}
+
+	track("critical", "high")
+	track("cache", "low")
+	track("db", "normal")
+	if _, exists := driver.secretTracker["cache"]; exists {
+		t.Error("Expected the low-priority secret to be evicted although it was updated more recently")
+	}
+	if _, exists := driver.secretTracker["critical"]; !exists {
+		t.Error("Expected the high-priority secret to stay tracked")
+	}
+
+	// Among equal priorities the least recently updated goes
+	track("queue", "normal")
+	if _, exists := driver.secretTracker["critical"]; !exists {
+		t.Error("Expected the high-priority secret to stay tracked")
+	}
+	if _, exists := driver.secretTracker["db"]; exists {
+		t.Error("Expected the older normal-priority secret to be evicted")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// updateLimiter spreads service updates so that at most perMinute start in
+// any one-minute window. Callers reserve a slot and wait until it starts, so
+// excess updates queue in the order they were requested.
+type updateLimiter struct {
+	mutex     sync.Mutex
+	perMinute int
+	slots     []time.Time // start times of the reserved slots in the last minute
+}
+
+func newUpdateLimiter(perMinute int) *updateLimiter {
+	return &updateLimiter{perMinute: perMinute}
+}
+
+// reserve books the next free slot at or after now and returns how long the
+// caller has to wait for it. A slot more than maxWait away isn't booked and
+// reserve reports false.
+func (l *updateLimiter) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	start := now
+	if len(l.slots) >= l.perMinute {
+		if next := l.slots[len(l.slots)-l.perMinute].Add(time.Minute); next.After(start) {
+			start = next
+		}
+	}
+	if start.Sub(now) > maxWait {
+		return start.Sub(now), false
+	}
+	// Forget slots that can no longer limit a later reservation. Measured
+	// from now rather than start, so released slots don't take earlier ones
+	// with them.
+	for len(l.slots) > 0 && !l.slots[0].Add(time.Minute).After(now) {
+		l.slots = l.slots[1:]
+	}
+	l.slots = append(l.slots, start)
+	return start.Sub(now), true
+}
+
+// release gives back a slot booked by reserve that won't be used, so the
+// updates queued behind it don't wait for it
+func (l *updateLimiter) release(start time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, slot := range l.slots {
+		if slot.Equal(start) {
+			l.slots = append(l.slots[:i], l.slots[i+1:]...)
+			return
+		}
+	}
+}
+
+// updateService updates a service, first waiting for a slot when
+// VAULT_SERVICE_UPDATES_PER_MINUTE is set. An update whose slot starts after
+// ctx expires isn't queued but deferred: it fails right away and the next
+// sweep retries it, instead of holding a slot it can't use.
+func (d *VaultDriver) updateService(ctx context.Context, service swarm.Service, spec swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	if d.updateLimiter != nil {
+		maxWait := time.Duration(math.MaxInt64)
+		if deadline, ok := ctx.Deadline(); ok {
+			maxWait = time.Until(deadline)
+		}
+		now := d.now()
+		wait, ok := d.updateLimiter.reserve(now, maxWait)
+		if !ok {
+			d.metrics.inc("vault_service_updates_deferred_total")
+			return swarm.ServiceUpdateResponse{}, fmt.Errorf("no service update slot for %v, deferring update of %s to the next sweep", wait, service.Spec.Name)
+		}
+		if wait > 0 {
+			log.Printf("Service update limit reached, delaying update of %s by %v", service.Spec.Name, wait)
+			d.metrics.inc("vault_service_updates_throttled_total")
+			d.metrics.addGauge("vault_service_updates_queued", 1)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				d.metrics.addGauge("vault_service_updates_queued", -1)
+				d.updateLimiter.release(now.Add(wait))
+				return swarm.ServiceUpdateResponse{}, fmt.Errorf("gave up waiting for a service update slot: %v", ctx.Err())
+			case <-timer.C:
+			}
+			d.metrics.addGauge("vault_service_updates_queued", -1)
+		}
+	}
+	return d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, spec, options)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func TestUpdateLimiterReserve(t *testing.T) {
+	limiter := newUpdateLimiter(2)
+	start := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	reserve := func(now time.Time) time.Duration {
+		wait, ok := limiter.reserve(now, time.Hour)
+		if !ok {
+			t.Fatalf("Expected a slot within an hour of %v", now)
+		}
+		return wait
+	}
+	waits := []time.Duration{
+		reserve(start),
+		reserve(start.Add(10 * time.Second)),
+		reserve(start.Add(20 * time.Second)), // third in the minute
+		reserve(start.Add(20 * time.Second)), // queued behind it
+	}
+	expected := []time.Duration{0, 0, 40 * time.Second, 50 * time.Second}
+	for i := range expected {
+		if waits[i] != expected[i] {
+			t.Errorf("Expected update %d to wait %v, got %v", i+1, expected[i], waits[i])
+		}
+	}
+	// Once the window has passed, updates start immediately again
+	if wait := reserve(start.Add(5 * time.Minute)); wait != 0 {
+		t.Errorf("Expected no wait after the window, got %v", wait)
+	}
+}
+
+func TestUpdateLimiterDefersAndReleases(t *testing.T) {
+	limiter := newUpdateLimiter(1)
+	start := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	limiter.reserve(start, 0)
+
+	// A slot further away than the caller can wait isn't booked
+	if wait, ok := limiter.reserve(start, 30*time.Second); ok || wait != time.Minute {
+		t.Errorf("Expected the slot a minute away to be refused, got %v %v", wait, ok)
+	}
+	wait, ok := limiter.reserve(start, 2*time.Minute)
+	if !ok || wait != time.Minute {
+		t.Fatalf("Expected the next slot a minute away, got %v %v", wait, ok)
+	}
+	// A released slot is handed to the next update instead of queueing it
+	// behind
+	limiter.release(start.Add(wait))
+	if wait, ok := limiter.reserve(start, 2*time.Minute); !ok || wait != time.Minute {
+		t.Errorf("Expected the released slot to be reused, got %v %v", wait, ok)
+	}
+}
+
+func TestUpdateServiceThrottled(t *testing.T) {
+	docker := &mockDocker{services: []swarm.Service{
+		{ID: "svc-1", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web"}}},
+		{ID: "svc-2", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "api"}}},
+	}}
+	driver := &VaultDriver{
+		config:        &VaultConfig{},
+		dockerClient:  docker,
+		metrics:       newDriverMetrics(),
+		updateLimiter: newUpdateLimiter(1),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := driver.updateService(ctx, docker.services[0], docker.services[0].Spec, types.ServiceUpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The second update has to wait about a minute for a slot, longer than ctx allows
+	_, err := driver.updateService(ctx, docker.services[1], docker.services[1].Spec, types.ServiceUpdateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "deferring update of api") {
+		t.Fatalf("Expected the update to be deferred to the next sweep, got %v", err)
+	}
+	if len(docker.calls) != 1 || docker.calls[0] != "ServiceUpdate svc-1" {
+		t.Errorf("Expected only the first update to reach Docker, got %v", docker.calls)
+	}
+	if count := driver.metrics.counter("vault_service_updates_deferred_total"); count != 1 {
+		t.Errorf("Expected 1 deferred update, got %v", count)
+	}
+	if queued := driver.metrics.gauge("vault_service_updates_queued"); queued != 0 {
+		t.Errorf("Expected an empty queue, got %v", queued)
+	}
+}
+
+func TestUpdateServiceReleasesSlotWhenCancelled(t *testing.T) {
+	docker := &mockDocker{services: []swarm.Service{
+		{ID: "svc-1", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web"}}},
+		{ID: "svc-2", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "api"}}},
+	}}
+	driver := &VaultDriver{
+		config:        &VaultConfig{},
+		dockerClient:  docker,
+		metrics:       newDriverMetrics(),
+		updateLimiter: newUpdateLimiter(1),
+	}
+	if _, err := driver.updateService(context.Background(), docker.services[0], docker.services[0].Spec, types.ServiceUpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The second update queues for the next slot and is cancelled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := driver.updateService(ctx, docker.services[1], docker.services[1].Spec, types.ServiceUpdateOptions{}); err == nil || !strings.Contains(err.Error(), "gave up waiting") {
+		t.Fatalf("Expected the queued update to give up, got %v", err)
+	}
+	if count := driver.metrics.counter("vault_service_updates_throttled_total"); count != 1 {
+		t.Errorf("Expected 1 throttled update, got %v", count)
+	}
+	if queued := driver.metrics.gauge("vault_service_updates_queued"); queued != 0 {
+		t.Errorf("Expected an empty queue, got %v", queued)
+	}
+	// Its slot was released, so the next update waits for the same slot
+	// rather than the one after it
+	if wait, ok := driver.updateLimiter.reserve(time.Now(), time.Hour); !ok || wait > time.Minute {
+		t.Errorf("Expected the released slot within a minute, got %v %v", wait, ok)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Orders for VAULT_SERVICE_UPDATE_ORDER, in which a rotation updates services
+const (
+	updateOrderAlphabetical = "alphabetical" // by service name
+	updateOrderPriority     = "priority"     // by the vault_update_priority service label, then name
+)
+
+// updatePriorityLabel is the service label ordering updates with
+// VAULT_SERVICE_UPDATE_ORDER=priority. Lower values are updated first.
+const updatePriorityLabel = "vault_update_priority"
+
+// parseUpdateOrder validates a VAULT_SERVICE_UPDATE_ORDER value, defaulting
+// to alphabetical
+func parseUpdateOrder(value string) string {
+	order := strings.ToLower(strings.TrimSpace(value))
+	switch order {
+	case updateOrderAlphabetical, updateOrderPriority:
+		return order
+	}
+	log.Warnf("Invalid service update order %q, using %s", value, updateOrderAlphabetical)
+	return updateOrderAlphabetical
+}
+
+// servicePriority returns the vault_update_priority of a service and whether
+// it is set to a valid integer
+func servicePriority(service swarm.Service) (int, bool) {
+	value, exists := service.Spec.Labels[updatePriorityLabel]
+	if !exists {
+		return 0, false
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		log.Warnf("Invalid %s %q on service %s, updating it last", updatePriorityLabel, value, service.Spec.Name)
+		return 0, false
+	}
+	return priority, true
+}
+
+// sortServicesForUpdate orders services deterministically for a rotation.
+// With the priority order, services without a valid priority come last, and
+// ties are broken by name. Without an order, the listing order is kept.
+func sortServicesForUpdate(services []swarm.Service, order string) {
+	if order == updateOrderAlphabetical {
+		sort.SliceStable(services, func(i, j int) bool {
+			return services[i].Spec.Name < services[j].Spec.Name
+		})
+		return
+	}
+	if order != updateOrderPriority {
+		return
+	}
+	priorities := make(map[string]int, len(services))
+	prioritized := make(map[string]bool, len(services))
+	for _, service := range services {
+		priorities[service.ID], prioritized[service.ID] = servicePriority(service)
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if prioritized[a.ID] != prioritized[b.ID] {
+			return prioritized[a.ID]
+		}
+		if priorities[a.ID] != priorities[b.ID] {
+			return priorities[a.ID] < priorities[b.ID]
+		}
+		return a.Spec.Name < b.Spec.Name
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serviceUpdateOrder returns the IDs of the services updated so far, in order
+func serviceUpdateOrder(fd *fakeDocker) []string {
+	var ids []string
+	for _, call := range fd.recordedCalls() {
+		if strings.HasPrefix(call, "POST /services/") && strings.HasSuffix(call, "/update") {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(call, "POST /services/"), "/update"))
+		}
+	}
+	return ids
+}
+
+func TestServiceUpdateOrder(t *testing.T) {
+	cases := []struct {
+		order    string
+		expected []string
+	}{
+		{updateOrderAlphabetical, []string{"svc-api", "svc-db", "svc-web", "svc-worker"}},
+		// Lower priorities first, services without a valid priority last
+		{updateOrderPriority, []string{"svc-db", "svc-web", "svc-api", "svc-worker"}},
+	}
+	for _, c := range cases {
+		fd := newFakeDocker(t)
+		fd.addSecret("db-id", "db", nil)
+		fd.addService("svc-web", "web", "db")
+		fd.addService("svc-worker", "worker", "db")
+		fd.addService("svc-db", "db-migrate", "db")
+		fd.addService("svc-api", "api", "db")
+		priorities := map[string]string{"svc-web": "10", "svc-db": "1", "svc-worker": "soon"}
+		for i := range fd.services {
+			if priority, ok := priorities[fd.services[i].ID]; ok {
+				fd.services[i].Spec.Labels = map[string]string{updatePriorityLabel: priority}
+			}
+		}
+		driver := &VaultDriver{
+			config:       &VaultConfig{UpdateOrder: c.order},
+			dockerClient: fd.client(t),
+			metrics:      newDriverMetrics(),
+		}
+
+		if _, _, _, err := driver.updateDockerSecret("db", "db", "", []byte("new")); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.order, err)
+		}
+		if order := serviceUpdateOrder(fd); !reflect.DeepEqual(order, c.expected) {
+			t.Errorf("%s: expected services updated in order %v, got %v", c.order, c.expected, order)
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	// "path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 	log "github.com/sirupsen/logrus"
 	"github.com/docker/go-plugins-helpers/secrets"
@@ -17,30 +24,92 @@ import (
 	dockerclient "github.com/docker/docker/client"
 )
 
+// secretAliasLabel marks rotated secret versions with the name of the
+// original Docker secret so later rotations can find the current version
+const secretAliasLabel = "vault.secret.alias"
+
+// contentTypeLabel records the vault_content_type of a secret on the versions
+// and aliases the plugin creates, so consumers can tell file from env values
+const contentTypeLabel = "vault.content_type"
+
 // SecretInfo tracks information about secrets being managed
 type SecretInfo struct {
-	DockerSecretName string
-	VaultPath        string
-	VaultField       string
-	ServiceNames     []string
-	LastHash         string    // Hash of the secret value for change detection
-	LastUpdated      time.Time
+	DockerSecretName  string
+	CurrentSecretName string // Docker secret currently holding the value, versioned after a rotation
+	VaultPath         string
+	VaultField        string // field from vault_field or vault_field_template, empty for the default fields
+	ServiceNames      []string
+	LastHash          string // Hash of the secret value for change detection
+	LastUpdated       time.Time
+	Priority          int               // check priority from the vault_priority label
+	CheckInterval     time.Duration     // minimum time between checks from vault_rotation_interval, 0 for every sweep
+	NextCheck         time.Time         // when CheckInterval next allows a check
+	Aliases           []string          // other Docker secrets kept in sync, from the vault_aliases label
+	AliasSecretNames  map[string]string // alias -> Docker secret currently holding its value
+	FailedAliases     map[string]bool   // aliases whose last sync failed, retried by the next sweep
+	Deleted           bool              // the current Vault version is deleted or destroyed
+	TrailingNewline   string            // vault_trailing_newline mode applied to the value
+	RotationMode      string            // "manual" holds changes for approval, from the vault_rotation_mode label
+	PendingSince      time.Time         // when a held change was detected, zero if none
+	HeldHash          string            // change-detection hash of the held change, approved as is
+	CheckedHash       string            // change-detection hash of the value last read by a sweep
+	DeferredHash      string            // change-detection hash of a change deferred to the next rotation window
+	BacklogSince      time.Time         // when an unrotated change was first detected, zero if none
+	ValueHash         string            // hash of the value held by CurrentSecretName, empty if unknown
+	JSONPath          string            // path selected in stringified JSON, from the vault_json_field label
+	WatchFields       []string          // fields hashed for change detection instead of the value, from vault_watch_fields
+	ContentType       string            // vault_content_type label, recorded on created secrets
+	Format            string            // vault_format label, e.g. "properties" to render every field
+	Stack             string            // stack namespace the secret was deployed in, empty if none
+	JoinFields        []string          // fields joined into the value, from the vault_field_join label
+	JoinSeparator     string
+	PEMBundle         bool // JoinFields are PEM blocks from the vault_pem_bundle label
+
+	RotateCron            string        // cron expression for forced rotations
+	RotateSchedule        *cronSchedule // parsed RotateCron, nil if unset or invalid
+	NextScheduledRotation time.Time
+
+	Rollback *rollbackCandidate // version replaced by the last rotation, nil if none or expired
+
+	infoSeries string // current vault_tracked_secret_info series
 }
 
 // VaultDriver implements the secrets.Driver interface
 type VaultDriver struct {
-	client        *api.Client
-	config        *VaultConfig
-	dockerClient  *dockerclient.Client
-	secretTracker map[string]*SecretInfo // key: docker secret name
-	trackerMutex  sync.RWMutex
-	monitorCtx    context.Context
-	monitorCancel context.CancelFunc
+	client         *api.Client
+	secondary      *api.Client  // optional DR cluster used when the primary is unavailable
+	logical        vaultLogical // reads from the primary, client.Logical() when nil
+	usingSecondary atomic.Bool
+	degraded       atomic.Bool // started without Vault authentication, see VAULT_INIT_FAILURE
+	started        time.Time   // when the driver was created, for the uptime in the admin status
+	config         *VaultConfig
+	dockerClient   dockerAPI
+	secretTracker  map[string]*SecretInfo // key: docker secret name
+	trackerMutex   sync.RWMutex
+	conflicting    map[string]bool // secrets no longer rotated because services select different values
+	rotationMutex  sync.Mutex      // serializes the sweep with rotations, rollbacks and self-tests from the admin API
+	monitorCtx     context.Context
+	monitorCancel  context.CancelFunc
+	getCounter     uint64 // number of Get calls, used for log sampling
+	sweepCount     uint64 // number of change-detection sweeps
+	history        *rotationHistory
+	metrics        *driverMetrics
+	leases         *leaseRegistry
+	clock          Clock          // defaults to real time when nil
+	updateLimiter  *updateLimiter // limits service updates per minute, nil for no limit
+	configSources  map[string]string
+	configValues   map[string]string         // setting values with credentials redacted
+	sweepReads     atomic.Pointer[readCache] // Vault reads of the running sweep, nil between sweeps
+	emptySince     time.Time                 // when the monitor first saw an empty tracker, zero while secrets are tracked
+	emptyWarned    bool                      // whether the current empty period was reported
+	notFound       negativeCache             // paths recently found missing, for VAULT_NEGATIVE_CACHE_TTL
+	adminServer    *http.Server              // admin API, nil unless VAULT_ADMIN_ADDR is set
 }
 
 // VaultConfig holds the configuration for the Vault client
 type VaultConfig struct {
 	Address           string
+	SecondaryAddress  string
 	Token             string
 	MountPath         string
 	RoleID            string
@@ -49,46 +118,98 @@ type VaultConfig struct {
 	CACert            string
 	ClientCert        string
 	ClientKey         string
+	TLSPinSHA256      string          // optional pinned SHA-256 fingerprint of the server certificate
+	TLSPinSecondary   string          // optional pinned fingerprint of the secondary cluster's certificate
+	SecretNamePrefix  string          // prepended to rotated secret version names
+	SecretNameSuffix  string          // appended to rotated secret version names
+	RequireConsumers  bool            // fail rotations that don't update any service
+	KeepOldSecrets    bool            // never remove old secret versions after a rotation
+	RotationPartial   string          // abort, continue or rollback when some service updates fail
+	HashAlgo          string          // change-detection hash: sha256, sha512 or xxhash
+	AllowedLabels     map[string]bool // control labels honored on secrets, nil for all
+	RotateCron        string          // default cron schedule for forced rotations
+	ExcludeFields     map[string]bool // fields never picked by the default extraction search
+	CheckPaths        []string        // paths whose read capability is checked at startup
+	ReconcileDangling bool            // rewire services that reference removed secret versions
+	SweepOnStart      bool            // seed the tracker from Docker and check it as soon as monitoring starts
+	MaxRetryAfter     time.Duration   // longest Retry-After honored on Vault 429/503 responses
+	MemSoftLimit      uint64          // warn when runtime memory exceeds this many bytes, 0 to disable
+	MemShedLoad       bool            // pause change detection while over MemSoftLimit
+	RejectBlank       bool            // treat empty or whitespace-only values as errors
+	PreRotationHook   string          // shell command run before a rotation, failure aborts it
+	PostRotationHook  string          // shell command run after a successful rotation
+	HookTimeout       time.Duration
 	EnableRotation    bool
 	RotationInterval  time.Duration
+	LogSampleRate     int // log 1 in N successful Get requests
+	HistorySize       int // number of rotation records to keep
+	MaxTrackedSecrets int // evict least recently updated secrets past this many, 0 for no limit
+	ListRetries       int // retries of failed Docker secret and service listings
+	ListRetryBackoff  time.Duration
+	LowPriorityEvery  int              // check low-priority secrets every Nth sweep
+	RotationWindows   []rotationWindow // daily ranges in which changes are rotated, nil for any time
+	RotationLocation  *time.Location   // time zone of RotationWindows
+	UpdatesPerMinute  int              // most service updates started per minute across rotations, 0 for no limit
+	RollbackTTL       time.Duration    // how long replaced versions are kept for RollbackRotation, 0 to disable
+	InitFailure       string           // fail or degrade when Vault authentication fails at startup
+	EmptyTrackerWarn  time.Duration    // warn when no secret is tracked for this long, 0 to disable
+	LabelConflict     string           // warn or error when services request a secret with different labels
+	FallbackPolicy    string           // first-string, raw or error when no explicit or default field matches
+	MetricsExport     string           // file rotation metrics snapshots are appended to, empty to disable
+	ExportInterval    time.Duration    // time between metrics snapshots
+	ExportMaxBytes    int64            // size past which the export file is moved to <path>.1, 0 for no limit
+	UpdateOrder       string           // order in which a rotation updates services, alphabetical or priority
+	NegativeCacheTTL  time.Duration    // how long a missing secret is answered without reading Vault, 0 to disable
+	MaxLabels         int              // most labels a secret request may carry, 0 for no limit
+	ReconcileServices bool             // rebuild the service lists of tracked secrets after each sweep
+	GetTimeout        time.Duration    // timeout of Vault reads serving Get requests
+	CheckTimeout      time.Duration    // timeout of Vault reads detecting changes
+	RotateTimeout     time.Duration    // timeout of Vault reads during a rotation
+	AdminAddr         string           // address of the admin API, empty to disable it
+	AdminToken        string           // bearer token required by the admin API
 }
 
 // NewVaultDriver creates a new VaultDriver instance
 func NewVaultDriver() (*VaultDriver, error) {
-	config := &VaultConfig{
-		Address:    getEnvOrDefault("VAULT_ADDR", "http://152.53.244.80:8200"),
-		// Token:      os.Getenv("VAULT_TOKEN"),
-		Token: 	getEnvOrDefault("VAULT_TOKEN", "hvs.tD053xbJ1C5lo2EbtZnn2JU8"), // Use environment variable for token
-		MountPath:  getEnvOrDefault("VAULT_MOUNT_PATH", "secret"),
-		RoleID:     os.Getenv("VAULT_ROLE_ID"),
-		SecretID:   os.Getenv("VAULT_SECRET_ID"),
-		AuthMethod: getEnvOrDefault("VAULT_AUTH_METHOD", "token"),
-		CACert:     os.Getenv("VAULT_CACERT"),
-		ClientCert: os.Getenv("VAULT_CLIENT_CERT"),
-		ClientKey:  os.Getenv("VAULT_CLIENT_KEY"),
-		EnableRotation: getEnvOrDefault("VAULT_ENABLE_ROTATION", "true") == "true",
-		RotationInterval: parseDurationOrDefault(getEnvOrDefault("VAULT_ROTATION_INTERVAL", "10s")),
-	}
-
-	// Configure Vault client
-	vaultConfig := api.DefaultConfig()
-	vaultConfig.Address = config.Address
-
-	// Configure TLS if certificates are provided
-	if config.CACert != "" || config.ClientCert != "" {
-		tlsConfig := &api.TLSConfig{
-			CACert:     config.CACert,
-			ClientCert: config.ClientCert,
-			ClientKey:  config.ClientKey,
+	settings, err := loadPluginSettings()
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadVaultConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+	for _, key := range settings.unknownKeys() {
+		log.Warnf("Ignoring unknown plugin setting: %s", key)
+	}
+	sources := settings.provenance()
+	if log.IsLevelEnabled(log.DebugLevel) {
+		keys := make([]string, 0, len(sources))
+		for key := range sources {
+			keys = append(keys, key)
 		}
-		if err := vaultConfig.ConfigureTLS(tlsConfig); err != nil {
-			return nil, fmt.Errorf("failed to configure TLS: %v", err)
+		sort.Strings(keys)
+		for _, key := range keys {
+			log.Debugf("Plugin setting %s from %s", key, sources[key])
 		}
 	}
+	if config.AllowedLabels == nil {
+		log.Warnf("VAULT_ALLOWED_LABELS is not set, honoring all control labels: %s", strings.Join(controlLabels, ","))
+	}
 
-	client, err := api.NewClient(vaultConfig)
+	client, err := newVaultClient(config, config.Address, config.TLSPinSHA256)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create vault client: %v", err)
+		return nil, err
+	}
+
+	var secondary *api.Client
+	if config.SecondaryAddress != "" {
+		if secondary, err = newVaultClient(config, config.SecondaryAddress, config.TLSPinSecondary); err != nil {
+			return nil, fmt.Errorf("secondary cluster: %v", err)
+		}
 	}
 
 	// Create Docker client
@@ -96,45 +217,123 @@ func NewVaultDriver() (*VaultDriver, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %v", err)
 	}
+	versionCtx, versionCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	checkDockerAPIVersion(versionCtx, dockerClient, os.Getenv("DOCKER_API_VERSION"))
+	versionCancel()
 
 	// Create context for monitoring
 	monitorCtx, monitorCancel := context.WithCancel(context.Background())
 
 	driver := &VaultDriver{
 		client:        client,
+		secondary:     secondary,
 		config:        config,
 		dockerClient:  dockerClient,
 		secretTracker: make(map[string]*SecretInfo),
 		monitorCtx:    monitorCtx,
 		monitorCancel: monitorCancel,
+		history:       newRotationHistory(config.HistorySize),
+		metrics:       newDriverMetrics(),
+		leases:        newLeaseRegistry(),
+		configSources: sources,
+		configValues:  settings.reportedValues(),
+		started:       time.Now(),
+	}
+	if config.UpdatesPerMinute > 0 {
+		driver.updateLimiter = newUpdateLimiter(config.UpdatesPerMinute)
 	}
 
 	// Authenticate with Vault
-	if err := driver.authenticate(); err != nil {
-		return nil, fmt.Errorf("failed to authenticate with vault: %v", err)
-	}else{
-		log.Printf("Successfully authenticated with Vault using %s method", config.AuthMethod)
+	if err := driver.authenticate(driver.client); err != nil {
+		if config.InitFailure != initFailureDegrade {
+			return nil, fmt.Errorf("failed to authenticate with vault: %v", err)
+		}
+		log.Errorf("Failed to authenticate with vault, starting degraded: %v", err)
+		driver.setDegraded(true)
+		go driver.retryAuthentication(monitorCtx, initRetryInterval)
+		return driver, nil
+	}
+	log.Printf("Successfully authenticated with Vault using %s method", config.AuthMethod)
+	driver.setDegraded(false)
+	driver.start()
+
+	return driver, nil
+}
+
+// start runs the startup steps that need an authenticated client: the
+// capability check, the secondary cluster and monitoring
+func (d *VaultDriver) start() {
+	if len(d.config.CheckPaths) > 0 {
+		capabilitiesCtx, capabilitiesCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		checkCapabilities(capabilitiesCtx, d.client, d.config.CheckPaths)
+		capabilitiesCancel()
+	}
+	if d.secondary != nil {
+		if err := d.authenticate(d.secondary); err != nil {
+			log.Warnf("Failed to authenticate with secondary vault cluster: %v", err)
+		} else {
+			log.Printf("Secondary vault cluster configured at %s", d.config.SecondaryAddress)
+		}
+		d.setActiveCluster(false)
+	}
+
+	if d.config.MetricsExport != "" {
+		log.Printf("Exporting rotation metrics to %s every %v", d.config.MetricsExport, d.config.ExportInterval)
+		go d.runMetricsExport()
 	}
 
 	// Start monitoring if enabled
-	if config.EnableRotation {
-		log.Printf("Starting secret rotation monitoring with interval: %v", config.RotationInterval)
-		go driver.startMonitoring()
+	if d.config.EnableRotation {
+		log.Printf("Starting secret rotation monitoring with interval: %v", d.config.RotationInterval)
+		go d.startMonitoring()
 	} else {
 		log.Printf("Secret rotation monitoring is disabled")
 	}
+}
 
-	return driver, nil
+// newVaultClient creates a Vault API client for address using the configured
+// TLS settings. Each cluster has its own certificate, so the pinned
+// fingerprint, if any, is passed per cluster.
+func newVaultClient(config *VaultConfig, address, pin string) (*api.Client, error) {
+	vaultConfig := api.DefaultConfig()
+	vaultConfig.Address = address
+	vaultConfig.Backoff = retryAfterBackoff(config.MaxRetryAfter)
+
+	// Configure TLS if certificates are provided
+	if config.CACert != "" || config.ClientCert != "" {
+		tlsConfig := &api.TLSConfig{
+			CACert:     config.CACert,
+			ClientCert: config.ClientCert,
+			ClientKey:  config.ClientKey,
+		}
+		if err := vaultConfig.ConfigureTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %v", err)
+		}
+	}
+
+	// Pin the server certificate if a fingerprint is configured
+	if pin != "" {
+		if err := configureTLSPin(vaultConfig, pin); err != nil {
+			return nil, fmt.Errorf("failed to configure TLS pinning: %v", err)
+		}
+		log.Printf("Vault server certificate for %s pinned to SHA-256 fingerprint", address)
+	}
+
+	client, err := api.NewClient(vaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %v", err)
+	}
+	return client, nil
 }
 
 // authenticate handles various Vault authentication methods
-func (d *VaultDriver) authenticate() error {
+func (d *VaultDriver) authenticate(client *api.Client) error {
 	switch d.config.AuthMethod {
 	case "token":
 		if d.config.Token == "" {
 			return fmt.Errorf("VAULT_TOKEN is required for token authentication")
 		}
-		d.client.SetToken(d.config.Token)
+		client.SetToken(d.config.Token)
 
 	case "approle":
 		if d.config.RoleID == "" || d.config.SecretID == "" {
@@ -146,7 +345,7 @@ func (d *VaultDriver) authenticate() error {
 			"secret_id": d.config.SecretID,
 		}
 
-		resp, err := d.client.Logical().Write("auth/approle/login", data)
+		resp, err := client.Logical().Write("auth/approle/login", data)
 		if err != nil {
 			return fmt.Errorf("approle authentication failed: %v", err)
 		}
@@ -155,7 +354,7 @@ func (d *VaultDriver) authenticate() error {
 			return fmt.Errorf("no auth info returned from approle login")
 		}
 
-		d.client.SetToken(resp.Auth.ClientToken)
+		client.SetToken(resp.Auth.ClientToken)
 
 	default:
 		return fmt.Errorf("unsupported authentication method: %s", d.config.AuthMethod)
@@ -164,67 +363,154 @@ func (d *VaultDriver) authenticate() error {
 	return nil
 }
 
-// Update the Get method with better logging and secret tracking
+// Get retrieves a secret from Vault. Successful requests are logged according
+// to the configured sample rate, errors are always logged.
 func (d *VaultDriver) Get(req secrets.Request) secrets.Response {
-    log.Printf("Received secret request for: %s", req.SecretName)
+    verbose := d.sampleGetLog()
+    if verbose {
+        log.Printf("Received secret request for: %s", req.SecretName)
+    }
     
     if req.SecretName == "" {
         return secrets.Response{
             Err: "secret name is required",
         }
     }
+    if !d.Ready() {
+        return secrets.Response{
+            Err: "vault authentication failed at startup and is being retried",
+        }
+    }
+
+    if err := d.checkLabelCount(req); err != nil {
+        return secrets.Response{Err: err.Error()}
+    }
+
+    // Drop control labels the plugin isn't allowed to honor
+    req.SecretLabels = d.filterLabels(req)
+    if err := d.validateLabels(req); err != nil {
+        log.Errorf("Refusing secret request for %s: %v", req.SecretName, err)
+        return secrets.Response{Err: err.Error()}
+    }
 
     // Build the secret path based on labels and service information
     secretPath := d.buildSecretPath(req)
-    log.Printf("Built secret path: %s", secretPath)
+    if verbose {
+        log.Printf("Built secret path: %s", secretPath)
+    }
+    conflict := false
+    if d.config.EnableRotation {
+        var err error
+        if conflict, err = d.checkLabelConflict(req, secretPath); err != nil {
+            log.Errorf("Refusing secret request: %v", err)
+            return secrets.Response{Err: err.Error()}
+        }
+    }
     
     // Add context with timeout
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    ctx, cancel := context.WithTimeout(context.Background(), d.readTimeout(operationGet))
     defer cancel()
 
+    // Secrets that were just found missing are answered without a read
+    if d.cachedNotFound(secretPath, d.now()) {
+        d.metrics.inc("vault_negative_cache_hits_total")
+        d.recordGetOutcome(getResultNotFound)
+        return notFoundResponse(req.SecretName, secretPath, notFoundMissing, nil)
+    }
+
     // Read secret from Vault
-    secret, err := d.client.Logical().ReadWithContext(ctx, secretPath)
+    secret, issuer, err := d.timedRead(ctx, operationGet, secretPath)
     if err != nil {
-        log.Printf("Error reading secret from vault: %v", err)
+        log.Printf("Error reading secret %s from vault: %v", req.SecretName, err)
+        d.recordGetOutcome(classifyReadError(err))
         return secrets.Response{
             Err: fmt.Sprintf("failed to read secret from vault: %v", err),
         }
     }
 
     if secret == nil {
-        log.Printf("Secret not found at path: %s", secretPath)
-        return secrets.Response{
-            Err: fmt.Sprintf("secret not found at path: %s (verify the secret exists in Vault)", secretPath),
-        }
+        log.Printf("Secret %s not found at path: %s", req.SecretName, secretPath)
+        d.rememberNotFound(secretPath, d.now())
+        d.recordGetOutcome(getResultNotFound)
+        return notFoundResponse(req.SecretName, secretPath, notFoundMissing, nil)
+    }
+    d.forgetNotFound(secretPath)
+    d.logWarnings(req.SecretName, secretPath, secret)
+
+    if err := checkSecretDeleted(secret); err != nil {
+        log.Printf("Secret %s at path %s: %v", req.SecretName, secretPath, err)
+        d.recordGetOutcome(getResultNotFound)
+        return notFoundResponse(req.SecretName, secretPath, notFoundDeleted, err)
     }
 
-    log.Printf("Successfully read secret from vault")
+    if verbose {
+        log.Printf("Successfully read secret from vault")
+    }
     
     // Extract the secret value
     value, err := d.extractSecretValue(secret, req)
     if err != nil {
-        log.Printf("Error extracting secret value: %v", err)
+        log.Printf("Error extracting secret value for %s: %v", req.SecretName, err)
+        d.recordGetOutcome(getResultExtractionError)
         return secrets.Response{
             Err: fmt.Sprintf("failed to extract secret value: %v", err),
         }
-    }else{
+    }else if verbose {
 		log.Printf("Extracted secret value successfully")
 	}
+    // Rendered files aren't JSON, so vault_json_field doesn't apply to them
+    if path := req.SecretLabels["vault_json_field"]; path != "" && req.SecretLabels["vault_format"] == "" {
+        if value, err = selectJSONPath(value, path); err != nil {
+            log.Printf("Error selecting JSON path in secret %s: %v", req.SecretName, err)
+            d.recordGetOutcome(getResultExtractionError)
+            return secrets.Response{
+                Err: fmt.Sprintf("failed to extract secret value: %v", err),
+            }
+        }
+    }
+    if err := d.checkBlankValue(req.SecretName, secretPath, value); err != nil {
+        d.recordGetOutcome(getResultExtractionError)
+        return secrets.Response{
+            Err: fmt.Sprintf("failed to extract secret value: %v", err),
+        }
+    }
+    value = applyTrailingNewline(value, req.SecretLabels["vault_trailing_newline"])
 
     // Track this secret for monitoring if rotation is enabled
-    if d.config.EnableRotation {
-        d.trackSecret(req, secretPath, value)
+    if d.config.EnableRotation && !conflict {
+        // extractSecretValue already succeeded, so the fields are readable
+        data, _ := secretFields(secret)
+        watchFields := parseList(req.SecretLabels["vault_watch_fields"])
+        d.trackSecret(req, secretPath, watchedInput(watchFields, data, value), verbose)
+        d.recordValueHash(req.SecretName, value)
     }
 
     // Determine if secret should be reusable
     doNotReuse := d.shouldNotReuse(req)
 
-    log.Printf("Successfully returning secret value")
+    if verbose {
+        log.Printf("Successfully returning secret value")
+    }
+    d.recordLease(secret, issuer)
+    d.recordGetOutcome(getResultSuccess)
     return secrets.Response{
         Value:      value,
         DoNotReuse: doNotReuse,
     }
 }
+
+// sampleGetLog reports whether the current Get request should log its
+// success path. It uses an atomic counter so concurrent requests don't
+// contend on a lock.
+func (d *VaultDriver) sampleGetLog() bool {
+	rate := d.config.LogSampleRate
+	if rate <= 1 {
+		return true
+	}
+	n := atomic.AddUint64(&d.getCounter, 1)
+	return (n-1)%uint64(rate) == 0
+}
+
 // buildSecretPath constructs the Vault secret path based on request labels and service information
 func (d *VaultDriver) buildSecretPath(req secrets.Request) string {
 	// Use custom path from labels if provided
@@ -253,20 +539,52 @@ func (d *VaultDriver) buildSecretPath(req secrets.Request) string {
 
 // extractSecretValue extracts the appropriate value from the Vault response
 func (d *VaultDriver) extractSecretValue(secret *api.Secret, req secrets.Request) ([]byte, error) {
-	// For KV v2, data is nested under "data"
-	var data map[string]interface{}
-	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
-	} else {
-		data = secret.Data
+	data, err := secretFields(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole secret can be rendered as a file instead of a single value
+	format, err := parseFormat(req.SecretLabels["vault_format"])
+	if err != nil {
+		return nil, err
+	}
+	if format == formatProperties {
+		return propertiesFile(data, d.config.ExcludeFields)
+	}
+
+	// Several fields can be combined into one value, e.g. TLS bundles or DSNs
+	if fields := parseList(req.SecretLabels["vault_pem_bundle"]); fields != nil {
+		return pemBundle(data, fields)
+	}
+	if fields, separator := parseFieldJoin(req); fields != nil {
+		return joinFields(data, fields, separator)
 	}
 
 	// Check for specific field in labels
-	if field, exists := req.SecretLabels["vault_field"]; exists {
+	field, err := resolveVaultField(req)
+	if err != nil {
+		return nil, err
+	}
+	value, fallback, err := d.selectField(data, field)
+	if fallback != "" {
+		// Falling back is often a sign the field selection is wrong
+		d.metrics.inc("vault_extraction_fallback_total")
+		log.Debugf("No explicit or default field matched for secret %s, %s", req.SecretName, fallback)
+	}
+	return value, err
+}
+
+// selectField returns the value of field, or for an empty field the first of
+// the default fields present, then the VAULT_EXTRACTION_FALLBACK choice. Get
+// and rotation share it, so a rotated version holds what Get would serve. The
+// fallback taken, if any, is described for logging.
+func (d *VaultDriver) selectField(data map[string]interface{}, field string) ([]byte, string, error) {
+	if field != "" {
 		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
+			return []byte(fmt.Sprintf("%v", value)), "", nil
 		}
-		return nil, fmt.Errorf("field %s not found in secret", field)
+		return nil, "", fmt.Errorf("field %s not found in secret", field)
 	}
 
 	// Default field names to try
@@ -274,26 +592,68 @@ func (d *VaultDriver) extractSecretValue(secret *api.Secret, req secrets.Request
 
 	// Try to find a value using default field names
 	for _, field := range defaultFields {
+		if d.config.ExcludeFields[field] {
+			continue
+		}
 		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
+			return []byte(fmt.Sprintf("%v", value)), "", nil
 		}
 	}
 
-	// If no specific field found, return the first string value
-	for _, value := range data {
-		if strValue, ok := value.(string); ok {
-			return []byte(strValue), nil
-		}
+	return d.extractionFallback(data)
+}
+
+// resolveVaultField returns the field selected by the vault_field label, or by
+// rendering the vault_field_template label (e.g. "{{.Service}}_password") for
+// the requesting service. It returns "" when neither label is set.
+func resolveVaultField(req secrets.Request) (string, error) {
+	if field, exists := req.SecretLabels["vault_field"]; exists {
+		return field, nil
+	}
+	text, exists := req.SecretLabels["vault_field_template"]
+	if !exists {
+		return "", nil
 	}
+	tmpl, err := template.New("vault_field").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault_field_template: %v", err)
+	}
+	var field strings.Builder
+	if err := tmpl.Execute(&field, struct{ Service string }{req.ServiceName}); err != nil {
+		return "", fmt.Errorf("failed to render vault_field_template: %v", err)
+	}
+	return field.String(), nil
+}
 
-	return nil, fmt.Errorf("no suitable secret value found")
+// applyTrailingNewline applies a vault_trailing_newline mode to a value:
+// "preserve" (the default) leaves it as is, "strip" removes trailing newlines
+// and "ensure" adds one if missing
+func applyTrailingNewline(value []byte, mode string) []byte {
+	switch mode {
+	case "", "preserve":
+		return value
+	case "strip":
+		return bytes.TrimRight(value, "\r\n")
+	case "ensure":
+		if !bytes.HasSuffix(value, []byte("\n")) {
+			return append(value[:len(value):len(value)], '\n')
+		}
+		return value
+	}
+	log.Warnf("Invalid vault_trailing_newline mode %q, preserving value", mode)
+	return value
 }
 
 // shouldNotReuse determines if the secret should not be reused
 func (d *VaultDriver) shouldNotReuse(req secrets.Request) bool {
 	// Check for explicit label
-	if reuse, exists := req.SecretLabels["vault_reuse"]; exists {
-		return strings.ToLower(reuse) == "false"
+	if reuse, err := strconv.ParseBool(strings.TrimSpace(req.SecretLabels["vault_reuse"])); err == nil {
+		return !reuse
+	}
+
+	// A templated field resolves to a different value per service
+	if _, exists := req.SecretLabels["vault_field_template"]; exists {
+		return true
 	}
 
 	// Don't reuse dynamic secrets or certificates
@@ -314,35 +674,104 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-// parseDurationOrDefault parses duration string or returns default
-func parseDurationOrDefault(durationStr string) time.Duration {
-	if duration, err := time.ParseDuration(durationStr); err == nil {
+// durationUnits maps human-friendly unit names to durations
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+}
+
+// humanDuration matches values like "5 min" or "2hours"
+var humanDuration = regexp.MustCompile(`^(\d+)\s*([a-zA-Z]+)$`)
+
+// parseDurationOrDefault parses a Go duration ("5m"), a bare integer in seconds
+// ("300") or a human-friendly value ("5 min"). Empty, invalid and negative
+// values return the setting's default.
+func parseDurationOrDefault(durationStr string, defaultValue time.Duration) time.Duration {
+	value := strings.TrimSpace(durationStr)
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return duration
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		duration := time.Duration(seconds) * time.Second
+		log.Printf("Interpreted duration %q as %v", durationStr, duration)
 		return duration
 	}
-	return 5 * time.Minute // Default to 5 minutes
+	if match := humanDuration.FindStringSubmatch(value); match != nil {
+		if unit, ok := durationUnits[strings.ToLower(match[2])]; ok {
+			n, _ := strconv.Atoi(match[1])
+			duration := time.Duration(n) * unit
+			log.Printf("Interpreted duration %q as %v", durationStr, duration)
+			return duration
+		}
+	}
+	if value != "" {
+		log.Warnf("Invalid duration %q, using default of %v", durationStr, defaultValue)
+	}
+	return defaultValue
+}
+
+// parseIntOrDefault parses an integer string or returns the default
+func parseIntOrDefault(value string, defaultValue int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return n
+	}
+	return defaultValue
 }
 
-// trackSecret adds or updates a secret in the tracking system
-func (d *VaultDriver) trackSecret(req secrets.Request, vaultPath string, value []byte) {
+// parseList splits a comma-separated value, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// trackSecret adds or updates a secret in the tracking system. value is what
+// the change-detection hash is computed over. verbose is the log sampling
+// decision of the Get request being served.
+func (d *VaultDriver) trackSecret(req secrets.Request, vaultPath string, value []byte, verbose bool) {
+	d.trackSecretHash(req, vaultPath, hashValue(d.config.HashAlgo, value), verbose)
+}
+
+// trackSecretHash adds or updates a secret in the tracking system with a
+// known change-detection hash
+func (d *VaultDriver) trackSecretHash(req secrets.Request, vaultPath, hash string, verbose bool) {
 	d.trackerMutex.Lock()
 	defer d.trackerMutex.Unlock()
-
-	// Calculate hash for change detection
-	hash := fmt.Sprintf("%x", sha256.Sum256(value))
 	
-	// Extract vault field from labels
-	vaultField := req.SecretLabels["vault_field"]
-	if vaultField == "" {
-		vaultField = "value" // default field
-	}
+	// Extract vault field from labels, empty to search the default fields
+	vaultField, _ := resolveVaultField(req)
 	
 	secretInfo := &SecretInfo{
-		DockerSecretName: req.SecretName,
-		VaultPath:        vaultPath,
-		VaultField:       vaultField,
-		ServiceNames:     []string{req.ServiceName}, // Start with current service
-		LastHash:         hash,
-		LastUpdated:      time.Now(),
+		DockerSecretName:  req.SecretName,
+		CurrentSecretName: req.SecretName,
+		VaultPath:         vaultPath,
+		VaultField:        vaultField,
+		ServiceNames:      []string{req.ServiceName}, // Start with current service
+		LastHash:          hash,
+		LastUpdated:       d.now(),
+		Priority:          parsePriority(req.SecretLabels["vault_priority"]),
+		CheckInterval:     parseCheckInterval(req.SecretLabels["vault_rotation_interval"], req.SecretName),
+		Aliases:           parseList(req.SecretLabels["vault_aliases"]),
+		TrailingNewline:   req.SecretLabels["vault_trailing_newline"],
+		RotateCron:        req.SecretLabels["vault_rotate_cron"],
+		RotationMode:      req.SecretLabels["vault_rotation_mode"],
+		JSONPath:          req.SecretLabels["vault_json_field"],
+		WatchFields:       parseList(req.SecretLabels["vault_watch_fields"]),
+		ContentType:       req.SecretLabels["vault_content_type"],
+		Stack:             req.SecretLabels[stackNamespaceLabel],
+	}
+	secretInfo.Format, _ = parseFormat(req.SecretLabels["vault_format"])
+	secretInfo.JoinFields, secretInfo.JoinSeparator = parseFieldJoin(req)
+	if fields := parseList(req.SecretLabels["vault_pem_bundle"]); fields != nil {
+		secretInfo.JoinFields, secretInfo.PEMBundle = fields, true
+	}
+	if secretInfo.RotateCron == "" {
+		secretInfo.RotateCron = d.config.RotateCron
 	}
 	
 	// If already tracking, update service names
@@ -358,18 +787,56 @@ func (d *VaultDriver) trackSecret(req secrets.Request, vaultPath string, value [
 		if !serviceFound && req.ServiceName != "" {
 			existing.ServiceNames = append(existing.ServiceNames, req.ServiceName)
 		}
-		existing.LastHash = hash
-		existing.LastUpdated = time.Now()
+		// LastHash stays at what the tracked versions hold: a value served
+		// here isn't in them until a sweep rotates it in
+		existing.LastUpdated = d.now()
+		existing.Priority = secretInfo.Priority
+		if existing.CheckInterval != secretInfo.CheckInterval {
+			existing.CheckInterval = secretInfo.CheckInterval
+			existing.NextCheck = time.Time{}
+		}
+		existing.Aliases = secretInfo.Aliases
+		existing.TrailingNewline = secretInfo.TrailingNewline
+		existing.JoinFields = secretInfo.JoinFields
+		existing.JoinSeparator = secretInfo.JoinSeparator
+		existing.PEMBundle = secretInfo.PEMBundle
+		existing.RotationMode = secretInfo.RotationMode
+		existing.JSONPath = secretInfo.JSONPath
+		existing.WatchFields = secretInfo.WatchFields
+		existing.ContentType = secretInfo.ContentType
+		existing.Format = secretInfo.Format
+		existing.Stack = secretInfo.Stack
+		if existing.RotateCron != secretInfo.RotateCron {
+			existing.RotateCron = secretInfo.RotateCron
+			existing.RotateSchedule = parseRotateCron(secretInfo.RotateCron, req.SecretName)
+			existing.NextScheduledRotation = time.Time{}
+		}
 	} else {
+		secretInfo.RotateSchedule = parseRotateCron(secretInfo.RotateCron, req.SecretName)
+		d.evictTrackedSecrets()
 		d.secretTracker[req.SecretName] = secretInfo
 	}
+	d.setTrackedInfo(d.secretTracker[req.SecretName])
 	
-	log.Printf("Tracking secret: %s -> %s (services: %v)", req.SecretName, vaultPath, secretInfo.ServiceNames)
+	if verbose {
+		log.Printf("Tracking secret: %s -> %s (services: %v)", req.SecretName, vaultPath, d.secretTracker[req.SecretName].ServiceNames)
+	}
 }
 
 // startMonitoring starts the background monitoring goroutine
 func (d *VaultDriver) startMonitoring() {
-	ticker := time.NewTicker(d.config.RotationInterval)
+	// Catch changes made while the plugin was down instead of waiting a full
+	// interval. Secrets rotated before the restart are tracked again from the
+	// labels on their versions first, so the sweep has something to check.
+	if d.config.SweepOnStart {
+		if err := d.seedTracker(); err != nil {
+			log.Errorf("Failed to seed tracked secrets from Docker: %v", err)
+		}
+		log.Printf("Running initial secret change sweep")
+		d.sweep(d.now())
+	}
+
+	ticker := d.clockOrDefault().NewTicker(d.config.RotationInterval)
 	defer ticker.Stop()
 	
 	log.Printf("Secret monitoring started with interval: %v", d.config.RotationInterval)
@@ -379,45 +846,121 @@ func (d *VaultDriver) startMonitoring() {
 		case <-d.monitorCtx.Done():
 			log.Printf("Secret monitoring stopped")
 			return
-		case <-ticker.C:
-			d.checkForSecretChanges()
+		case now := <-ticker.C():
+			d.sweep(now)
 		}
 	}
 }
 
-// checkForSecretChanges monitors tracked secrets for changes
-func (d *VaultDriver) checkForSecretChanges() {
+// sweep checks tracked secrets for changes, runs due scheduled rotations and
+// optionally reconciles dangling references
+func (d *VaultDriver) sweep(now time.Time) {
+	d.rotationMutex.Lock()
+	defer d.rotationMutex.Unlock()
+	
+	// Under memory pressure, optionally shed everything but scheduled rotations
+	if d.checkMemory(currentMemSys()) && d.config.MemShedLoad {
+		d.runScheduledRotations(now)
+		return
+	}
+	d.checkForSecretChanges()
+	d.runScheduledRotations(now)
+	d.expireRollbacks(now)
+	if d.config.ReconcileDangling {
+		if err := d.reconcileDanglingSecrets(); err != nil {
+			log.Errorf("Failed to reconcile dangling secret references: %v", err)
+		}
+	}
+	if d.config.ReconcileServices {
+		if err := d.reconcileServiceNames(); err != nil {
+			log.Errorf("Failed to reconcile the services of tracked secrets: %v", err)
+		}
+	}
+}
+
+// checkForSecretChanges monitors tracked secrets for changes, highest priority
+// first, and returns a summary of the sweep
+func (d *VaultDriver) checkForSecretChanges() (summary sweepSummary) {
+	tick := atomic.AddUint64(&d.sweepCount, 1)
+	start := d.now()
+	d.sweepReads.Store(newReadCache())
+	defer func() {
+		d.sweepReads.Store(nil)
+		summary.Duration = d.now().Sub(start)
+		d.recordSweep(summary)
+		d.recordBacklog()
+	}()
+	
 	d.trackerMutex.RLock()
-	secrets := make(map[string]*SecretInfo)
-	for k, v := range d.secretTracker {
-		secrets[k] = v
+	tracked := make([]*SecretInfo, 0, len(d.secretTracker))
+	for _, v := range d.secretTracker {
+		tracked = append(tracked, v)
 	}
+	due := secretsDueForCheck(tracked, tick, d.config.LowPriorityEvery)
 	d.trackerMutex.RUnlock()
+	d.checkEmptyTracker(len(tracked), start)
+	due = d.dueByInterval(due, start)
 	
-	if len(secrets) == 0 {
+	if len(due) == 0 {
 		log.Debug("No secrets to monitor")
-		return
+		return summary
 	}
 	
-	log.Printf("Checking %d tracked secrets for changes", len(secrets))
+	log.Printf("Checking %d of %d tracked secrets for changes", len(due), len(tracked))
+	summary.Checked = len(due)
+	inWindow := d.inRotationWindow(d.now())
 	
-	for secretName, secretInfo := range secrets {
-		if d.hasSecretChanged(secretInfo) {
+	for _, secretInfo := range due {
+		secretName := secretInfo.DockerSecretName
+		changed := d.hasSecretChanged(secretInfo)
+		if changed {
+			summary.Changed++
+		}
+		pending := changed || d.hasDeferredChange(secretInfo)
+		switch {
+		case changed && secretInfo.RotationMode == rotationModeManual:
+			d.holdRotation(secretInfo)
+			d.markBacklog(secretInfo)
+			summary.Held++
+		case pending && !inWindow:
+			// Kept as DeferredHash, so the first sweep in the next window
+			// rotates it even if the change is no longer detected
+			d.deferRotation(secretInfo)
+			log.Printf("Deferring rotation of secret %s until the next rotation window", secretName)
+			d.metrics.inc("vault_rotations_deferred_total")
+			d.markBacklog(secretInfo)
+			summary.Deferred++
+		case pending:
 			log.Printf("Detected change in secret: %s", secretName)
-			if err := d.rotateSecret(secretInfo); err != nil {
+			if _, err := d.rotateSecret(secretInfo); err != nil {
 				log.Errorf("Failed to rotate secret %s: %v", secretName, err)
+				d.markBacklog(secretInfo)
+				summary.Failed++
+			} else {
+				d.clearBacklog(secretInfo)
+				summary.Rotated++
+			}
+		default:
+			d.clearPending(secretInfo)
+			d.clearBacklog(secretInfo)
+			if err := d.retryAliases(secretInfo); err != nil {
+				log.Errorf("Failed to sync aliases of secret %s: %v", secretName, err)
 			}
 		}
+		if len(d.failedAliases(secretInfo)) > 0 {
+			summary.AliasesFailed++
+		}
 	}
+	return summary
 }
 
 // hasSecretChanged checks if a secret has changed in Vault
 func (d *VaultDriver) hasSecretChanged(secretInfo *SecretInfo) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), d.readTimeout(operationCheck))
 	defer cancel()
 	
 	// Read secret from Vault
-	secret, err := d.client.Logical().ReadWithContext(ctx, secretInfo.VaultPath)
+	secret, _, err := d.sweepRead(ctx, operationCheck, secretInfo.VaultPath)
 	if err != nil {
 		log.Errorf("Error reading secret %s from vault: %v", secretInfo.DockerSecretName, err)
 		return false
@@ -427,107 +970,251 @@ func (d *VaultDriver) hasSecretChanged(secretInfo *SecretInfo) bool {
 		log.Warnf("Secret %s not found at path: %s", secretInfo.DockerSecretName, secretInfo.VaultPath)
 		return false
 	}
+	d.logWarnings(secretInfo.DockerSecretName, secretInfo.VaultPath, secret)
+	d.recordSecretAge(secretInfo.DockerSecretName, secret)
+	
+	// Keep serving the last value while the current version is deleted
+	if err := checkSecretDeleted(secret); err != nil {
+		d.trackerMutex.Lock()
+		if !secretInfo.Deleted {
+			log.Warnf("Secret %s: %v", secretInfo.DockerSecretName, err)
+		}
+		secretInfo.Deleted = true
+		d.trackerMutex.Unlock()
+		return false
+	}
 	
 	// Extract current value
-	var data map[string]interface{}
-	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
-	} else {
-		data = secret.Data
+	data, err := secretFields(secret)
+	if err != nil {
+		log.Errorf("Secret %s: %v", secretInfo.DockerSecretName, err)
+		return false
 	}
 	
-	var currentValue []byte
-	if value, ok := data[secretInfo.VaultField]; ok {
-		currentValue = []byte(fmt.Sprintf("%v", value))
-	} else {
-		log.Errorf("Field %s not found in secret %s", secretInfo.VaultField, secretInfo.DockerSecretName)
+	currentValue, err := d.trackedValue(secretInfo, data)
+	if err != nil {
+		log.Errorf("Secret %s: %v", secretInfo.DockerSecretName, err)
 		return false
 	}
 	
 	// Calculate current hash
-	currentHash := fmt.Sprintf("%x", sha256.Sum256(currentValue))
+	currentHash := hashValue(d.config.HashAlgo, watchedInput(secretInfo.WatchFields, data, currentValue))
+	
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.CheckedHash = currentHash
+	
+	// An undeleted secret is propagated even if its value is unchanged
+	if secretInfo.Deleted {
+		log.Printf("Secret %s is readable again", secretInfo.DockerSecretName)
+		secretInfo.Deleted = false
+		return true
+	}
+	
+	// After switching algorithms the stored hash can't be compared, so adopt
+	// the new one instead of treating every secret as changed
+	if algo := hashAlgoOf(secretInfo.LastHash); algo != hashAlgoOf(currentHash) {
+		log.Printf("Rehashing secret %s with %s (was %s)", secretInfo.DockerSecretName, hashAlgoOf(currentHash), algo)
+		secretInfo.LastHash = currentHash
+		return false
+	}
 	
 	return currentHash != secretInfo.LastHash
 }
 
-// rotateSecret handles the secret rotation process
-func (d *VaultDriver) rotateSecret(secretInfo *SecretInfo) error {
+// rotateSecret rotates a secret after a detected change, skipping it when the
+// value is identical to the current version
+func (d *VaultDriver) rotateSecret(secretInfo *SecretInfo) (RotationResult, error) {
+	return d.rotate(secretInfo, false, "")
+}
+
+// forceRotateSecret rotates a secret even if its value is unchanged
+func (d *VaultDriver) forceRotateSecret(secretInfo *SecretInfo) (RotationResult, error) {
+	return d.rotate(secretInfo, true, "")
+}
+
+// rotate handles the secret rotation process and reports what it changed,
+// also when it fails part way. A non-empty heldHash is the change-detection
+// hash of an approved change; the rotation fails if Vault no longer holds it.
+func (d *VaultDriver) rotate(secretInfo *SecretInfo, force bool, heldHash string) (result RotationResult, err error) {
 	log.Printf("Starting rotation for secret: %s", secretInfo.DockerSecretName)
 	
+	// Record the outcome in the rotation history
+	start := d.now()
+	result.SecretName = secretInfo.DockerSecretName
+	d.trackerMutex.RLock()
+	result.OldHash = hashPrefix(secretInfo.LastHash)
+	services := append([]string(nil), secretInfo.ServiceNames...)
+	d.trackerMutex.RUnlock()
+	defer func() {
+		result.Duration = d.now().Sub(start)
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		} else if result.Skipped {
+			outcome = "skipped"
+		}
+		d.metrics.inc(fmt.Sprintf("vault_rotations_total{result=%q}", outcome))
+		d.metrics.observe("vault_rotation_duration_seconds", fmt.Sprintf("result=%q", outcome), result.Duration.Seconds())
+		d.history.add(result.record(start, services, err))
+	}()
+	
 	// Get the new secret value from Vault
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), d.readTimeout(operationRotate))
 	defer cancel()
 	
-	secret, err := d.client.Logical().ReadWithContext(ctx, secretInfo.VaultPath)
+	secret, issuer, err := d.sweepRead(ctx, operationRotate, secretInfo.VaultPath)
 	if err != nil {
-		return fmt.Errorf("failed to read updated secret from vault: %v", err)
+		return result, fmt.Errorf("failed to read updated secret from vault: %v", err)
 	}
 	
 	if secret == nil {
-		return fmt.Errorf("secret not found at path: %s", secretInfo.VaultPath)
+		return result, fmt.Errorf("secret not found at path: %s", secretInfo.VaultPath)
+	}
+	if err := checkSecretDeleted(secret); err != nil {
+		return result, err
 	}
 	
 	// Extract the new value
-	var data map[string]interface{}
-	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
-	} else {
-		data = secret.Data
+	data, err := secretFields(secret)
+	if err != nil {
+		return result, err
 	}
 	
-	var newValue []byte
-	if value, ok := data[secretInfo.VaultField]; ok {
-		newValue = []byte(fmt.Sprintf("%v", value))
-	} else {
-		return fmt.Errorf("field %s not found in secret", secretInfo.VaultField)
+	newValue, err := d.trackedValue(secretInfo, data)
+	if err != nil {
+		return result, err
+	}
+	if err := d.checkBlankValue(secretInfo.DockerSecretName, secretInfo.VaultPath, newValue); err != nil {
+		return result, err
+	}
+	watchedHash := hashValue(d.config.HashAlgo, watchedInput(secretInfo.WatchFields, data, newValue))
+	if heldHash != "" && watchedHash != heldHash {
+		return result, fmt.Errorf("secret %s changed again after the approved change was held", secretInfo.DockerSecretName)
+	}
+	
+	d.trackerMutex.RLock()
+	currentName := secretInfo.CurrentSecretName
+	currentValueHash := secretInfo.ValueHash
+	d.trackerMutex.RUnlock()
+	
+	// Metadata or watched fields can change while the value stays the same, and
+	// a new version with identical bytes would only restart services
+	newValueHash := hashValue(d.config.HashAlgo, newValue)
+	if !force && currentValueHash != "" && newValueHash == currentValueHash {
+		log.Printf("Value of secret %s is unchanged, skipping rotation", secretInfo.DockerSecretName)
+		result.Skipped = true
+		d.trackerMutex.Lock()
+		secretInfo.LastHash = watchedHash
+		secretInfo.DeferredHash = ""
+		d.trackerMutex.Unlock()
+		return result, nil
+	}
+	
+	// A failing pre-rotation hook aborts the rotation
+	if err := runRotationHook(d.config.PreRotationHook, d.config.HookTimeout, secretInfo.DockerSecretName, services); err != nil {
+		return result, fmt.Errorf("pre-rotation hook: %v", err)
 	}
 	
 	// Update Docker secret (this now handles service updates internally)
-	if err := d.updateDockerSecret(secretInfo.DockerSecretName, newValue); err != nil {
-		return fmt.Errorf("failed to update docker secret: %v", err)
+	newSecretName, newSecretID, updatedServices, err := d.updateDockerSecret(secretInfo.DockerSecretName, currentName, secretInfo.ContentType, newValue)
+	if err != nil {
+		var updateErr *serviceUpdateError
+		if errors.As(err, &updateErr) {
+			result.UpdatedServices = updateErr.updated
+			result.FailedServices = updateErr.failed
+		}
+		return result, fmt.Errorf("failed to update docker secret: %v", err)
 	}
+	result.NewSecretName = newSecretName
+	result.NewSecretID = newSecretID
+	result.UpdatedServices = updatedServices
+	d.recordLease(secret, issuer)
 	
 	// Update tracking information
 	d.trackerMutex.Lock()
-	secretInfo.LastHash = fmt.Sprintf("%x", sha256.Sum256(newValue))
-	secretInfo.LastUpdated = time.Now()
+	secretInfo.CurrentSecretName = newSecretName
+	secretInfo.ValueHash = newValueHash
+	secretInfo.LastHash = watchedHash
+	secretInfo.DeferredHash = ""
+	secretInfo.LastUpdated = d.now()
+	result.NewHash = hashPrefix(secretInfo.LastHash)
 	d.trackerMutex.Unlock()
+	d.setRollback(secretInfo, currentName, currentValueHash)
 	
 	log.Printf("Successfully rotated secret: %s", secretInfo.DockerSecretName)
-	return nil
+	
+	// Aliases reuse the value read above. The secret itself was rotated, so a
+	// failed alias is reported on its own and retried by the next sweep
+	d.trackerMutex.RLock()
+	aliases := append([]string(nil), secretInfo.Aliases...)
+	d.trackerMutex.RUnlock()
+	var aliasErr error
+	result.Aliases, aliasErr = d.syncAliases(secretInfo, aliases, newValue)
+	if aliasErr != nil {
+		log.Errorf("Secret %s: %v", secretInfo.DockerSecretName, aliasErr)
+		result.FailedAliases = d.failedAliases(secretInfo)
+	}
+	
+	// The rotation already happened, so a failing post-rotation hook only warns
+	if err := runRotationHook(d.config.PostRotationHook, d.config.HookTimeout, secretInfo.DockerSecretName, services,
+		"VAULT_SECRET_NEW_NAME="+newSecretName,
+		"VAULT_SECRET_UPDATED_SERVICES="+strings.Join(updatedServices, ","),
+	); err != nil {
+		log.Warnf("Post-rotation hook for secret %s: %v", secretInfo.DockerSecretName, err)
+	}
+	return result, nil
 }
 
-// updateDockerSecret creates a new version of the Docker secret
-func (d *VaultDriver) updateDockerSecret(secretName string, newValue []byte) error {
+// updateDockerSecret creates a new version of the Docker secret and returns its name and ID.
+// secretName is the stable alias the secret was originally requested as, currentName
+// is the Docker secret services currently reference. A non-empty contentType is
+// recorded on the new version.
+func (d *VaultDriver) updateDockerSecret(secretName, currentName, contentType string, newValue []byte) (string, string, []string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	
 	// List existing secrets to find the one to update
-	secrets, err := d.dockerClient.SecretList(ctx, types.SecretListOptions{})
+	secrets, err := d.listSecrets(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list secrets: %v", err)
+		return "", "", nil, fmt.Errorf("failed to list secrets: %v", err)
 	}
 	
-	var existingSecret *swarm.Secret
-	for _, secret := range secrets {
-		if secret.Spec.Name == secretName {
-			existingSecret = &secret
-			break
-		}
+	// Only consider secrets of the same stack, other stacks may use the same names
+	stackSecrets := inStack(secrets, d.secretStack(secretName))
+	existingSecret := findCurrentSecret(stackSecrets, secretName, currentName)
+	if existingSecret == nil {
+		return "", "", nil, fmt.Errorf("secret %s not found", secretName)
+	}
+	partial := partialVersions(stackSecrets, secretName, existingSecret)
+	oldNames := []string{existingSecret.Spec.Name}
+	for _, secret := range partial {
+		oldNames = append(oldNames, secret.Spec.Name)
 	}
 	
-	if existingSecret == nil {
-		return fmt.Errorf("secret %s not found", secretName)
+	// Generate a unique name for the new secret version, always derived from the
+	// alias so repeated rotations don't keep appending timestamps
+	newSecretName, err := versionedSecretName(secretName, d.now().Unix(), d.config.SecretNamePrefix, d.config.SecretNameSuffix)
+	if err != nil {
+		return "", "", nil, err
 	}
 	
-	// Generate a unique name for the new secret version
-	newSecretName := fmt.Sprintf("%s-%d", secretName, time.Now().Unix())
+	// Copy labels and record the alias so the next rotation can find this version
+	labels := make(map[string]string, len(existingSecret.Spec.Labels)+1)
+	for k, v := range existingSecret.Spec.Labels {
+		labels[k] = v
+	}
+	labels[secretAliasLabel] = secretName
+	if contentType != "" {
+		labels[contentTypeLabel] = contentType
+	}
+	d.labelTrackedVersion(labels, secretName, newValue)
 	
 	// Create new secret with versioned name and same labels but updated value
 	newSecretSpec := swarm.SecretSpec{
 		Annotations: swarm.Annotations{
 			Name:   newSecretName,
-			Labels: existingSecret.Spec.Labels,
+			Labels: labels,
 		},
 		Data: newValue,
 	}
@@ -535,39 +1222,145 @@ func (d *VaultDriver) updateDockerSecret(secretName string, newValue []byte) err
 	// Create the new secret
 	createResponse, err := d.dockerClient.SecretCreate(ctx, newSecretSpec)
 	if err != nil {
-		return fmt.Errorf("failed to create new secret version: %v", err)
+		return "", "", nil, fmt.Errorf("failed to create new secret version: %v", err)
 	}
 	
 	log.Printf("Created new version of secret %s with name %s and ID: %s", secretName, newSecretName, createResponse.ID)
 	
 	// Update all services that use this secret to point to the new version
-	if err := d.updateServicesSecretReference(secretName, newSecretName, createResponse.ID); err != nil {
-		// If we can't update services, remove the new secret and return error
+	mode := d.config.RotationPartial
+	updatedServices, failedServices, err := d.updateServicesSecretReference(oldNames, newSecretName, createResponse.ID, mode == partialContinue)
+	d.metrics.add(`vault_rotation_service_updates_total{result="success"}`, float64(len(updatedServices)))
+	d.metrics.add(`vault_rotation_service_updates_total{result="error"}`, float64(len(failedServices)))
+	if err == nil {
+		err = d.checkRotationConsumers(secretName, updatedServices)
+	}
+	if err != nil {
+		if len(updatedServices) > 0 && mode == partialRollback {
+			// Move the services that were updated back to the old version
+			if _, _, rollbackErr := d.updateServicesSecretReference([]string{newSecretName}, existingSecret.Spec.Name, existingSecret.ID, true); rollbackErr != nil {
+				log.Errorf("Failed to roll back services to secret %s: %v", existingSecret.Spec.Name, rollbackErr)
+			} else {
+				log.Warnf("Rolled back services %v to secret %s", updatedServices, existingSecret.Spec.Name)
+				updatedServices = nil
+			}
+		}
+		updateErr := &serviceUpdateError{updated: updatedServices, failed: failedServices, err: err}
+		if len(updatedServices) > 0 {
+			// Some services already use the new version, so keep both versions.
+			// The tracked hash isn't updated, so the next sweep rotates again and
+			// also moves the services left on this version, see partialVersions.
+			log.Warnf("Rotation of secret %s partially applied: updated %v, failed %v", secretName, updatedServices, failedServices)
+			return "", "", nil, updateErr
+		}
+		// If no service uses the new secret, remove it and return error
 		d.dockerClient.SecretRemove(ctx, createResponse.ID)
-		return fmt.Errorf("failed to update services to use new secret: %v", err)
+		return "", "", nil, updateErr
 	}
 	
-	// Remove the old secret only after services are updated
-	if err := d.dockerClient.SecretRemove(ctx, existingSecret.ID); err != nil {
+	// Remove the old secret only after services are updated, unless old versions are kept
+	if d.config.KeepOldSecrets {
+		log.Printf("Keeping old version %s of secret %s", existingSecret.Spec.Name, secretName)
+	} else if d.keepForRollback(secretName) {
+		log.Printf("Keeping old version %s of secret %s for rollback", existingSecret.Spec.Name, secretName)
+	} else if err := d.dockerClient.SecretRemove(ctx, existingSecret.ID); err != nil {
 		log.Warnf("Failed to remove old secret version %s: %v", existingSecret.ID, err)
 		// Don't return error as the new secret was created and services updated successfully
 	}
+	// Versions of earlier partial rotations no longer have services
+	if !d.config.KeepOldSecrets {
+		for _, secret := range partial {
+			if err := d.dockerClient.SecretRemove(ctx, secret.ID); err != nil {
+				log.Warnf("Failed to remove partially rotated version %s: %v", secret.Spec.Name, err)
+			}
+		}
+	}
 	
-	return nil
+	return newSecretName, createResponse.ID, updatedServices, nil
+}
+
+// partialVersions returns the versions of secretName created after its current
+// version. Only a partially applied rotation leaves them behind, with some
+// services moved to them, since a complete rotation makes its version current
+// and a rollback removes the version it rolled back from.
+func partialVersions(secrets []swarm.Secret, secretName string, current *swarm.Secret) []swarm.Secret {
+	var partial []swarm.Secret
+	for _, secret := range secrets {
+		if secret.ID != current.ID && secret.Spec.Labels[secretAliasLabel] == secretName && secret.CreatedAt.After(current.CreatedAt) {
+			partial = append(partial, secret)
+		}
+	}
+	return partial
 }
 
-// updateServicesSecretReference updates all services to use the new secret version
-func (d *VaultDriver) updateServicesSecretReference(oldSecretName, newSecretName, newSecretID string) error {
+// checkRotationConsumers treats a rotation that updated no services as an error
+// when VAULT_ROTATION_REQUIRE_CONSUMERS is enabled, since it usually means the
+// tracked secret name doesn't match what services reference
+func (d *VaultDriver) checkRotationConsumers(secretName string, updatedServices []string) error {
+	if len(updatedServices) > 0 {
+		return nil
+	}
+	d.metrics.inc("vault_rotation_no_consumers_total")
+	if !d.config.RequireConsumers {
+		log.Warnf("Rotation of secret %s did not update any services", secretName)
+		return nil
+	}
+	return fmt.Errorf("no services reference secret %s", secretName)
+}
+
+// validSecretName matches the names Docker accepts for secrets
+var validSecretName = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[a-zA-Z0-9-_.]*[a-zA-Z0-9])?$`)
+
+// versionedSecretName builds the name of a rotated secret version as
+// <prefix><name>-<version><suffix> and validates it against Docker's naming rules
+func versionedSecretName(secretName string, version int64, prefix, suffix string) (string, error) {
+	name := fmt.Sprintf("%s%s-%d%s", prefix, secretName, version, suffix)
+	if len(name) > 64 || !validSecretName.MatchString(name) {
+		return "", fmt.Errorf("invalid secret name %q: names must be at most 64 alphanumeric, '-', '_' or '.' characters and start and end with an alphanumeric character", name)
+	}
+	return name, nil
+}
+
+// findCurrentSecret locates the Docker secret currently backing an alias. It
+// prefers the tracked current name and falls back to the newest secret labelled
+// with the alias, or the secret carrying the alias name itself.
+func findCurrentSecret(secrets []swarm.Secret, secretName, currentName string) *swarm.Secret {
+	var found *swarm.Secret
+	for i := range secrets {
+		secret := &secrets[i]
+		if currentName != "" && secret.Spec.Name == currentName {
+			return secret
+		}
+		if secret.Spec.Name != secretName && secret.Spec.Labels[secretAliasLabel] != secretName {
+			continue
+		}
+		if found == nil || secret.CreatedAt.After(found.CreatedAt) {
+			found = secret
+		}
+	}
+	return found
+}
+
+// updateServicesSecretReference updates all services referencing any of the old
+// secret names to use the new secret version and returns the names of the
+// services that were and weren't updated. Unless continueOnError is set, it
+// stops at the first failed service update.
+func (d *VaultDriver) updateServicesSecretReference(oldSecretNames []string, newSecretName, newSecretID string, continueOnError bool) ([]string, []string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 	
 	// List all services
-	services, err := d.dockerClient.ServiceList(ctx, types.ServiceListOptions{})
+	services, err := d.listServices(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list services: %v", err)
+		return nil, nil, fmt.Errorf("failed to list services: %v", err)
+	}
+	sortServicesForUpdate(services, d.config.UpdateOrder)
+	oldNames := make(map[string]bool, len(oldSecretNames))
+	for _, name := range oldSecretNames {
+		oldNames[name] = true
 	}
 	
-	var updatedServices []string
+	var updatedServices, failedServices []string
 	
 	for _, service := range services {
 		// Check if service uses this secret and update the reference
@@ -575,7 +1368,7 @@ func (d *VaultDriver) updateServicesSecretReference(oldSecretName, newSecretName
 		updatedSecrets := make([]*swarm.SecretReference, len(service.Spec.TaskTemplate.ContainerSpec.Secrets))
 		
 		for i, secretRef := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
-			if secretRef.SecretName == oldSecretName {
+			if oldNames[secretRef.SecretName] {
 				// Update to use the new secret name and ID
 				updatedSecrets[i] = &swarm.SecretReference{
 					File:       secretRef.File,
@@ -597,12 +1390,17 @@ func (d *VaultDriver) updateServicesSecretReference(oldSecretName, newSecretName
 			if serviceSpec.Labels == nil {
 				serviceSpec.Labels = make(map[string]string)
 			}
-			serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", time.Now().Unix())
+			serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", d.now().Unix())
 			
 			updateOptions := types.ServiceUpdateOptions{}
-			updateResponse, err := d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, serviceSpec, updateOptions)
+			updateResponse, err := d.updateService(ctx, service, serviceSpec, updateOptions)
 			if err != nil {
-				return fmt.Errorf("failed to update service %s: %v", service.Spec.Name, err)
+				failedServices = append(failedServices, service.Spec.Name)
+				if !continueOnError {
+					return updatedServices, failedServices, fmt.Errorf("failed to update service %s: %v", service.Spec.Name, err)
+				}
+				log.Errorf("Failed to update service %s: %v", service.Spec.Name, err)
+				continue
 			}
 			
 			if len(updateResponse.Warnings) > 0 {
@@ -616,8 +1414,11 @@ func (d *VaultDriver) updateServicesSecretReference(oldSecretName, newSecretName
 	if len(updatedServices) > 0 {
 		log.Printf("Updated services to use new secret %s: %v", newSecretName, updatedServices)
 	}
+	if len(failedServices) > 0 {
+		return updatedServices, failedServices, fmt.Errorf("failed to update services %v", failedServices)
+	}
 	
-	return nil
+	return updatedServices, nil, nil
 }
 
 // updateServicesUsingSecret forces update of services using the rotated secret
@@ -626,10 +1427,11 @@ func (d *VaultDriver) updateServicesUsingSecret(secretInfo *SecretInfo) error {
 	defer cancel()
 	
 	// List all services
-	services, err := d.dockerClient.ServiceList(ctx, types.ServiceListOptions{})
+	services, err := d.listServices(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list services: %v", err)
 	}
+	sortServicesForUpdate(services, d.config.UpdateOrder)
 	
 	var updatedServices []string
 	
@@ -672,11 +1474,11 @@ func (d *VaultDriver) forceServiceUpdate(service swarm.Service) error {
 	if serviceSpec.Labels == nil {
 		serviceSpec.Labels = make(map[string]string)
 	}
-	serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", time.Now().Unix())
+	serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", d.now().Unix())
 	
 	// Update the service
 	updateOptions := types.ServiceUpdateOptions{}
-	updateResponse, err := d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, serviceSpec, updateOptions)
+	updateResponse, err := d.updateService(ctx, service, serviceSpec, updateOptions)
 	if err != nil {
 		return fmt.Errorf("failed to update service: %v", err)
 	}
@@ -689,11 +1491,15 @@ func (d *VaultDriver) forceServiceUpdate(service swarm.Service) error {
 	return nil
 }
 
-// Stop gracefully stops the monitoring
+// Stop gracefully stops the monitoring and revokes the leases read this session
 func (d *VaultDriver) Stop() error {
 	if d.monitorCancel != nil {
 		d.monitorCancel()
 	}
+	if d.adminServer != nil {
+		d.adminServer.Close()
+	}
+	d.revokeLeases()
 	if d.dockerClient != nil {
 		return d.dockerClient.Close()
 	}
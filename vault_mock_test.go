@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeVault is a minimal HTTP stand-in for the Vault logical API
+type fakeVault struct {
+	server       *httptest.Server
+	mutex        sync.Mutex
+	data         map[string]map[string]interface{} // key: logical path
+	reads        map[string]int
+	gone         map[string]bool   // paths answered with 404 and their data, like deleted KV v2 versions
+	leases       map[string]string // key: logical path, value: lease ID returned with reads
+	revoked      []string
+	capabilities map[string][]string // key: path, answered by sys/capabilities-self
+	status       int                 // when set, every request fails with this status
+}
+
+// newFakeVault starts a fake Vault server that is closed when the test ends
+func newFakeVault(t testing.TB) *fakeVault {
+	fv := &fakeVault{
+		data:         make(map[string]map[string]interface{}),
+		reads:        make(map[string]int),
+		gone:         make(map[string]bool),
+		leases:       make(map[string]string),
+		capabilities: make(map[string][]string),
+	}
+	fv.server = httptest.NewServer(http.HandlerFunc(fv.handle))
+	t.Cleanup(fv.server.Close)
+	return fv
+}
+
+func (fv *fakeVault) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if r.Method == http.MethodPut && path == "sys/leases/revoke" {
+		var body struct {
+			LeaseID string `json:"lease_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fv.mutex.Lock()
+		fv.revoked = append(fv.revoked, body.LeaseID)
+		fv.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method == http.MethodPost && path == "sys/capabilities-self" {
+		var body struct {
+			Path string `json:"path"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fv.mutex.Lock()
+		capabilities, ok := fv.capabilities[body.Path]
+		status := fv.status
+		fv.mutex.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		if !ok {
+			capabilities = []string{"deny"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"capabilities": capabilities}})
+		return
+	}
+
+	if path == "auth/approle/login" {
+		fv.mutex.Lock()
+		status := fv.status
+		fv.mutex.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "approle-token"}})
+		return
+	}
+
+	fv.mutex.Lock()
+	fv.reads[path]++
+	data, ok := fv.data[path]
+	gone := fv.gone[path]
+	leaseID := fv.leases[path]
+	status := fv.status
+	fv.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != 0 {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"errors":["Vault is sealed"]}`))
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	if gone {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	response := map[string]interface{}{"data": data, "lease_id": leaseID}
+	if leaseID != "" {
+		response["lease_duration"] = fakeLeaseTTL
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// setKV2 stores fields at a KV v2 path using the nested data layout
+func (fv *fakeVault) setKV2(path string, fields map[string]interface{}) {
+	fv.set(path, map[string]interface{}{"data": fields})
+}
+
+// setKV2Deleted makes a KV v2 path answer like a deleted or destroyed version
+func (fv *fakeVault) setKV2Deleted(path string, destroyed bool) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	metadata := map[string]interface{}{"version": 2, "destroyed": destroyed, "deletion_time": ""}
+	if !destroyed {
+		metadata["deletion_time"] = "2024-05-01T10:00:00.000000Z"
+	}
+	fv.data[path] = map[string]interface{}{"data": nil, "metadata": metadata}
+	fv.gone[path] = true
+}
+
+// set stores the raw data section returned for a logical path
+func (fv *fakeVault) set(path string, data map[string]interface{}) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	fv.data[path] = data
+	delete(fv.gone, path)
+}
+
+// setStatus makes every request fail with status, or succeed again when status is 0
+func (fv *fakeVault) setStatus(status int) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	fv.status = status
+}
+
+// fakeLeaseTTL is the TTL in seconds of the leases returned by the fake server
+const fakeLeaseTTL = 3600
+
+// setLease makes reads of path return a lease, like a dynamic secret
+func (fv *fakeVault) setLease(path, leaseID string) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	fv.leases[path] = leaseID
+}
+
+// revokedLeases returns the lease IDs revoked so far
+func (fv *fakeVault) revokedLeases() []string {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	return append([]string(nil), fv.revoked...)
+}
+
+// readCount returns how often a logical path has been requested
+func (fv *fakeVault) readCount(path string) int {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	return fv.reads[path]
+}
+
+// client returns a Vault API client pointed at the fake server
+func (fv *fakeVault) client(t testing.TB) *api.Client {
+	config := api.DefaultConfig()
+	config.Address = fv.server.URL
+	config.MaxRetries = 0
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create vault client: %v", err)
+	}
+	client.SetToken("test-token")
+	return client
+}
+
+// setCapabilities sets the capabilities sys/capabilities-self reports for path
+func (fv *fakeVault) setCapabilities(path string, capabilities ...string) {
+	fv.mutex.Lock()
+	defer fv.mutex.Unlock()
+	fv.capabilities[path] = capabilities
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rotationWindow is a daily time range, in minutes since midnight, during
+// which automatic rotations may run. A window whose end is before its start
+// wraps past midnight, e.g. 22:00-04:00.
+type rotationWindow struct {
+	start, end int
+}
+
+// contains reports whether a minute of the day falls in the window
+func (w rotationWindow) contains(minute int) bool {
+	if w.start == w.end {
+		return true
+	}
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// parseRotationWindows parses VAULT_ROTATION_WINDOWS, a comma-separated list of
+// HH:MM-HH:MM ranges. An invalid value is an error rather than rotating at
+// any time, which is what the windows are meant to prevent.
+func parseRotationWindows(value string) ([]rotationWindow, error) {
+	var windows []rotationWindow
+	for _, item := range parseList(value) {
+		window, err := parseRotationWindow(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VAULT_ROTATION_WINDOWS %q: %v", value, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseRotationWindow parses a single HH:MM-HH:MM range
+func parseRotationWindow(value string) (rotationWindow, error) {
+	start, end, found := strings.Cut(value, "-")
+	if !found {
+		return rotationWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+	}
+	var window rotationWindow
+	for i, part := range []string{start, end} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return rotationWindow{}, fmt.Errorf("invalid time %q in %q", part, value)
+		}
+		minute := t.Hour()*60 + t.Minute()
+		if i == 0 {
+			window.start = minute
+		} else {
+			window.end = minute
+		}
+	}
+	return window, nil
+}
+
+// parseLocation parses VAULT_ROTATION_TIMEZONE, falling back to UTC
+func parseLocation(value string) *time.Location {
+	location, err := time.LoadLocation(strings.TrimSpace(value))
+	if err != nil {
+		log.Warnf("Invalid time zone %q, using UTC: %v", value, err)
+		return time.UTC
+	}
+	return location
+}
+
+// inRotationWindow reports whether automatic rotations may run at t. Without
+// configured windows they always may.
+func (d *VaultDriver) inRotationWindow(t time.Time) bool {
+	if len(d.config.RotationWindows) == 0 {
+		return true
+	}
+	location := d.config.RotationLocation
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range d.config.RotationWindows {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// deferRotation remembers a change detected outside the rotation windows.
+// Keeping it apart from LastHash means a rehash or a cleared deletion can't
+// hide it before the next window.
+func (d *VaultDriver) deferRotation(secretInfo *SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.DeferredHash = secretInfo.CheckedHash
+}
+
+// hasDeferredChange reports whether a deferred change still awaits rotation
+func (d *VaultDriver) hasDeferredChange(secretInfo *SecretInfo) bool {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	return secretInfo.DeferredHash != ""
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// testRotationWindows parses windows that are expected to be valid
+func testRotationWindows(t *testing.T, value string) []rotationWindow {
+	t.Helper()
+	windows, err := parseRotationWindows(value)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return windows
+}
+
+func TestParseRotationWindows(t *testing.T) {
+	windows := testRotationWindows(t, "22:00-04:00, 12:00-13:30")
+	expected := []rotationWindow{{start: 22 * 60, end: 4 * 60}, {start: 12 * 60, end: 13*60 + 30}}
+	if len(windows) != len(expected) || windows[0] != expected[0] || windows[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, windows)
+	}
+	if windows := testRotationWindows(t, ""); windows != nil {
+		t.Errorf("Expected no windows for an empty value, got %v", windows)
+	}
+	for _, value := range []string{"22:00", "25:00-04:00", "12:00-13:00,bogus"} {
+		if windows, err := parseRotationWindows(value); err == nil {
+			t.Errorf("Expected an error for %q, got %v", value, windows)
+		}
+	}
+}
+
+func TestInRotationWindow(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	driver := &VaultDriver{config: &VaultConfig{
+		RotationWindows:  testRotationWindows(t, "22:00-04:00"),
+		RotationLocation: berlin,
+	}}
+	cases := map[string]bool{
+		"2026-01-15T21:30:00Z": true,  // 22:30 in Berlin
+		"2026-01-15T02:59:00Z": true,  // 03:59, window wraps past midnight
+		"2026-01-15T03:00:00Z": false, // 04:00, end is exclusive
+		"2026-01-15T11:00:00Z": false,
+	}
+	for value, expected := range cases {
+		now, _ := time.Parse(time.RFC3339, value)
+		if got := driver.inRotationWindow(now); got != expected {
+			t.Errorf("Expected %v at %s, got %v", expected, value, got)
+		}
+	}
+	if !(&VaultDriver{config: &VaultConfig{}}).inRotationWindow(time.Now()) {
+		t.Error("Expected rotations to be allowed at any time without windows")
+	}
+}
+
+func TestRotationDeferredOutsideWindow(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	clock := newFakeClock(time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			MountPath:       "secret",
+			EnableRotation:  true,
+			RotationWindows: testRotationWindows(t, "22:00-04:00"),
+		},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+
+	summary := driver.checkForSecretChanges()
+	if summary.Deferred != 1 || summary.Rotated != 0 {
+		t.Fatalf("Expected the rotation to be deferred, got %+v", summary)
+	}
+	if count := driver.metrics.counter("vault_rotations_deferred_total"); count != 1 {
+		t.Errorf("Expected 1 deferred rotation, got %v", count)
+	}
+	if name := driver.secretTracker["db"].CurrentSecretName; name != "db" {
+		t.Errorf("Expected no new version outside the window, got %s", name)
+	}
+
+	clock.Advance(12 * time.Hour)
+	summary = driver.checkForSecretChanges()
+	if summary.Rotated != 1 || summary.Deferred != 0 {
+		t.Fatalf("Expected the rotation to run inside the window, got %+v", summary)
+	}
+}
+
+func TestDeferredRotationSurvivesRehash(t *testing.T) {
+	fv := newFakeVault(t)
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v1"})
+	fd := newFakeDocker(t)
+	fd.addSecret("db-id", "db", nil)
+	fd.addService("svc-1", "web", "db")
+
+	clock := newFakeClock(time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC))
+	driver := &VaultDriver{
+		client: fv.client(t),
+		config: &VaultConfig{
+			MountPath:       "secret",
+			EnableRotation:  true,
+			RotationWindows: testRotationWindows(t, "22:00-04:00"),
+		},
+		dockerClient:  fd.client(t),
+		secretTracker: make(map[string]*SecretInfo),
+		metrics:       newDriverMetrics(),
+		clock:         clock,
+	}
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_field": "password"}}
+	if resp := driver.Get(req); resp.Err != "" {
+		t.Fatalf("Unexpected error: %s", resp.Err)
+	}
+	fv.setKV2("secret/data/db", map[string]interface{}{"password": "v2"})
+	if summary := driver.checkForSecretChanges(); summary.Deferred != 1 {
+		t.Fatalf("Expected the rotation to be deferred, got %+v", summary)
+	}
+
+	// Switching algorithms adopts the new hash without detecting a change,
+	// the deferred change must still be rotated
+	driver.config.HashAlgo = hashSHA512
+	if summary := driver.checkForSecretChanges(); summary.Changed != 0 || summary.Deferred != 1 {
+		t.Fatalf("Expected the change to stay deferred after rehashing, got %+v", summary)
+	}
+	clock.Advance(12 * time.Hour)
+	if summary := driver.checkForSecretChanges(); summary.Rotated != 1 {
+		t.Fatalf("Expected the deferred rotation to run inside the window, got %+v", summary)
+	}
+	if info := driver.secretTracker["db"]; info.DeferredHash != "" || info.CurrentSecretName == "db" {
+		t.Errorf("Expected a new version and no deferred change, got %+v", info)
+	}
+	if summary := driver.checkForSecretChanges(); summary.Rotated != 0 {
+		t.Errorf("Expected no further rotation, got %+v", summary)
+	}
+}